@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/urfave/cli/v3"
+
+	skiff "github.com/dcermak/skiff/pkg"
+)
+
+const defaultCacheMaxSize = "10GB"
+
+var (
+	noCacheFlag = cli.BoolFlag{
+		Name:  "no-cache",
+		Usage: "Do not store downloaded layers and layer indexes in the cache and do not read them from it",
+	}
+	cacheMaxSizeFlag = cli.StringFlag{
+		Name:  "cache-max-size",
+		Usage: "Maximum size of the layer cache, the least recently used layers and layer indexes are removed once it is exceeded (0 disables the limit)",
+		Value: defaultCacheMaxSize,
+		Validator: func(s string) error {
+			_, err := skiff.ParseHumanReadableSize(s)
+			return err
+		},
+	}
+)
+
+// cacheFlags are the global flags that configure the layer cache
+var cacheFlags = []cli.Flag{&noCacheFlag, &cacheMaxSizeFlag}
+
+// newBlobCache creates the layer cache configured by the global flags. nil is
+// returned if the cache is disabled.
+func newBlobCache(c *cli.Command) (*skiff.BlobCache, error) {
+	if c.Bool(noCacheFlag.Name) {
+		return nil, nil
+	}
+
+	maxSize, err := skiff.ParseHumanReadableSize(c.String(cacheMaxSizeFlag.Name))
+	if err != nil {
+		return nil, err
+	}
+	dir, err := skiff.DefaultCacheDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine the cache directory: %w", err)
+	}
+	return skiff.NewBlobCache(dir, maxSize), nil
+}
+
+// newIndexStore creates the store of layer indexes in the cache directory. nil
+// is returned if the cache is disabled.
+func newIndexStore(c *cli.Command) (*skiff.IndexStore, error) {
+	if c.Bool(noCacheFlag.Name) {
+		return nil, nil
+	}
+
+	maxSize, err := skiff.ParseHumanReadableSize(c.String(cacheMaxSizeFlag.Name))
+	if err != nil {
+		return nil, err
+	}
+	dir, err := skiff.DefaultCacheDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine the cache directory: %w", err)
+	}
+	return skiff.NewIndexStore(dir, maxSize), nil
+}
+
+var cacheCommand = cli.Command{
+	Name:  "cache",
+	Usage: "Manage the cache of downloaded layers",
+	Commands: []*cli.Command{
+		{
+			Name:  "prune",
+			Usage: "Remove layers and layer indexes from the cache",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "max-size",
+					Usage: "Only remove the least recently used layers and layer indexes until the cache is smaller than this size (e.g. 1GB)",
+				},
+			},
+			Action: func(ctx context.Context, c *cli.Command) error {
+				var maxSize int64
+				if c.IsSet("max-size") {
+					size, err := skiff.ParseHumanReadableSize(c.String("max-size"))
+					if err != nil {
+						return err
+					}
+					maxSize = size
+				}
+
+				dir, err := skiff.DefaultCacheDir()
+				if err != nil {
+					return fmt.Errorf("failed to determine the cache directory: %w", err)
+				}
+				removed, freed, err := skiff.NewBlobCache(dir, 0).Prune(maxSize)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(c.Writer, "Removed %d layers and layer indexes, freed %s\n", removed, skiff.HumanReadableSize(freed))
+				return nil
+			},
+		},
+	},
+}
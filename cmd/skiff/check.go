@@ -0,0 +1,446 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/urfave/cli/v3"
+	"go.podman.io/image/v5/types"
+
+	skiff "github.com/dcermak/skiff/pkg"
+)
+
+// names of the budgets of the check command, which are also the names of
+// their flags and configuration keys
+const (
+	budgetSize           = "max-size"
+	budgetCompressedSize = "max-compressed-size"
+	budgetLayerSize      = "max-layer-size"
+	budgetFileSize       = "max-file-size"
+	budgetWasted         = "max-wasted"
+)
+
+// exitBudgetExceeded is the exit code of the check command if any budget is
+// exceeded, errors exit with 1
+const exitBudgetExceeded = 2
+
+var checkCommand = cli.Command{
+	Name:      "check",
+	Usage:     "Check that an image stays within size budgets, e.g. in CI pipelines",
+	ArgsUsage: "[image]",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  budgetSize,
+			Usage: "Maximum uncompressed size of all layers, e.g. 200MB",
+		},
+		&cli.StringFlag{
+			Name:  budgetCompressedSize,
+			Usage: "Maximum compressed size of all layers",
+		},
+		&cli.StringFlag{
+			Name:  budgetLayerSize,
+			Usage: "Maximum uncompressed size of every layer",
+		},
+		&cli.StringFlag{
+			Name:  budgetFileSize,
+			Usage: "Maximum size of every file in the final root filesystem",
+		},
+		&cli.StringFlag{
+			Name:  budgetWasted,
+			Usage: "Maximum size of the files that are overwritten or deleted by a later layer",
+		},
+		&cli.BoolFlag{
+			Name:  "allow-unknown",
+			Usage: "Do not fail if a size cannot be measured, e.g. the compressed size of layers that were built locally",
+		},
+		&cli.StringFlag{
+			Name:  "junit",
+			Usage: "Write the results as JUnit XML report to this file",
+		},
+		&configFlag,
+		&cli.BoolFlag{
+			Name:  "human-readable",
+			Usage: "Show sizes in human readable format",
+		},
+		&cli.BoolFlag{
+			Name:        "full-digest",
+			Usage:       "Show full digests instead of truncated (12 chars)",
+			Aliases:     []string{"full-diff-id"},
+			DefaultText: "false",
+		},
+		&jobsFlag,
+		&quietFlag,
+	},
+	Arguments: []cli.Argument{
+		&cli.StringArg{Name: "image", UsageText: "Container image ref"},
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		image := c.StringArg("image")
+		if image == "" {
+			return fmt.Errorf("image URL is required")
+		}
+
+		cfg, err := readConfig(c)
+		if err != nil {
+			return err
+		}
+		opts := checkOptions{
+			humanReadable: c.Bool("human-readable"),
+			fullDigest:    c.Bool("full-digest"),
+			format:        c.String("format"),
+			junit:         cmp.Or(c.String("junit"), cfg.Check.JUnit),
+			allowUnknown:  c.Bool("allow-unknown") || cfg.Check.AllowUnknown,
+			jobs:          c.Int("jobs"),
+		}
+		configured := cfg.Check.budgets()
+		for _, name := range []string{budgetSize, budgetCompressedSize, budgetLayerSize, budgetFileSize, budgetWasted} {
+			value := cmp.Or(c.String(name), configured[name])
+			if value == "" {
+				continue
+			}
+			limit, err := skiff.ParseHumanReadableSize(value)
+			if err != nil {
+				return fmt.Errorf("invalid --%s: %w", name, err)
+			}
+			opts.budgets = append(opts.budgets, budget{name: name, limit: limit})
+		}
+		if len(opts.budgets) == 0 {
+			return fmt.Errorf("no budget given, set at least one of --%s, --%s, --%s, --%s or --%s",
+				budgetSize, budgetCompressedSize, budgetLayerSize, budgetFileSize, budgetWasted)
+		}
+
+		sysCtx, err := newSystemContext(c)
+		if err != nil {
+			return err
+		}
+
+		opts.progress = newLayerProgress(c)
+		if opts.progress != nil {
+			ctx = skiff.WithProgressReporter(ctx, opts.progress)
+			defer opts.progress.Wait()
+		}
+		failed, err := checkImage(ctx, sysCtx, image, opts, c.Writer)
+		if err != nil {
+			return err
+		}
+		if failed > 0 {
+			return cli.Exit(fmt.Sprintf("%d of %d budgets exceeded or not measured", failed, len(opts.budgets)), exitBudgetExceeded)
+		}
+		return nil
+	},
+}
+
+// budget is the maximum size in bytes of one of the budgets
+type budget struct {
+	name  string
+	limit int64
+}
+
+// checkOptions configures checkImage
+type checkOptions struct {
+	humanReadable bool
+	fullDigest    bool
+	format        string
+	budgets       []budget
+	// junit is the path of the JUnit XML report, no report is written if
+	// it is empty
+	junit string
+	// allowUnknown passes budgets whose size could not be measured instead
+	// of failing them
+	allowUnknown bool
+	jobs         int
+	progress     *layerProgress
+}
+
+// checkImage compares the image at uri against the budgets and lists the
+// results. The whole image is compared against the budgets of the total
+// sizes, the layers and files against their budgets, where every layer or file
+// that exceeds its budget is listed or the largest one if all stay within it.
+//
+// It returns the number of failed budgets, which are the exceeded budgets and,
+// unless opts.allowUnknown is set, the budgets whose size could not be
+// measured completely, so that a CI pipeline does not pass by accident.
+func checkImage(ctx context.Context, sysCtx *types.SystemContext, uri string, opts checkOptions, output io.Writer) (int, error) {
+	results, err := budgetResults(ctx, sysCtx, uri, opts)
+	if err != nil {
+		return 0, err
+	}
+	opts.progress.Wait()
+
+	var exceeded, unknown []string
+	for _, r := range results {
+		if r.Exceeded && !slices.Contains(exceeded, r.Budget) {
+			exceeded = append(exceeded, r.Budget)
+		}
+	}
+	for _, r := range results {
+		if r.Unknown() && !slices.Contains(exceeded, r.Budget) && !slices.Contains(unknown, r.Budget) {
+			unknown = append(unknown, r.Budget)
+		}
+	}
+	failed := len(exceeded)
+	if !opts.allowUnknown {
+		failed += len(unknown)
+	}
+
+	if opts.junit != "" {
+		if err := writeJUnitReport(opts.junit, uri, results, opts.allowUnknown); err != nil {
+			return failed, err
+		}
+	}
+
+	if opts.format != formatTable {
+		return failed, writeReport(output, opts.format, results)
+	}
+
+	formatSize := func(size int64) string {
+		if opts.humanReadable && size >= 0 {
+			return skiff.HumanReadableSize(size)
+		}
+		return formatLayerSize(size)
+	}
+
+	w := tabwriter.NewWriter(output, 0, 0, 2, ' ', tabwriter.TabIndent)
+	fmt.Fprintln(w, "BUDGET\tLIMIT\tACTUAL\tSTATUS\tSUBJECT")
+	for _, r := range results {
+		// layers are identified by their diffID, files by their path
+		subject := r.Subject
+		if d := digest.Digest(subject); d.Validate() == nil {
+			subject = skiff.FormatDigest(d, opts.fullDigest)
+		}
+		actual := formatSize(r.Actual)
+		if r.Incomplete {
+			// only the known sizes are added up
+			actual = ">=" + actual
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			r.Budget,
+			formatSize(r.Limit),
+			actual,
+			budgetStatus(r),
+			cmp.Or(subject, "-"),
+		)
+	}
+	if err := w.Flush(); err != nil {
+		return failed, err
+	}
+
+	if len(exceeded) == 0 && len(unknown) == 0 {
+		fmt.Fprintf(output, "\nAll %d budgets met\n", len(opts.budgets))
+	}
+	if len(exceeded) > 0 {
+		fmt.Fprintf(output, "\n%d of %d budgets exceeded: %s\n", len(exceeded), len(opts.budgets), strings.Join(exceeded, ", "))
+	}
+	if len(unknown) > 0 {
+		fmt.Fprintf(output, "\n%d of %d budgets could not be measured: %s\n", len(unknown), len(opts.budgets), strings.Join(unknown, ", "))
+	}
+	return failed, nil
+}
+
+// budgetStatus returns the status of a result for the table output
+func budgetStatus(r skiff.CheckReport) string {
+	switch {
+	case r.Exceeded:
+		return "exceeded"
+	case r.Unknown():
+		return "unknown"
+	}
+	return "ok"
+}
+
+// budgetResults measures the image at uri and compares it against the
+// budgets. The layer sizes are only read if a budget needs them, the layers
+// themselves only if a file or the wasted space is budgeted.
+func budgetResults(ctx context.Context, sysCtx *types.SystemContext, uri string, opts checkOptions) ([]skiff.CheckReport, error) {
+	needs := func(names ...string) bool {
+		return slices.ContainsFunc(opts.budgets, func(b budget) bool { return slices.Contains(names, b.name) })
+	}
+
+	var layers []skiff.LayerReport
+	if needs(budgetSize, budgetCompressedSize, budgetLayerSize) {
+		var err error
+		if layers, err = layerReports(ctx, sysCtx, uri, false, true); err != nil {
+			return nil, err
+		}
+	}
+
+	var fs *skiff.Filesystem
+	if needs(budgetFileSize, budgetWasted) {
+		imgLayers, err := skiff.OpenImageLayers(ctx, sysCtx, uri)
+		if err != nil {
+			return nil, err
+		}
+		defer imgLayers.Close()
+		if fs, err = imgLayers.Merge(ctx, opts.jobs, false); err != nil {
+			return nil, err
+		}
+	}
+
+	var results []skiff.CheckReport
+	for _, b := range opts.budgets {
+		switch b.name {
+		case budgetSize, budgetCompressedSize:
+			// the known sizes are a lower bound of the total, which
+			// may already exceed the budget
+			var total int64
+			incomplete := false
+			for _, l := range layers {
+				size := l.UncompressedSize
+				if b.name == budgetCompressedSize {
+					size = l.CompressedSize
+				}
+				if size < 0 {
+					incomplete = true
+					continue
+				}
+				total += size
+			}
+			r := newCheckReport(b, "", total)
+			r.Incomplete = incomplete
+			results = append(results, r)
+
+		case budgetLayerSize:
+			var sizes []subjectSize
+			for _, l := range layers {
+				sizes = append(sizes, subjectSize{cmp.Or(l.DiffID, l.Digest).String(), l.UncompressedSize})
+			}
+			results = append(results, subjectResults(b, sizes)...)
+
+		case budgetFileSize:
+			var sizes []subjectSize
+			_ = fs.Walk(func(n *skiff.Node) error {
+				if n.Entry.IsRegular() {
+					sizes = append(sizes, subjectSize{n.Entry.Path, n.Entry.Size})
+				}
+				return nil
+			})
+			results = append(results, subjectResults(b, sizes)...)
+
+		case budgetWasted:
+			_, wasted := wastedSpace(fs)
+			results = append(results, newCheckReport(b, "", wasted))
+		}
+	}
+	return results, nil
+}
+
+// subjectSize is the size of a layer or a file
+type subjectSize struct {
+	subject string
+	size    int64
+}
+
+// subjectResults compares the layers or files against the budget. Every one
+// that exceeds it is reported, largest first, or the largest one if none
+// exceeds it. The ones whose size is unknown are always reported.
+func subjectResults(b budget, sizes []subjectSize) []skiff.CheckReport {
+	slices.SortStableFunc(sizes, func(a, b subjectSize) int {
+		return cmp.Or(cmp.Compare(b.size, a.size), strings.Compare(a.subject, b.subject))
+	})
+
+	var results []skiff.CheckReport
+	for _, s := range sizes {
+		if s.size <= b.limit {
+			break
+		}
+		results = append(results, newCheckReport(b, s.subject, s.size))
+	}
+	if len(results) == 0 && len(sizes) > 0 && sizes[0].size >= 0 {
+		results = append(results, newCheckReport(b, sizes[0].subject, sizes[0].size))
+	}
+	for _, s := range sizes {
+		if s.size < 0 {
+			results = append(results, newCheckReport(b, s.subject, s.size))
+		}
+	}
+	return results
+}
+
+// newCheckReport compares the measured size of the subject against the
+// budget, unknown sizes never exceed it
+func newCheckReport(b budget, subject string, actual int64) skiff.CheckReport {
+	return skiff.CheckReport{
+		Budget:   b.name,
+		Subject:  subject,
+		Limit:    b.limit,
+		Actual:   actual,
+		Exceeded: actual > b.limit,
+	}
+}
+
+// junitTestSuites is the root element of JUnit XML reports
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitMessage `xml:"failure"`
+	Skipped   *junitMessage `xml:"skipped"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+}
+
+// writeJUnitReport writes the results as JUnit XML report to path, every
+// result is a test case that fails if its budget is exceeded. Results whose
+// size is unknown fail as well, unless allowUnknown is set, then they are
+// skipped.
+func writeJUnitReport(path string, uri string, results []skiff.CheckReport, allowUnknown bool) error {
+	suite := junitTestSuite{Name: "skiff check " + uri, Tests: len(results)}
+	for _, r := range results {
+		tc := junitTestCase{Name: r.Budget, ClassName: "skiff.check"}
+		if r.Subject != "" {
+			tc.Name += " " + r.Subject
+		}
+		switch {
+		case r.Exceeded:
+			tc.Failure = &junitMessage{Message: fmt.Sprintf("size of %d bytes exceeds the budget of %d bytes", r.Actual, r.Limit)}
+			suite.Failures++
+		case r.Unknown() && allowUnknown:
+			tc.Skipped = &junitMessage{Message: unknownSizeMessage(r)}
+			suite.Skipped++
+		case r.Unknown():
+			tc.Failure = &junitMessage{Message: unknownSizeMessage(r)}
+			suite.Failures++
+		}
+		suite.TestCases = append(suite.TestCases, tc)
+	}
+
+	data, err := xml.MarshalIndent(junitTestSuites{Suites: []junitTestSuite{suite}}, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append([]byte(xml.Header), append(data, '\n')...)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write the JUnit report: %w", err)
+	}
+	return nil
+}
+
+// unknownSizeMessage explains a result whose size could not be measured
+func unknownSizeMessage(r skiff.CheckReport) string {
+	if r.Incomplete {
+		return fmt.Sprintf("size is unknown, the known part of %d bytes stays within the budget of %d bytes", r.Actual, r.Limit)
+	}
+	return "size is unknown"
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/dcermak/skiff/pkg/imagetest"
+)
+
+func TestCheckImage(t *testing.T) {
+	img := imagetest.Image{Layers: []imagetest.Layer{
+		{Files: []imagetest.File{
+			{Path: "usr/bin/big", Content: strings.Repeat("x", 5000)},
+			{Path: "opt/data", Content: strings.Repeat("x", 3000)},
+			{Path: "etc/config", Content: strings.Repeat("x", 100)},
+		}},
+		{Files: []imagetest.File{
+			{Path: "usr/bin/big", Content: strings.Repeat("x", 200)},
+			{Path: "opt/more", Content: strings.Repeat("x", 1500)},
+		}},
+	}}
+	uri := imagetest.WriteOCILayout(t, img)
+	ctx := context.Background()
+
+	layers, err := layerReports(ctx, nil, uri, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, update := layers[0], layers[1]
+	totalSize := strconv.FormatInt(base.UncompressedSize+update.UncompressedSize, 10)
+	compressedSize := base.CompressedSize + update.CompressedSize
+
+	tests := []struct {
+		name     string
+		opts     checkOptions
+		failed   int
+		expected string
+	}{
+		{
+			name: "files",
+			opts: checkOptions{format: formatTable, budgets: []budget{
+				{budgetFileSize, 1000},
+				{budgetWasted, 10000},
+			}},
+			failed: 1,
+			expected: "BUDGET         LIMIT  ACTUAL  STATUS    SUBJECT\n" +
+				"max-file-size  1000   3000    exceeded  /opt/data\n" +
+				"max-file-size  1000   1500    exceeded  /opt/more\n" +
+				"max-wasted     10000  5000    ok        -\n" +
+				"\n1 of 2 budgets exceeded: max-file-size\n",
+		},
+		{
+			name: "within budget",
+			opts: checkOptions{format: formatTable, humanReadable: true, budgets: []budget{{budgetFileSize, 5000}}},
+			expected: "BUDGET         LIMIT   ACTUAL  STATUS  SUBJECT\n" +
+				"max-file-size  5.0 kB  3.0 kB  ok      /opt/data\n" +
+				"\nAll 1 budgets met\n",
+		},
+		{
+			name: "layers",
+			opts: checkOptions{format: formatCSV, budgets: []budget{
+				{budgetSize, 1000},
+				{budgetCompressedSize, compressedSize},
+				{budgetLayerSize, 1 << 30},
+			}},
+			failed: 1,
+			expected: "budget,subject,limit,actual,exceeded,incomplete\n" +
+				"max-size,,1000," + totalSize + ",true,false\n" +
+				"max-compressed-size,," + strconv.FormatInt(compressedSize, 10) + "," + strconv.FormatInt(compressedSize, 10) + ",false,false\n" +
+				"max-layer-size," + base.DiffID.String() + ",1073741824," + strconv.FormatInt(base.UncompressedSize, 10) + ",false,false\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			failed, err := checkImage(ctx, nil, uri, tt.opts, &buf)
+			if err != nil {
+				t.Fatalf("checkImage failed: %v", err)
+			}
+			if failed != tt.failed {
+				t.Errorf("Expected %d failed budgets, got %d", tt.failed, failed)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tt.expected, buf.String())
+			}
+		})
+	}
+
+	t.Run("junit", func(t *testing.T) {
+		junit := filepath.Join(t.TempDir(), "report.xml")
+		opts := checkOptions{format: formatJSON, junit: junit, budgets: []budget{
+			{budgetFileSize, 2000},
+			{budgetWasted, 10000},
+		}}
+		if _, err := checkImage(ctx, nil, uri, opts, &bytes.Buffer{}); err != nil {
+			t.Fatalf("checkImage failed: %v", err)
+		}
+
+		report, err := os.ReadFile(junit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+  <testsuite name="skiff check ` + uri + `" tests="2" failures="1" skipped="0">
+    <testcase name="max-file-size /opt/data" classname="skiff.check">
+      <failure message="size of 3000 bytes exceeds the budget of 2000 bytes"></failure>
+    </testcase>
+    <testcase name="max-wasted" classname="skiff.check"></testcase>
+  </testsuite>
+</testsuites>
+`
+		if string(report) != expected {
+			t.Errorf("Expected:\n%s\ngot:\n%s", expected, report)
+		}
+	})
+}
+
+func TestCheckImageUnknownSize(t *testing.T) {
+	img := imagetest.Image{Layers: []imagetest.Layer{
+		{Files: []imagetest.File{{Path: "usr/bin/big", Content: strings.Repeat("x", 5000)}}},
+		{Files: []imagetest.File{{Path: "opt/app", Content: strings.Repeat("x", 1500)}}},
+	}}
+	// the layers of locally built images have never been compressed
+	uri := imagetest.CommitContainerStorage(t, img, "localhost/skiff-check:latest")
+	ctx := context.Background()
+	budgets := []budget{{budgetCompressedSize, 1000}, {budgetSize, 1 << 30}}
+	totalSize := fmt.Sprintf("%-8d", len(img.Layers[0].Tar(t))+len(img.Layers[1].Tar(t)))
+
+	tests := []struct {
+		name         string
+		allowUnknown bool
+		failed       int
+		expected     string
+	}{
+		{
+			name:   "unknown fails",
+			failed: 1,
+			expected: "BUDGET               LIMIT       ACTUAL  STATUS   SUBJECT\n" +
+				"max-compressed-size  1000        >=0     unknown  -\n" +
+				"max-size             1073741824  " + totalSize + "ok       -\n" +
+				"\n1 of 2 budgets could not be measured: max-compressed-size\n",
+		},
+		{
+			name:         "allow unknown",
+			allowUnknown: true,
+			expected: "BUDGET               LIMIT       ACTUAL  STATUS   SUBJECT\n" +
+				"max-compressed-size  1000        >=0     unknown  -\n" +
+				"max-size             1073741824  " + totalSize + "ok       -\n" +
+				"\n1 of 2 budgets could not be measured: max-compressed-size\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			junit := filepath.Join(t.TempDir(), "report.xml")
+			var buf bytes.Buffer
+			opts := checkOptions{format: formatTable, budgets: budgets, allowUnknown: tt.allowUnknown, junit: junit}
+			failed, err := checkImage(ctx, nil, uri, opts, &buf)
+			if err != nil {
+				t.Fatalf("checkImage failed: %v", err)
+			}
+			if failed != tt.failed {
+				t.Errorf("Expected %d failed budgets, got %d", tt.failed, failed)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tt.expected, buf.String())
+			}
+
+			report, err := os.ReadFile(junit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			element := "failure"
+			if tt.allowUnknown {
+				element = "skipped"
+			}
+			expected := "<" + element + ` message="size is unknown, the known part of 0 bytes stays within the budget of 1000 bytes">`
+			if !strings.Contains(string(report), expected) {
+				t.Errorf("Expected the JUnit report to contain %s, got:\n%s", expected, report)
+			}
+		})
+	}
+}
+
+func TestCheckConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "skiff.toml")
+	content := "[check]\nmax-size = \"200MB\"\nmax-wasted = \"1MB\"\njunit = \"report.xml\"\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	budgets := cfg.Check.budgets()
+	if budgets[budgetSize] != "200MB" || budgets[budgetWasted] != "1MB" || budgets[budgetFileSize] != "" {
+		t.Errorf("Unexpected budgets %v", budgets)
+	}
+	if cfg.Check.JUnit != "report.xml" {
+		t.Errorf("Expected the JUnit report report.xml, got %q", cfg.Check.JUnit)
+	}
+}
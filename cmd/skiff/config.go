@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/urfave/cli/v3"
+
+	skiff "github.com/dcermak/skiff/pkg"
+)
+
+// config is the content of the TOML configuration file that is passed with
+// --config
+type config struct {
+	Lint  lintConfig  `toml:"lint"`
+	Check checkConfig `toml:"check"`
+}
+
+// checkConfig contains the defaults of the budgets of the check command,
+// which are sizes like 200MB
+type checkConfig struct {
+	MaxSize           string `toml:"max-size"`
+	MaxCompressedSize string `toml:"max-compressed-size"`
+	MaxLayerSize      string `toml:"max-layer-size"`
+	MaxFileSize       string `toml:"max-file-size"`
+	MaxWasted         string `toml:"max-wasted"`
+	// JUnit is the default of the --junit flag
+	JUnit string `toml:"junit"`
+	// AllowUnknown is the default of the --allow-unknown flag
+	AllowUnknown bool `toml:"allow-unknown"`
+}
+
+// budgets maps the names of the budgets to their configured limits
+func (cfg checkConfig) budgets() map[string]string {
+	return map[string]string{
+		budgetSize:           cfg.MaxSize,
+		budgetCompressedSize: cfg.MaxCompressedSize,
+		budgetLayerSize:      cfg.MaxLayerSize,
+		budgetFileSize:       cfg.MaxFileSize,
+		budgetWasted:         cfg.MaxWasted,
+	}
+}
+
+// lintConfig configures the rules of the lint command
+type lintConfig struct {
+	// FailOn is the default of the --fail-on flag
+	FailOn string `toml:"fail-on"`
+	// Rules modifies the built-in rules by their ID, other IDs define
+	// additional rules that flag the files matching their paths
+	Rules map[string]lintRuleConfig `toml:"rules"`
+}
+
+// lintRuleConfig modifies a lint rule, unset fields keep their defaults
+type lintRuleConfig struct {
+	Enabled     *bool  `toml:"enabled"`
+	Description string `toml:"description"`
+	Severity    string `toml:"severity"`
+	// MinSize is a size like 10MB or 512KiB
+	MinSize string `toml:"min-size"`
+	// Paths replaces the patterns of the files that the rule flags
+	Paths []string `toml:"paths"`
+	// Exclude is added to the patterns of the files that the rule ignores
+	Exclude []string `toml:"exclude"`
+}
+
+var configFlag = cli.StringFlag{
+	Name:  "config",
+	Usage: "TOML configuration file with the rules of lint and the budgets of check",
+}
+
+// readConfig loads the configuration file passed with --config, without it
+// the configuration is empty
+func readConfig(c *cli.Command) (config, error) {
+	path := c.String(configFlag.Name)
+	if path == "" {
+		return config{}, nil
+	}
+	return loadConfig(path)
+}
+
+// loadConfig reads the configuration file at path, unknown keys are rejected
+// so that typos do not go unnoticed.
+func loadConfig(path string) (config, error) {
+	var cfg config
+	md, err := toml.DecodeFile(path, &cfg)
+	if err != nil {
+		return config{}, fmt.Errorf("failed to read the configuration file %s: %w", path, err)
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, 0, len(undecoded))
+		for _, k := range undecoded {
+			keys = append(keys, k.String())
+		}
+		return config{}, fmt.Errorf("unknown keys in the configuration file %s: %s", path, strings.Join(keys, ", "))
+	}
+	return cfg, nil
+}
+
+// rules returns the built-in lint rules with the modifications of the
+// configuration and the additional rules that it defines, the latter ordered
+// by their ID.
+func (cfg lintConfig) rules() ([]skiff.LintRule, error) {
+	rules := skiff.DefaultLintRules()
+
+	ids := make([]string, 0, len(cfg.Rules))
+	for id := range cfg.Rules {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	var disabled []string
+	for _, id := range ids {
+		rc := cfg.Rules[id]
+		i := slices.IndexFunc(rules, func(r skiff.LintRule) bool { return r.ID == id })
+		if i < 0 {
+			if len(rc.Paths) == 0 {
+				return nil, fmt.Errorf("rule %s: additional rules must have paths", id)
+			}
+			rules = append(rules, skiff.LintRule{ID: id, Description: rc.Description, Severity: skiff.SeverityWarning})
+			i = len(rules) - 1
+		}
+
+		for _, pattern := range slices.Concat(rc.Paths, rc.Exclude) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("rule %s: invalid pattern %q: %w", id, pattern, err)
+			}
+		}
+
+		r := &rules[i]
+		if rc.Enabled != nil && !*rc.Enabled {
+			disabled = append(disabled, id)
+		}
+		if rc.Description != "" {
+			r.Description = rc.Description
+		}
+		if rc.Severity != "" {
+			severity, err := skiff.ParseSeverity(rc.Severity)
+			if err != nil {
+				return nil, fmt.Errorf("rule %s: %w", id, err)
+			}
+			r.Severity = severity
+		}
+		if rc.MinSize != "" {
+			minSize, err := skiff.ParseHumanReadableSize(rc.MinSize)
+			if err != nil {
+				return nil, fmt.Errorf("rule %s: %w", id, err)
+			}
+			r.MinSize = minSize
+		}
+		if len(rc.Paths) > 0 {
+			if !r.SupportsPaths() {
+				return nil, fmt.Errorf("rule %s: the paths of this rule cannot be changed", id)
+			}
+			r.Paths = rc.Paths
+		}
+		r.Exclude = append(r.Exclude, rc.Exclude...)
+	}
+
+	return slices.DeleteFunc(rules, func(r skiff.LintRule) bool {
+		return slices.Contains(disabled, r.ID)
+	}), nil
+}
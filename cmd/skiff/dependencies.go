@@ -0,0 +1,171 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/urfave/cli/v3"
+	"go.podman.io/image/v5/types"
+
+	skiff "github.com/dcermak/skiff/pkg"
+)
+
+// ecosystems are the valid values of the --ecosystem flag
+var ecosystems = []string{skiff.EcosystemPython, skiff.EcosystemNPM, skiff.EcosystemGem, skiff.EcosystemMaven, skiff.EcosystemGo}
+
+var dependenciesCommand = cli.Command{
+	Name:      "dependencies",
+	Usage:     "List the dependencies of language ecosystems (Python, npm, Ruby gems, Maven, Go) in an image by size",
+	ArgsUsage: "[image]",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "human-readable",
+			Usage: "Show sizes in human readable format",
+		},
+		&cli.BoolFlag{
+			Name:        "full-digest",
+			Usage:       "Show full digests instead of truncated (12 chars)",
+			Aliases:     []string{"full-diff-id"},
+			DefaultText: "false",
+		},
+		&cli.StringSliceFlag{
+			Name:  "ecosystem",
+			Usage: "Only list the dependencies of these ecosystems (python, npm, gem, maven or go)",
+			Validator: func(values []string) error {
+				for _, e := range values {
+					if !slices.Contains(ecosystems, e) {
+						return fmt.Errorf("invalid ecosystem %q, must be one of python, npm, gem, maven or go", e)
+					}
+				}
+				return nil
+			},
+		},
+		&cli.IntFlag{
+			Name:  "limit",
+			Usage: "Number of dependencies to list, 0 lists all dependencies",
+		},
+		&jobsFlag,
+		&quietFlag,
+	},
+	Arguments: []cli.Argument{
+		&cli.StringArg{Name: "image", UsageText: "Container image ref"},
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		image := c.StringArg("image")
+		if image == "" {
+			return fmt.Errorf("image URL is required")
+		}
+		if c.Int("limit") < 0 {
+			return fmt.Errorf("--limit must not be negative")
+		}
+
+		sysCtx, err := newSystemContext(c)
+		if err != nil {
+			return err
+		}
+
+		opts := dependenciesOptions{
+			humanReadable: c.Bool("human-readable"),
+			fullDigest:    c.Bool("full-digest"),
+			format:        c.String("format"),
+			ecosystems:    c.StringSlice("ecosystem"),
+			limit:         c.Int("limit"),
+			jobs:          c.Int("jobs"),
+			progress:      newLayerProgress(c),
+		}
+		if opts.progress != nil {
+			ctx = skiff.WithProgressReporter(ctx, opts.progress)
+			defer opts.progress.Wait()
+		}
+		return showDependencies(ctx, sysCtx, image, opts, c.Writer)
+	},
+}
+
+// dependenciesOptions configures the output of showDependencies
+type dependenciesOptions struct {
+	humanReadable bool
+	fullDigest    bool
+	format        string
+	// ecosystems restricts the listed dependencies to these ecosystems
+	ecosystems []string
+	// limit is the maximum number of listed dependencies, 0 lists all
+	limit    int
+	jobs     int
+	progress *layerProgress
+}
+
+// showDependencies lists the disk space that every dependency of a language
+// ecosystem occupies in every layer of the image at uri, largest first.
+func showDependencies(ctx context.Context, sysCtx *types.SystemContext, uri string, opts dependenciesOptions, output io.Writer) error {
+	imgLayers, err := skiff.OpenImageLayers(ctx, sysCtx, uri)
+	if err != nil {
+		return err
+	}
+	defer imgLayers.Close()
+
+	entries, err := imgLayers.ReadEntries(ctx, nil, opts.jobs, false)
+	if err != nil {
+		return err
+	}
+	usage, err := imgLayers.Dependencies(ctx, entries, opts.jobs)
+	if err != nil {
+		return err
+	}
+	opts.progress.Wait()
+
+	if len(opts.ecosystems) > 0 {
+		usage = slices.DeleteFunc(usage, func(u skiff.DependencyUsage) bool {
+			return !slices.Contains(opts.ecosystems, u.Ecosystem)
+		})
+	}
+	if opts.limit > 0 && len(usage) > opts.limit {
+		usage = usage[:opts.limit]
+	}
+
+	if opts.format != formatTable {
+		reports := make([]skiff.DependencyReport, 0, len(usage))
+		for _, u := range usage {
+			reports = append(reports, skiff.DependencyReport{
+				Ecosystem: u.Ecosystem,
+				Name:      u.Name,
+				Version:   u.Version,
+				Path:      u.Path,
+				Size:      u.Size,
+				Files:     u.Files,
+				DiffID:    u.DiffID,
+			})
+		}
+		return writeReport(output, opts.format, reports)
+	}
+
+	var totalSize int64
+	w := tabwriter.NewWriter(output, 0, 0, 2, ' ', tabwriter.TabIndent)
+	fmt.Fprintln(w, "ECOSYSTEM\tNAME\tVERSION\tSIZE\tFILES\tDIFF ID\tPATH")
+	for _, u := range usage {
+		size := strconv.FormatInt(u.Size, 10)
+		if opts.humanReadable {
+			size = skiff.HumanReadableSize(u.Size)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			u.Ecosystem,
+			u.Name,
+			cmp.Or(u.Version, "-"),
+			size,
+			u.Files,
+			skiff.FormatDigest(u.DiffID, opts.fullDigest),
+			u.Path,
+		)
+		totalSize += u.Size
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(output, "\nTotal: %s\n", formatTotalSize(totalSize, opts.humanReadable))
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/dcermak/skiff/pkg/imagetest"
+)
+
+func TestShowDependencies(t *testing.T) {
+	img := imagetest.Image{Layers: []imagetest.Layer{
+		{Files: []imagetest.File{
+			{Path: "app/node_modules/left-pad/package.json", Content: `{"name": "left-pad", "version": "1.3.0"}`},
+			{Path: "app/node_modules/left-pad/index.js", Content: strings.Repeat("x", 960)},
+			{Path: "usr/lib64/ruby/gems/3.3.0/specifications/rake-13.1.0.gemspec", Content: "spec"},
+			{Path: "usr/lib64/ruby/gems/3.3.0/gems/rake-13.1.0/lib/rake.rb", Content: strings.Repeat("x", 50)},
+		}},
+	}}
+	uri := imagetest.WriteOCILayout(t, img)
+	base := img.Layers[0].DiffID(t).Encoded()[:12]
+
+	tests := []struct {
+		name     string
+		opts     dependenciesOptions
+		expected string
+	}{
+		{
+			name: "table",
+			opts: dependenciesOptions{format: formatTable},
+			expected: "ECOSYSTEM  NAME      VERSION  SIZE  FILES  DIFF ID       PATH\n" +
+				"npm        left-pad  1.3.0    1000  2      " + base + "  /app/node_modules/left-pad\n" +
+				"gem        rake      13.1.0   50    1      " + base + "  /usr/lib64/ruby/gems/3.3.0/gems/rake-13.1.0\n" +
+				"\nTotal: 1050 bytes\n",
+		},
+		{
+			name: "ecosystem",
+			opts: dependenciesOptions{format: formatTable, ecosystems: []string{"gem"}, humanReadable: true},
+			expected: "ECOSYSTEM  NAME  VERSION  SIZE  FILES  DIFF ID       PATH\n" +
+				"gem        rake  13.1.0   50 B  1      " + base + "  /usr/lib64/ruby/gems/3.3.0/gems/rake-13.1.0\n" +
+				"\nTotal: 50 B\n",
+		},
+		{
+			name: "csv",
+			opts: dependenciesOptions{format: formatCSV, limit: 1},
+			expected: "ecosystem,name,version,path,size,files,diffID\n" +
+				"npm,left-pad,1.3.0,/app/node_modules/left-pad,1000,2,sha256:" + img.Layers[0].DiffID(t).Encoded() + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := showDependencies(context.Background(), nil, uri, tt.opts, &buf); err != nil {
+				t.Fatalf("showDependencies failed: %v", err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tt.expected, buf.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/urfave/cli/v3"
+	"go.podman.io/image/v5/types"
+
+	skiff "github.com/dcermak/skiff/pkg"
+)
+
+var diffCommand = cli.Command{
+	Name:  "diff",
+	Usage: "Compare the layers and files of two images",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "human-readable",
+			Usage: "Show file sizes in human readable format",
+		},
+		&cli.BoolFlag{
+			Name:        "full-digest",
+			Usage:       "Show full digests instead of truncated (12 chars)",
+			Aliases:     []string{"full-diff-id"},
+			DefaultText: "false",
+		},
+		&jobsFlag,
+	},
+	Arguments: []cli.Argument{
+		&cli.StringArg{Name: "from", UsageText: "Container image ref of the old image"},
+		&cli.StringArg{Name: "to", UsageText: "Container image ref of the new image"},
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		from, to := c.StringArg("from"), c.StringArg("to")
+		if from == "" || to == "" {
+			return fmt.Errorf("two image URLs are required")
+		}
+
+		if err := requireTableFormat(c); err != nil {
+			return err
+		}
+
+		sysCtx, err := newSystemContext(c)
+		if err != nil {
+			return err
+		}
+		return showImageDiff(ctx, sysCtx, from, to, c.Writer, c.Bool("human-readable"), c.Bool("full-digest"), c.Int("jobs"))
+	},
+}
+
+// LayerChange is a layer of one of two compared images.
+type LayerChange struct {
+	DiffID digest.Digest
+	// Status is one of "shared", "added" (only in the new image) or
+	// "removed" (only in the old image)
+	Status string
+}
+
+// diffLayers matches the layers of two images by their diffID. Layers of the
+// new image are returned first in their order, followed by the layers that are
+// only present in the old image.
+func diffLayers(from, to []digest.Digest) []LayerChange {
+	var changes []LayerChange
+	for _, d := range to {
+		status := "added"
+		if slices.Contains(from, d) {
+			status = "shared"
+		}
+		changes = append(changes, LayerChange{DiffID: d, Status: status})
+	}
+	for _, d := range from {
+		if !slices.Contains(to, d) {
+			changes = append(changes, LayerChange{DiffID: d, Status: "removed"})
+		}
+	}
+	return changes
+}
+
+// mergeImage opens the image at uri and returns its layers and its merged
+// filesystem, reading up to jobs layers concurrently. The content of the files
+// is not hashed.
+//
+// The caller has to close the returned layers.
+func mergeImage(ctx context.Context, sysCtx *types.SystemContext, uri string, jobs int) (*skiff.ImageLayers, *skiff.Filesystem, error) {
+	imgLayers, err := skiff.OpenImageLayers(ctx, sysCtx, uri)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fs, err := imgLayers.Merge(ctx, jobs, false)
+	if err != nil {
+		imgLayers.Close()
+		return nil, nil, err
+	}
+	return imgLayers, fs, nil
+}
+
+// showImageDiff prints the layers shared between the images at the uris from
+// and to, the layers that are only present in one of them and the files that
+// were added, removed or changed in the merged filesystem of to compared to
+// from.
+//
+// The content of a file is only hashed if its other attributes are equal in
+// both images and it was provided by layers with different diffIDs.
+func showImageDiff(ctx context.Context, sysCtx *types.SystemContext, from, to string, output io.Writer, humanReadable bool, fullDigest bool, jobs int) error {
+	fromLayers, fromFs, err := mergeImage(ctx, sysCtx, from, jobs)
+	if err != nil {
+		return err
+	}
+	defer fromLayers.Close()
+	toLayers, toFs, err := mergeImage(ctx, sysCtx, to, jobs)
+	if err != nil {
+		return err
+	}
+	defer toLayers.Close()
+
+	candidates := skiff.ContentCandidates(fromFs, toFs)
+	if err := fromLayers.DigestFiles(ctx, fromFs, candidates, jobs); err != nil {
+		return fmt.Errorf("failed to hash the files of %s: %w", from, err)
+	}
+	if err := toLayers.DigestFiles(ctx, toFs, candidates, jobs); err != nil {
+		return fmt.Errorf("failed to hash the files of %s: %w", to, err)
+	}
+
+	formatSize := func(entry *skiff.FileEntry) string {
+		if entry == nil {
+			return "-"
+		}
+		if humanReadable {
+			return skiff.HumanReadableSize(entry.Size)
+		}
+		return strconv.FormatInt(entry.Size, 10)
+	}
+
+	w := tabwriter.NewWriter(output, 0, 0, 2, ' ', tabwriter.TabIndent)
+	fmt.Fprintln(w, "DIFF ID\tSTATUS")
+	for _, l := range diffLayers(fromLayers.DiffIDs, toLayers.DiffIDs) {
+		fmt.Fprintf(w, "%s\t%s\n", skiff.FormatDigest(l.DiffID, fullDigest), l.Status)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintln(output)
+
+	changes := skiff.DiffFilesystems(fromFs, toFs)
+	counts := map[skiff.ChangeKind]int{}
+	var sizeDelta int64
+
+	w = tabwriter.NewWriter(output, 0, 0, 2, ' ', tabwriter.TabIndent)
+	fmt.Fprintln(w, "STATUS\tFILE PATH\tOLD SIZE\tNEW SIZE\tCHANGES")
+	for _, c := range changes {
+		counts[c.Kind]++
+		sizeDelta += c.SizeDelta()
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", c.Kind, c.Path, formatSize(c.Old), formatSize(c.New), strings.Join(c.Changes, ","))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	sign := "+"
+	if sizeDelta < 0 {
+		sign = "-"
+		sizeDelta = -sizeDelta
+	}
+	fmt.Fprintf(output, "\nFiles added: %d, removed: %d, changed: %d\n", counts[skiff.FileAdded], counts[skiff.FileRemoved], counts[skiff.FileChanged])
+	fmt.Fprintf(output, "Size difference: %s%s\n", sign, formatTotalSize(sizeDelta, humanReadable))
+	return nil
+}
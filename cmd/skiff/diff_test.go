@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+)
+
+func TestDiffLayers(t *testing.T) {
+	base := digest.Digest("sha256:base")
+	old := digest.Digest("sha256:old")
+	new := digest.Digest("sha256:new")
+
+	changes := diffLayers([]digest.Digest{base, old}, []digest.Digest{base, new})
+
+	expected := []LayerChange{
+		{DiffID: base, Status: "shared"},
+		{DiffID: new, Status: "added"},
+		{DiffID: old, Status: "removed"},
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected %d layer changes, got %d: %+v", len(expected), len(changes), changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Errorf("Expected layer change %d to be %+v, got %+v", i, expected[i], changes[i])
+		}
+	}
+}
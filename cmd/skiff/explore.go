@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/urfave/cli/v3"
+	"go.podman.io/image/v5/types"
+	"golang.org/x/term"
+
+	skiff "github.com/dcermak/skiff/pkg"
+)
+
+var exploreCommand = cli.Command{
+	Name:  "explore",
+	Usage: "Interactively browse the layers and the filesystem of an image",
+	Flags: []cli.Flag{
+		&jobsFlag,
+	},
+	Arguments: []cli.Argument{
+		&cli.StringArg{Name: "image", UsageText: "Container image ref"},
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		image := c.StringArg("image")
+		if image == "" {
+			return fmt.Errorf("image URL is required")
+		}
+		if err := requireTableFormat(c); err != nil {
+			return err
+		}
+		if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+			return fmt.Errorf("the explore command requires an interactive terminal")
+		}
+
+		sysCtx, err := newSystemContext(c)
+		if err != nil {
+			return err
+		}
+		e, err := loadExplorer(ctx, sysCtx, image, c.Int("jobs"))
+		if err != nil {
+			return err
+		}
+		return runExplorer(e, os.Stdin, os.Stdout)
+	},
+}
+
+// loadExplorer reads the entries of all layers of the image at uri into
+// memory, up to jobs layers concurrently. Every layer is only read once, the
+// sizes of the layers are the sums of the sizes of their entries.
+func loadExplorer(ctx context.Context, sysCtx *types.SystemContext, uri string, jobs int) (*explorer, error) {
+	imgLayers, err := skiff.OpenImageLayers(ctx, sysCtx, uri)
+	if err != nil {
+		return nil, err
+	}
+	defer imgLayers.Close()
+
+	if len(imgLayers.Blobs) == 0 {
+		return nil, fmt.Errorf("image %s has no layers", uri)
+	}
+
+	entries, err := imgLayers.ReadEntries(ctx, nil, jobs, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var createdBy []string
+	conf, err := imgLayers.Image.OCIConfig(ctx)
+	if err != nil {
+		conf = nil
+	}
+	for _, h := range skiff.LayerHistory(conf, len(imgLayers.Blobs)) {
+		createdBy = append(createdBy, h.CreatedBy)
+	}
+
+	return newExplorer(createdBy, imgLayers.DiffIDs, entries), nil
+}
+
+// readKeys sends the key presses read from r to keys. Escape sequences of
+// special keys are sent as a single string.
+func readKeys(r io.Reader, keys chan<- string) {
+	defer close(keys)
+
+	br := bufio.NewReader(r)
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return
+		}
+		key := string(b)
+		if b == '\x1b' && br.Buffered() > 0 {
+			// CSI sequences end with a byte in the range 0x40–0x7e
+			seq := []byte{b}
+			for br.Buffered() > 0 {
+				c, _ := br.ReadByte()
+				seq = append(seq, c)
+				if len(seq) > 2 && c >= 0x40 && c <= 0x7e {
+					break
+				}
+			}
+			key = string(seq)
+		}
+		keys <- key
+	}
+}
+
+// runExplorer runs the interactive explorer on the terminal until the user
+// quits it
+func runExplorer(e *explorer, in *os.File, out *os.File) error {
+	oldState, err := term.MakeRaw(int(in.Fd()))
+	if err != nil {
+		return err
+	}
+	defer term.Restore(int(in.Fd()), oldState)
+
+	// switch to the alternate screen and hide the cursor
+	fmt.Fprint(out, "\x1b[?1049h\x1b[?25l")
+	defer fmt.Fprint(out, "\x1b[?25h\x1b[?1049l")
+
+	keys := make(chan string)
+	go readKeys(in, keys)
+
+	resize := make(chan os.Signal, 1)
+	signal.Notify(resize, syscall.SIGWINCH)
+	defer signal.Stop(resize)
+
+	for {
+		width, height, err := term.GetSize(int(out.Fd()))
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(out, "\x1b[H\x1b[2J"+strings.Join(e.render(width, height), "\r\n"))
+
+		select {
+		case <-resize:
+		case key, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			switch key {
+			case "q", "\x03":
+				return nil
+			case "\t":
+				e.treeFocused = !e.treeFocused
+			case "\x1b[A", "k":
+				e.move(-1)
+			case "\x1b[B", "j":
+				e.move(1)
+			case "\x1b[5~":
+				e.move(-(height - 2))
+			case "\x1b[6~":
+				e.move(height - 2)
+			case "\x1b[C", "l":
+				e.setExpanded(true)
+			case "\x1b[D", "h":
+				e.setExpanded(false)
+			case "\r", " ":
+				e.toggle()
+			case "c":
+				e.toggleChangesOnly()
+			}
+		}
+	}
+}
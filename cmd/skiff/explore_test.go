@@ -0,0 +1,139 @@
+package main
+
+import (
+	"archive/tar"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+
+	skiff "github.com/dcermak/skiff/pkg"
+)
+
+func newTestExplorer() *explorer {
+	diffIDs := []digest.Digest{"sha256:lower", "sha256:upper"}
+	entries := [][]skiff.FileEntry{
+		{
+			{Path: "/etc", Typeflag: tar.TypeDir},
+			{Path: "/etc/config", Typeflag: tar.TypeReg, Size: 10},
+			{Path: "/etc/unchanged", Typeflag: tar.TypeReg, Size: 5},
+			{Path: "/var/cache/zypp/repo", Typeflag: tar.TypeReg, Size: 100},
+		},
+		{
+			{Path: "/etc/config", Typeflag: tar.TypeReg, Size: 20},
+			{Path: "/etc/new", Typeflag: tar.TypeReg, Size: 30},
+			{Path: "/var/.wh.cache", Typeflag: tar.TypeReg},
+		},
+	}
+	return newExplorer([]string{"ADD base", "RUN update"}, diffIDs, entries)
+}
+
+func findViewNode(t *testing.T, root *viewNode, names ...string) *viewNode {
+	t.Helper()
+	n := root
+	for _, name := range names {
+		var next *viewNode
+		for _, c := range n.children {
+			if c.name == name {
+				next = c
+			}
+		}
+		if next == nil {
+			t.Fatalf("%v not found in the tree", names)
+		}
+		n = next
+	}
+	return n
+}
+
+func TestExplorerSelectLayer(t *testing.T) {
+	e := newTestExplorer()
+
+	if n := findViewNode(t, e.root, "etc", "config"); n.status != added {
+		t.Errorf("Expected /etc/config to be added by the bottom layer, got %d", n.status)
+	}
+
+	e.move(1)
+	if e.selectedLayer != 1 {
+		t.Fatalf("Expected layer 1 to be selected, got %d", e.selectedLayer)
+	}
+
+	tests := []struct {
+		path   []string
+		status changeStatus
+	}{
+		{[]string{"etc", "config"}, modified},
+		{[]string{"etc", "new"}, added},
+		{[]string{"etc", "unchanged"}, unchanged},
+		{[]string{"var", "cache"}, removed},
+		{[]string{"var", "cache", "zypp", "repo"}, removed},
+	}
+	for _, tt := range tests {
+		if n := findViewNode(t, e.root, tt.path...); n.status != tt.status {
+			t.Errorf("Expected %v to have status %d, got %d", tt.path, tt.status, n.status)
+		}
+	}
+
+	if etc := findViewNode(t, e.root, "etc"); etc.size != 55 || !etc.changed {
+		t.Errorf("Expected /etc to be changed and have a size of 55, got %t and %d", etc.changed, etc.size)
+	}
+}
+
+func TestExplorerSelectLayerCached(t *testing.T) {
+	e := newTestExplorer()
+	lower := e.root
+
+	e.selectLayer(1)
+	upper := e.root
+	if e.fsLayer != 1 {
+		t.Fatalf("Expected the filesystem to contain layer 1, got %d", e.fsLayer)
+	}
+
+	// both trees are kept, going back and forth does not merge the layers
+	// again
+	e.fs = nil
+	e.selectLayer(0)
+	if e.root != lower {
+		t.Errorf("Expected the tree of layer 0 to be reused")
+	}
+	if n := findViewNode(t, e.root, "etc", "config"); n.status != added {
+		t.Errorf("Expected /etc/config to be added by the bottom layer, got %d", n.status)
+	}
+	e.selectLayer(1)
+	if e.root != upper {
+		t.Errorf("Expected the tree of layer 1 to be reused")
+	}
+	if e.fs != nil {
+		t.Errorf("Expected no layer to be applied again")
+	}
+}
+
+func TestExplorerRows(t *testing.T) {
+	e := newTestExplorer()
+	e.treeFocused = true
+
+	if rows := e.rows(); len(rows) != 2 {
+		t.Fatalf("Expected only /etc and /var to be visible, got %d rows", len(rows))
+	}
+
+	// expand /etc
+	e.toggle()
+	rows := e.rows()
+	if len(rows) != 4 || rows[1].node.name != "config" || rows[1].depth != 1 {
+		t.Fatalf("Expected the contents of /etc to be visible, got %d rows", len(rows))
+	}
+
+	// collapsing a file moves the cursor to its directory
+	e.move(2)
+	e.setExpanded(false)
+	if e.cursor != 0 {
+		t.Errorf("Expected the cursor to move to /etc, got %d", e.cursor)
+	}
+
+	e.selectLayer(1)
+	e.toggleChangesOnly()
+	for _, r := range e.rows() {
+		if r.node.name == "unchanged" {
+			t.Errorf("Expected unchanged files to be hidden")
+		}
+	}
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"archive/tar"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/opencontainers/go-digest"
+
+	skiff "github.com/dcermak/skiff/pkg"
+)
+
+// changeStatus describes how a file was changed by the selected layer
+type changeStatus int
+
+const (
+	unchanged changeStatus = iota
+	added
+	modified
+	removed
+)
+
+// ANSI escape sequences used by the explorer
+const (
+	ansiReset   = "\x1b[0m"
+	ansiBold    = "\x1b[1m"
+	ansiReverse = "\x1b[7m"
+	ansiRed     = "\x1b[31m"
+	ansiGreen   = "\x1b[32m"
+	ansiYellow  = "\x1b[33m"
+)
+
+var statusColors = map[changeStatus]string{
+	added:    ansiGreen,
+	modified: ansiYellow,
+	removed:  ansiRed,
+}
+
+// viewNode is an entry in the filesystem tree shown by the explorer
+type viewNode struct {
+	name  string
+	entry skiff.FileEntry
+	// size is the size of the file or the accumulated size of all files
+	// below a directory
+	size   int64
+	status changeStatus
+	// changed is true if the node or any node below it was changed by the
+	// selected layer
+	changed  bool
+	children []*viewNode
+}
+
+func (n *viewNode) isDir() bool {
+	return n.entry.IsDir()
+}
+
+// child returns the child with the given name, creating a directory if it
+// does not exist yet
+func (n *viewNode) child(name string) (c *viewNode, created bool) {
+	for _, c := range n.children {
+		if c.name == name {
+			return c, false
+		}
+	}
+	c = &viewNode{
+		name:  name,
+		entry: skiff.FileEntry{Path: path.Join(n.entry.Path, name), Typeflag: tar.TypeDir},
+	}
+	n.children = append(n.children, c)
+	return c, true
+}
+
+// treeRow is a visible line of the filesystem tree
+type treeRow struct {
+	node  *viewNode
+	depth int
+}
+
+// explorer holds the state of the interactive image explorer
+type explorer struct {
+	// createdBy contains the build instruction of every layer, it is nil
+	// if the history of the image cannot be mapped onto its layers
+	createdBy []string
+	diffIDs   []digest.Digest
+	// entries contains the entries of every layer archive
+	entries [][]skiff.FileEntry
+	// layerSizes contains the accumulated size of all files in every layer
+	layerSizes []int64
+
+	// fs is the filesystem after applying the layers up to fsLayer, later
+	// layers are applied on top of it when they are selected
+	fs      *skiff.Filesystem
+	fsLayer int
+	// trees contains the filesystem tree of every layer that has been
+	// selected
+	trees map[int]*viewNode
+
+	selectedLayer int
+	layerOffset   int
+
+	// treeFocused is true if the keyboard controls the filesystem tree
+	// instead of the layer list
+	treeFocused bool
+	root        *viewNode
+	expanded    map[string]bool
+	changesOnly bool
+	cursor      int
+	treeOffset  int
+}
+
+func newExplorer(createdBy []string, diffIDs []digest.Digest, entries [][]skiff.FileEntry) *explorer {
+	e := &explorer{
+		createdBy:  createdBy,
+		diffIDs:    diffIDs,
+		entries:    entries,
+		layerSizes: make([]int64, len(entries)),
+		trees:      map[int]*viewNode{},
+		expanded:   map[string]bool{},
+	}
+	for i, layer := range entries {
+		for _, entry := range layer {
+			e.layerSizes[i] += entry.Size
+		}
+	}
+	e.selectLayer(0)
+	return e
+}
+
+// selectLayer shows the filesystem tree as it looks after applying the layers
+// up to (and including) the layer with the given index and marks the files
+// that this layer added, modified or removed.
+//
+// The tree of every layer is only built once. Selecting a later layer than
+// the previously built one only applies the layers in between, only selecting
+// an earlier layer that has not been shown yet merges the layers again.
+func (e *explorer) selectLayer(layer int) {
+	if layer < 0 || layer >= len(e.entries) {
+		return
+	}
+	e.selectedLayer = layer
+	if root, ok := e.trees[layer]; ok {
+		e.root = root
+		e.clampCursor()
+		return
+	}
+
+	if e.fs == nil || e.fsLayer > layer {
+		e.fs = skiff.NewFilesystem()
+		e.fsLayer = -1
+	}
+	for e.fsLayer < layer {
+		e.fsLayer++
+		e.fs.ApplyLayer(e.diffIDs[e.fsLayer], e.entries[e.fsLayer])
+	}
+
+	overwritten := map[string]bool{}
+	var deleted []skiff.ShadowedFile
+	for _, s := range e.fs.Shadowed() {
+		if s.ShadowedByLayer != layer {
+			continue
+		}
+		if s.Deleted {
+			deleted = append(deleted, s)
+		} else {
+			overwritten[s.Path] = true
+		}
+	}
+
+	e.root = newViewTree(e.fs.Root(), layer, overwritten)
+	for _, s := range deleted {
+		// deleted files are not part of the filesystem anymore, re-add
+		// them (and their deleted parent directories) to show them
+		n := e.root
+		for _, name := range strings.Split(strings.Trim(s.Path, "/"), "/") {
+			c, created := n.child(name)
+			if created {
+				c.status = removed
+			}
+			n = c
+		}
+		n.entry = s.FileEntry
+		n.size = s.Size
+		n.status = removed
+	}
+	markChanged(e.root)
+	e.trees[layer] = e.root
+
+	e.clampCursor()
+}
+
+func newViewTree(n *skiff.Node, layer int, overwritten map[string]bool) *viewNode {
+	v := &viewNode{name: n.Name, entry: n.Entry, size: n.Entry.Size}
+	if !n.Entry.IsDir() && n.Layer == layer {
+		v.status = added
+		if overwritten[n.Entry.Path] {
+			v.status = modified
+		}
+	}
+	for _, c := range n.Children() {
+		child := newViewTree(c, layer, overwritten)
+		v.size += child.size
+		v.children = append(v.children, child)
+	}
+	return v
+}
+
+// markChanged sorts the children of n and propagates the change status of
+// all nodes to their parents
+func markChanged(n *viewNode) bool {
+	slices.SortFunc(n.children, func(a, b *viewNode) int { return strings.Compare(a.name, b.name) })
+	n.changed = n.status != unchanged
+	for _, c := range n.children {
+		if markChanged(c) {
+			n.changed = true
+		}
+	}
+	return n.changed
+}
+
+// rows returns the currently visible lines of the filesystem tree
+func (e *explorer) rows() []treeRow {
+	var rows []treeRow
+	var visit func(n *viewNode, depth int)
+	visit = func(n *viewNode, depth int) {
+		for _, c := range n.children {
+			if e.changesOnly && !c.changed {
+				continue
+			}
+			rows = append(rows, treeRow{node: c, depth: depth})
+			if c.isDir() && e.expanded[c.entry.Path] {
+				visit(c, depth+1)
+			}
+		}
+	}
+	visit(e.root, 0)
+	return rows
+}
+
+func (e *explorer) clampCursor() {
+	e.cursor = min(e.cursor, len(e.rows())-1)
+	e.cursor = max(e.cursor, 0)
+}
+
+// move moves the cursor of the focused pane by delta lines
+func (e *explorer) move(delta int) {
+	if e.treeFocused {
+		e.cursor += delta
+		e.clampCursor()
+		return
+	}
+	e.selectLayer(min(max(e.selectedLayer+delta, 0), len(e.entries)-1))
+}
+
+// toggle expands or collapses the directory under the cursor
+func (e *explorer) toggle() {
+	rows := e.rows()
+	if !e.treeFocused || e.cursor >= len(rows) {
+		return
+	}
+	if n := rows[e.cursor].node; n.isDir() {
+		e.expanded[n.entry.Path] = !e.expanded[n.entry.Path]
+	}
+}
+
+// setExpanded expands or collapses the directory under the cursor. Collapsing
+// a file or a collapsed directory moves the cursor to its parent directory.
+func (e *explorer) setExpanded(expand bool) {
+	rows := e.rows()
+	if !e.treeFocused || e.cursor >= len(rows) {
+		return
+	}
+	row := rows[e.cursor]
+	if row.node.isDir() && e.expanded[row.node.entry.Path] != expand {
+		e.expanded[row.node.entry.Path] = expand
+		return
+	}
+	if !expand {
+		for i := e.cursor - 1; i >= 0; i-- {
+			if rows[i].depth < row.depth {
+				e.cursor = i
+				return
+			}
+		}
+	}
+}
+
+func (e *explorer) toggleChangesOnly() {
+	e.changesOnly = !e.changesOnly
+	e.clampCursor()
+}
+
+// scroll returns the new offset of a list so that the line at cursor is
+// visible in a window of the given height
+func scroll(offset, cursor, height int) int {
+	if cursor < offset {
+		return cursor
+	}
+	if height > 0 && cursor >= offset+height {
+		return cursor - height + 1
+	}
+	return offset
+}
+
+// fit truncates or pads s to exactly width runes
+func fit(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	if n := utf8.RuneCountInString(s); n <= width {
+		return s + strings.Repeat(" ", width-n)
+	}
+	r := []rune(s)
+	return string(r[:width-1]) + "…"
+}
+
+func (e *explorer) layerLine(i int, width int) string {
+	createdBy := ""
+	if i < len(e.createdBy) {
+		createdBy = e.createdBy[i]
+	}
+	size := skiff.HumanReadableSize(e.layerSizes[i])
+	return fit(fmt.Sprintf("%3d  %s  %9s  %s", i, skiff.FormatDigest(e.diffIDs[i], false), size, createdBy), width)
+}
+
+func (e *explorer) treeLine(row treeRow, width int) string {
+	n := row.node
+	marker := "  "
+	if n.isDir() {
+		marker = "▸ "
+		if e.expanded[n.entry.Path] {
+			marker = "▾ "
+		}
+	}
+	name := n.name
+	if n.entry.Linkname != "" {
+		name += " → " + n.entry.Linkname
+	}
+
+	size := skiff.HumanReadableSize(n.size)
+	nameWidth := width - len(size) - 1
+	return fit(strings.Repeat("  ", row.depth)+marker+name, nameWidth) + " " + size
+}
+
+// render returns the lines of the whole screen with the given dimensions
+func (e *explorer) render(width, height int) []string {
+	leftWidth := max(min(width*2/5, 80), 20)
+	rightWidth := max(width-leftWidth-3, 10)
+	bodyHeight := max(height-2, 1)
+
+	title := func(s string, focused bool, width int) string {
+		if focused {
+			return ansiBold + fit(s, width) + ansiReset
+		}
+		return fit(s, width)
+	}
+
+	diffID := ""
+	if len(e.diffIDs) > 0 {
+		diffID = skiff.FormatDigest(e.diffIDs[e.selectedLayer], false)
+	}
+	lines := []string{
+		title(" Layers", !e.treeFocused, leftWidth) + " │ " +
+			title(fmt.Sprintf("Filesystem at layer %d (%s)", e.selectedLayer, diffID), e.treeFocused, rightWidth),
+	}
+
+	e.layerOffset = scroll(e.layerOffset, e.selectedLayer, bodyHeight)
+	rows := e.rows()
+	e.treeOffset = scroll(e.treeOffset, e.cursor, bodyHeight)
+
+	for i := range bodyHeight {
+		left := fit("", leftWidth)
+		if l := e.layerOffset + i; l < len(e.entries) {
+			left = e.layerLine(l, leftWidth)
+			if l == e.selectedLayer {
+				left = ansiReverse + left + ansiReset
+			}
+		}
+
+		right := ""
+		if r := e.treeOffset + i; r < len(rows) {
+			right = e.treeLine(rows[r], rightWidth)
+			if color, ok := statusColors[rows[r].node.status]; ok {
+				right = color + right + ansiReset
+			}
+			if e.treeFocused && r == e.cursor {
+				right = ansiReverse + right + ansiReset
+			}
+		}
+		lines = append(lines, left+" │ "+right)
+	}
+
+	help := "↑/↓ move  tab switch pane  enter expand/collapse  c changes only  q quit"
+	legend := "   added modified removed"
+	if utf8.RuneCountInString(help+legend) > width {
+		return append(lines, fit(help, width))
+	}
+	return append(lines, help+"   "+ansiGreen+"added"+ansiReset+" "+ansiYellow+"modified"+ansiReset+" "+ansiRed+"removed"+ansiReset)
+}
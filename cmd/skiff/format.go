@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+	"go.podman.io/common/pkg/report"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatYAML  = "yaml"
+	formatCSV   = "csv"
+)
+
+var formatFlag = cli.StringFlag{
+	Name:  "format",
+	Usage: "Output format: table, json, yaml, csv or a Go template (e.g. 'table {{.DiffID}}\t{{.CreatedBy}}')",
+	Value: formatTable,
+	Validator: func(format string) error {
+		switch {
+		case format == formatTable, format == formatJSON, format == formatYAML, format == formatCSV:
+			return nil
+		case isTemplate(format):
+			return nil
+		}
+		return fmt.Errorf("invalid output format %q, must be one of table, json, yaml, csv or a Go template", format)
+	},
+}
+
+// isTemplate returns true if format is a Go template instead of a fixed
+// output format.
+func isTemplate(format string) bool {
+	return strings.Contains(format, "{{")
+}
+
+// requireTableFormat returns an error if an output format other than the
+// table has been requested for a command that only supports tables.
+func requireTableFormat(c *cli.Command) error {
+	if format := c.String(formatFlag.Name); format != formatTable {
+		return fmt.Errorf("the %s command does not support the output format %s", c.Name, format)
+	}
+	return nil
+}
+
+// writeReport encodes rows, which must be a slice of structs, in the given
+// machine-readable format or renders them with the given Go template. JSON and
+// YAML also accept any other value.
+func writeReport(w io.Writer, format string, rows any) error {
+	if isTemplate(format) {
+		return writeTemplate(w, format, rows)
+	}
+
+	switch format {
+	case formatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rows)
+	case formatYAML:
+		enc := yaml.NewEncoder(w)
+		defer enc.Close()
+		return enc.Encode(rows)
+	case formatCSV:
+		return writeCSV(w, rows)
+	}
+	return fmt.Errorf("unsupported output format %q", format)
+}
+
+// writeCSV writes a slice of structs as CSV with a header row. The column
+// names are taken from the json tags of the struct fields.
+func writeCSV(w io.Writer, rows any) error {
+	v := reflect.ValueOf(rows)
+	if v.Kind() != reflect.Slice || v.Type().Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("internal error: cannot encode %T as csv", rows)
+	}
+
+	t := v.Type().Elem()
+	header := make([]string, t.NumField())
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "" {
+			name = t.Field(i).Name
+		}
+		header[i] = name
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for i := range v.Len() {
+		record := make([]string, t.NumField())
+		for j := range t.NumField() {
+			record[j] = csvValue(v.Index(i).Field(j).Interface())
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvValue formats a single field for writeCSV
+func csvValue(field any) string {
+	switch v := field.(type) {
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		return v.Format(time.RFC3339)
+	case []string:
+		return strings.Join(v, " ")
+	}
+	return fmt.Sprint(field)
+}
+
+// writeTemplate renders rows, which must be a slice of structs, with the Go
+// template format. Like in podman, templates starting with the `table` keyword
+// are rendered as a table with a header row.
+func writeTemplate(w io.Writer, format string, rows any) error {
+	v := reflect.ValueOf(rows)
+	if v.Kind() != reflect.Slice || v.Type().Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("internal error: cannot render %T with a template", rows)
+	}
+
+	rpt, err := report.New(w, "skiff").Parse(report.OriginUser, format)
+	if err != nil {
+		return fmt.Errorf("invalid template %q: %w", format, err)
+	}
+	defer rpt.Flush()
+
+	if rpt.RenderHeaders {
+		headers := report.Headers(reflect.New(v.Type().Elem()).Interface(), nil)
+		if err := rpt.Execute(headers); err != nil {
+			return err
+		}
+	}
+	return rpt.Execute(rows)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	skiff "github.com/dcermak/skiff/pkg"
+)
+
+func TestWriteReport(t *testing.T) {
+	reports := []skiff.FileReport{
+		{Path: "/usr/bin/zypper", Size: 2915456, DiffID: "sha256:4672d0cba723"},
+		{Path: "/etc/a,b", Size: 1, DiffID: "sha256:88304527ded0"},
+	}
+
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{formatCSV, `path,size,diffID,hardLinks,package
+/usr/bin/zypper,2915456,sha256:4672d0cba723,,
+"/etc/a,b",1,sha256:88304527ded0,,
+`},
+		{formatJSON, `[
+  {
+    "path": "/usr/bin/zypper",
+    "size": 2915456,
+    "diffID": "sha256:4672d0cba723"
+  },
+  {
+    "path": "/etc/a,b",
+    "size": 1,
+    "diffID": "sha256:88304527ded0"
+  }
+]
+`},
+		{formatYAML, `- path: /usr/bin/zypper
+  size: 2915456
+  diffID: sha256:4672d0cba723
+- path: /etc/a,b
+  size: 1
+  diffID: sha256:88304527ded0
+`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeReport(&buf, tt.format, reports); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tt.expected, buf.String())
+			}
+		})
+	}
+}
+
+func TestWriteReportCSVTime(t *testing.T) {
+	reports := []skiff.LayerReport{
+		{DiffID: "sha256:4672d0cba723", CreatedBy: "KIWI 10.1.16", Created: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)},
+		{CreatedBy: "ENV FOO=bar", EmptyLayer: true},
+	}
+
+	var buf bytes.Buffer
+	if err := writeReport(&buf, formatCSV, reports); err != nil {
+		t.Fatalf("writeReport failed: %v", err)
+	}
+	expected := `diffID,digest,compressedSize,uncompressedSize,compressionRatio,mediaType,createdBy,created,comment,emptyLayer,platform
+sha256:4672d0cba723,,0,0,0,,KIWI 10.1.16,2024-05-01T12:00:00Z,,false,
+,,0,0,0,,ENV FOO=bar,,,true,
+`
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+func TestWriteReportUnsupportedFormat(t *testing.T) {
+	err := writeReport(&bytes.Buffer{}, "xml", []skiff.FileReport{})
+	if err == nil || !strings.Contains(err.Error(), "unsupported output format") {
+		t.Errorf("Expected an unsupported output format error, got %v", err)
+	}
+}
+
+func TestWriteReportTemplate(t *testing.T) {
+	reports := []skiff.LayerReport{
+		{DiffID: "sha256:4672d0cba723", CompressedSize: 47480531, CreatedBy: "KIWI 10.1.16"},
+		{DiffID: "sha256:88304527ded0", CompressedSize: 46534194, CreatedBy: "RUN zypper in python311"},
+	}
+
+	tests := []struct {
+		name     string
+		format   string
+		expected string
+	}{
+		{"plain template", "{{.DiffID}} {{.CompressedSize}}", `sha256:4672d0cba723 47480531
+sha256:88304527ded0 46534194
+`},
+		{"table template", "table {{.CreatedBy}}\t{{.DiffID}}", `CREATED BY               DIFF ID
+KIWI 10.1.16             sha256:4672d0cba723
+RUN zypper in python311  sha256:88304527ded0
+`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeReport(&buf, tt.format, reports); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tt.expected, buf.String())
+			}
+		})
+	}
+}
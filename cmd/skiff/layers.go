@@ -1,10 +1,15 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"io"
+	"slices"
+	"strconv"
+	"strings"
 	"text/tabwriter"
+	"time"
 
 	"github.com/opencontainers/go-digest"
 	"github.com/urfave/cli/v3"
@@ -13,60 +18,368 @@ import (
 	skiff "github.com/dcermak/skiff/pkg"
 )
 
-func ShowLayerUsage(ctx context.Context, sysCtx *types.SystemContext, uri string, output io.Writer, fullDigest bool) error {
+// layerReports collects the layers of the image at uri. If emptyLayers is
+// set, the build steps of the image history that did not create a layer are
+// included as well.
+//
+// Images in the local container storage know the compressed and uncompressed
+// sizes of their layers. For images from other transports only the compressed
+// size is known, unless a layer is stored uncompressed (e.g. in a
+// docker-archive). The uncompressed size of the remaining layers is
+// determined by decompressing them. Images from local transports (oci:,
+// oci-archive:, docker-archive: and dir:) are always decompressed, images from
+// registries only if download is set.
+func layerReports(ctx context.Context, sysCtx *types.SystemContext, uri string, emptyLayers bool, download bool) ([]skiff.LayerReport, error) {
 	img, layers, err := skiff.ImageAndLayersFromURI(ctx, sysCtx, uri)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer img.Close()
 
 	inspect, err := img.Inspect(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	w := tabwriter.NewWriter(output, 0, 8, 2, ' ', 0)
-	defer w.Flush()
+	// in theory, the OCI Config contains the 'rootfs.diffids' array
+	// with the diffIDs i.e. the uncompressed digests
+	// => use that if available otherwise we fall back to compressed digests
+	conf, err := img.OCIConfig(ctx)
+	if err != nil {
+		conf = nil
+	}
+	history := skiff.LayerHistory(conf, len(inspect.LayersData))
+
+	reports := make([]skiff.LayerReport, 0, len(inspect.LayersData))
+	for _, l := range inspect.LayersData {
+		reports = append(reports, skiff.LayerReport{
+			Digest:           l.Digest,
+			CompressedSize:   l.Size,
+			UncompressedSize: -1,
+			MediaType:        l.MIMEType,
+		})
+	}
+	for i, h := range history {
+		reports[i].CreatedBy = h.CreatedBy
+		reports[i].Comment = h.Comment
+		if h.Created != nil {
+			reports[i].Created = *h.Created
+		}
+	}
 
 	if len(layers) > 0 {
 		if len(inspect.LayersData) != len(layers) {
-			return fmt.Errorf(
+			return nil, fmt.Errorf(
 				"internal error: image inspect returned %d layers, storage returned %d layers",
 				len(inspect.LayersData),
 				len(layers),
 			)
 		}
-		fmt.Fprintln(w, "Diff ID\tUncompressed Size")
-		for _, l := range layers {
-			fmt.Fprintf(w, "%s\t%d\n", skiff.FormatDigest(l.UncompressedDigest, fullDigest), l.UncompressedSize)
+		for i, l := range layers {
+			reports[i].DiffID = l.UncompressedDigest
+			reports[i].UncompressedSize = l.UncompressedSize
+			// layers that were built locally have never been
+			// compressed, the storage either records no compressed
+			// digest or the digest of the layer archive
+			reports[i].CompressedSize = -1
+			if l.CompressedDigest != "" && l.CompressedDigest != l.UncompressedDigest {
+				reports[i].CompressedSize = l.CompressedSize
+			}
 		}
 
 	} else {
-		// in theory, the OCI Config contains the 'rootfs.diffids' array
-		// with the diffIDs i.e. the uncompressed digests
-		// => use that if available otherwise we fall back to compressed digests
-		conf, err := img.OCIConfig(ctx)
-		diffIDs := []digest.Digest{}
-
-		// only get them if the rootfs type is correct
-		if err == nil && conf != nil && conf.RootFS.Type == "layers" {
-			diffIDs = conf.RootFS.DiffIDs
+		if conf != nil && conf.RootFS.Type == "layers" && len(conf.RootFS.DiffIDs) == len(reports) {
+			// only use the diffIDs if the rootfs type is correct
+			for i, diffID := range conf.RootFS.DiffIDs {
+				reports[i].DiffID = diffID
+			}
 		}
-
-		if len(diffIDs) == len(inspect.LayersData) {
-			fmt.Fprintln(w, "Diff ID\tCompressed Size")
-			for i, l := range inspect.LayersData {
-				fmt.Fprintf(w, "%s\t%d\n", skiff.FormatDigest(conf.RootFS.DiffIDs[i], fullDigest), l.Size)
+		for i := range reports {
+			// the blob of an uncompressed layer is the layer archive
+			if reports[i].DiffID != "" && reports[i].DiffID == reports[i].Digest {
+				reports[i].UncompressedSize = reports[i].CompressedSize
 			}
-		} else {
-			fmt.Fprintln(w, "Compressed Digest\tCompressed Size")
-			for _, l := range inspect.LayersData {
-				fmt.Fprintf(w, "%s\t%d\n", skiff.FormatDigest(l.Digest, fullDigest), l.Size)
+		}
+		if download || skiff.IsLocalTransport(img.Reference()) {
+			if err := downloadUncompressedSizes(ctx, sysCtx, img, reports); err != nil {
+				return nil, err
 			}
 		}
 	}
+
+	for i := range reports {
+		reports[i].CompressionRatio = skiff.CompressionRatio(reports[i].CompressedSize, reports[i].UncompressedSize)
+	}
+
+	if emptyLayers {
+		reports = skiff.InsertEmptyLayers(reports, conf)
+	}
+	return reports, nil
+}
+
+// downloadUncompressedSizes determines the uncompressed size of every layer
+// of img with an unknown uncompressed size by stream-decompressing its blob.
+func downloadUncompressedSizes(ctx context.Context, sysCtx *types.SystemContext, img types.Image, reports []skiff.LayerReport) error {
+	blobs, err := skiff.BlobInfoFromImage(ctx, sysCtx, img)
+	if err != nil {
+		return fmt.Errorf("failed to get blob info from image: %w", err)
+	}
+	if len(blobs) != len(reports) {
+		return fmt.Errorf("internal error: image inspect returned %d layers, manifest contains %d layers", len(reports), len(blobs))
+	}
+
+	imgSrc, err := img.Reference().NewImageSource(ctx, sysCtx)
+	if err != nil {
+		return err
+	}
+	defer imgSrc.Close()
+
+	for i, blob := range blobs {
+		if reports[i].UncompressedSize >= 0 {
+			continue
+		}
+		size, err := skiff.UncompressedLayerSize(ctx, imgSrc, blob)
+		if err != nil {
+			return err
+		}
+		reports[i].UncompressedSize = size
+	}
 	return nil
 }
 
+// maxCreatedByLength is the number of characters after which build
+// instructions are truncated in the table output
+const maxCreatedByLength = 45
+
+// layersOptions configures the output of ShowLayerUsage
+type layersOptions struct {
+	fullDigest bool
+	format     string
+	// emptyLayers includes build steps that did not create a layer
+	emptyLayers bool
+	// noTrunc disables the truncation of build instructions
+	noTrunc bool
+	// noDownload skips downloading the layers to determine their
+	// uncompressed size
+	noDownload bool
+	// allPlatforms lists the layers of every platform of a multi-arch image
+	allPlatforms bool
+	// progress shows the progress of downloading the layers, it is nil if
+	// progress bars are disabled
+	progress *layerProgress
+}
+
+// formatLayerSize returns the size in bytes or "-" if it is unknown
+func formatLayerSize(size int64) string {
+	if size < 0 {
+		return "-"
+	}
+	return strconv.FormatInt(size, 10)
+}
+
+// formatRatio returns the compression ratio or "-" if it is unknown
+func formatRatio(ratio float64) string {
+	if ratio < 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f", ratio)
+}
+
+// historyColumns returns the creation time, build instruction and comment of
+// a layer for the table output
+func historyColumns(l skiff.LayerReport, noTrunc bool) string {
+	created := ""
+	if !l.Created.IsZero() {
+		created = l.Created.UTC().Format(time.DateTime)
+	}
+
+	// build instructions can span multiple lines, which would break the table
+	createdBy := strings.Join(strings.Fields(l.CreatedBy), " ")
+	if r := []rune(createdBy); !noTrunc && len(r) > maxCreatedByLength {
+		createdBy = string(r[:maxCreatedByLength-1]) + "…"
+	}
+	return fmt.Sprintf("%s\t%s\t%s", created, createdBy, strings.Join(strings.Fields(l.Comment), " "))
+}
+
+func ShowLayerUsage(ctx context.Context, sysCtx *types.SystemContext, uri string, output io.Writer, opts layersOptions) error {
+	if opts.allPlatforms {
+		return showAllPlatformsLayerUsage(ctx, sysCtx, uri, output, opts)
+	}
+
+	reports, err := layerReports(ctx, sysCtx, uri, opts.emptyLayers, !opts.noDownload)
+	if err != nil {
+		return err
+	}
+	opts.progress.Wait()
+
+	if opts.format != formatTable {
+		return writeReport(output, opts.format, reports)
+	}
+	return writeLayerTable(output, reports, opts)
+}
+
+// showAllPlatformsLayerUsage prints the layers of every platform of a
+// multi-arch image followed by the total size of each platform and the layers
+// that are shared between platforms.
+func showAllPlatformsLayerUsage(ctx context.Context, sysCtx *types.SystemContext, uri string, output io.Writer, opts layersOptions) error {
+	platforms, err := skiff.ImagePlatforms(ctx, sysCtx, uri)
+	if err != nil {
+		return err
+	}
+
+	var all []skiff.LayerReport
+	for _, p := range platforms {
+		reports, err := layerReports(ctx, skiff.WithPlatform(sysCtx, p), uri, opts.emptyLayers, !opts.noDownload)
+		if err != nil {
+			return fmt.Errorf("platform %s: %w", skiff.FormatPlatform(p), err)
+		}
+		for i := range reports {
+			reports[i].Platform = skiff.FormatPlatform(p)
+		}
+		all = append(all, reports...)
+	}
+	opts.progress.Wait()
+
+	if opts.format != formatTable {
+		return writeReport(output, opts.format, all)
+	}
+
+	for _, p := range platforms {
+		platform := skiff.FormatPlatform(p)
+		fmt.Fprintf(output, "Platform: %s\n", platform)
+		reports := slices.DeleteFunc(slices.Clone(all), func(l skiff.LayerReport) bool { return l.Platform != platform })
+		if err := writeLayerTable(output, reports, opts); err != nil {
+			return err
+		}
+		fmt.Fprintln(output)
+	}
+
+	w := tabwriter.NewWriter(output, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "Platform\tLayers\tCompressed Size\tUncompressed Size")
+	for _, t := range platformTotals(all) {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", t.platform, t.layers, formatLayerSize(t.compressedSize), formatLayerSize(t.uncompressedSize))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	shared := sharedLayers(all)
+	if len(shared) == 0 {
+		fmt.Fprintln(output, "\nNo layers are shared between platforms")
+		return nil
+	}
+
+	fmt.Fprintln(output, "\nShared layers:")
+	w = tabwriter.NewWriter(output, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "Diff ID\tCompressed Size\tUncompressed Size\tPlatforms")
+	for _, l := range shared {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
+			skiff.FormatDigest(cmp.Or(l.layer.DiffID, l.layer.Digest), opts.fullDigest),
+			formatLayerSize(l.layer.CompressedSize),
+			formatLayerSize(l.layer.UncompressedSize),
+			strings.Join(l.platforms, ", "),
+		)
+	}
+	return w.Flush()
+}
+
+// platformTotal is the accumulated size of all layers of one platform
+type platformTotal struct {
+	platform string
+	layers   int
+	// compressedSize and uncompressedSize are -1 if the size of any layer
+	// is unknown
+	compressedSize   int64
+	uncompressedSize int64
+}
+
+// platformTotals sums up the layer sizes of every platform in the order in
+// which the platforms appear in reports.
+func platformTotals(reports []skiff.LayerReport) []platformTotal {
+	var totals []platformTotal
+	for _, l := range reports {
+		if l.EmptyLayer {
+			continue
+		}
+		i := slices.IndexFunc(totals, func(t platformTotal) bool { return t.platform == l.Platform })
+		if i < 0 {
+			totals = append(totals, platformTotal{platform: l.Platform})
+			i = len(totals) - 1
+		}
+
+		t := &totals[i]
+		t.layers++
+		t.compressedSize = addLayerSize(t.compressedSize, l.CompressedSize)
+		t.uncompressedSize = addLayerSize(t.uncompressedSize, l.UncompressedSize)
+	}
+	return totals
+}
+
+// addLayerSize adds two sizes, the result is unknown (-1) if either of them
+// is unknown
+func addLayerSize(a, b int64) int64 {
+	if a < 0 || b < 0 {
+		return -1
+	}
+	return a + b
+}
+
+// sharedLayer is a layer that is used by multiple platforms of an image
+type sharedLayer struct {
+	layer     skiff.LayerReport
+	platforms []string
+}
+
+// sharedLayers returns the layers that are used by more than one platform.
+// Layers are identified by their diffID or, if it is unknown, by their
+// digest.
+func sharedLayers(reports []skiff.LayerReport) []sharedLayer {
+	var layers []sharedLayer
+	for _, l := range reports {
+		if l.EmptyLayer {
+			continue
+		}
+		id := cmp.Or(l.DiffID, l.Digest)
+		i := slices.IndexFunc(layers, func(s sharedLayer) bool { return cmp.Or(s.layer.DiffID, s.layer.Digest) == id })
+		if i < 0 {
+			layers = append(layers, sharedLayer{layer: l})
+			i = len(layers) - 1
+		}
+		if !slices.Contains(layers[i].platforms, l.Platform) {
+			layers[i].platforms = append(layers[i].platforms, l.Platform)
+		}
+	}
+	return slices.DeleteFunc(layers, func(s sharedLayer) bool { return len(s.platforms) < 2 })
+}
+
+// writeLayerTable prints the layers as a table
+func writeLayerTable(output io.Writer, reports []skiff.LayerReport, opts layersOptions) error {
+	digestHeader := "Diff ID"
+	layerDigest := func(l skiff.LayerReport) digest.Digest { return l.DiffID }
+	if slices.ContainsFunc(reports, func(l skiff.LayerReport) bool { return !l.EmptyLayer && l.DiffID == "" }) {
+		digestHeader = "Compressed Digest"
+		layerDigest = func(l skiff.LayerReport) digest.Digest { return l.Digest }
+	}
+
+	w := tabwriter.NewWriter(output, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\tCompressed Size\tUncompressed Size\tRatio\tMedia Type\tCreated\tCreated By\tComment\n", digestHeader)
+	for _, l := range reports {
+		if l.EmptyLayer {
+			fmt.Fprintf(w, "<empty layer>\t0\t0\t-\t-\t%s\n", historyColumns(l, opts.noTrunc))
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			skiff.FormatDigest(layerDigest(l), opts.fullDigest),
+			formatLayerSize(l.CompressedSize),
+			formatLayerSize(l.UncompressedSize),
+			formatRatio(l.CompressionRatio),
+			cmp.Or(l.MediaType, "-"),
+			historyColumns(l, opts.noTrunc),
+		)
+	}
+	return w.Flush()
+}
+
 var LayerUsage cli.Command = cli.Command{
 	Name:      "layers",
 	Usage:     "Print the size of each layer in an image.",
@@ -78,6 +391,20 @@ var LayerUsage cli.Command = cli.Command{
 			Aliases:     []string{"full-diff-id"},
 			DefaultText: "false",
 		},
+		&cli.BoolFlag{
+			Name:  "empty-layers",
+			Usage: "Also list build steps that did not create a layer (e.g. ENV or LABEL)",
+		},
+		&cli.BoolFlag{
+			Name:  "no-trunc",
+			Usage: "Do not truncate the build instructions",
+		},
+		&cli.BoolFlag{
+			Name:  "no-download",
+			Usage: "Do not download the layers of images from registries to determine their uncompressed size",
+		},
+		&allPlatformsFlag,
+		&quietFlag,
 	},
 	Action: func(ctx context.Context, c *cli.Command) error {
 		url := c.StringArg("url")
@@ -85,7 +412,27 @@ var LayerUsage cli.Command = cli.Command{
 			return fmt.Errorf("image URL is required")
 		}
 
-		sysCtx := types.SystemContext{}
-		return ShowLayerUsage(ctx, &sysCtx, url, c.Writer, c.Bool("full-digest"))
+		sysCtx, err := newSystemContext(c)
+		if err != nil {
+			return err
+		}
+		if err := checkAllPlatforms(c); err != nil {
+			return err
+		}
+
+		progress := newLayerProgress(c)
+		if progress != nil {
+			ctx = skiff.WithProgressReporter(ctx, progress)
+			defer progress.Wait()
+		}
+		return ShowLayerUsage(ctx, sysCtx, url, c.Writer, layersOptions{
+			fullDigest:   c.Bool("full-digest"),
+			format:       c.String("format"),
+			emptyLayers:  c.Bool("empty-layers"),
+			noTrunc:      c.Bool("no-trunc"),
+			noDownload:   c.Bool("no-download"),
+			allPlatforms: c.Bool(allPlatformsFlag.Name),
+			progress:     progress,
+		})
 	},
 }
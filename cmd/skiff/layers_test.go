@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	skiff "github.com/dcermak/skiff/pkg"
+	"github.com/dcermak/skiff/pkg/imagetest"
+)
+
+func TestSharedLayers(t *testing.T) {
+	reports := []skiff.LayerReport{
+		{DiffID: "sha256:base", Platform: "linux/amd64"},
+		{DiffID: "sha256:amd64", Platform: "linux/amd64"},
+		{CreatedBy: "ENV FOO=bar", EmptyLayer: true, Platform: "linux/amd64"},
+		{DiffID: "sha256:base", Platform: "linux/arm64"},
+		{DiffID: "sha256:arm64", Platform: "linux/arm64"},
+		{Digest: "sha256:compressed", Platform: "linux/arm64"},
+		{Digest: "sha256:compressed", Platform: "linux/s390x"},
+	}
+
+	shared := sharedLayers(reports)
+	if len(shared) != 2 {
+		t.Fatalf("Expected 2 shared layers, got %+v", shared)
+	}
+	if shared[0].layer.DiffID != "sha256:base" || !slices.Equal(shared[0].platforms, []string{"linux/amd64", "linux/arm64"}) {
+		t.Errorf("Unexpected shared layer %+v", shared[0])
+	}
+	if shared[1].layer.Digest != "sha256:compressed" || !slices.Equal(shared[1].platforms, []string{"linux/arm64", "linux/s390x"}) {
+		t.Errorf("Unexpected shared layer %+v", shared[1])
+	}
+}
+
+func TestPlatformTotals(t *testing.T) {
+	reports := []skiff.LayerReport{
+		{CompressedSize: 10, UncompressedSize: 30, Platform: "linux/amd64"},
+		{CompressedSize: 5, UncompressedSize: 20, Platform: "linux/amd64"},
+		{EmptyLayer: true, Platform: "linux/amd64"},
+		{CompressedSize: 12, UncompressedSize: -1, Platform: "linux/arm64"},
+	}
+
+	expected := []platformTotal{
+		{platform: "linux/amd64", layers: 2, compressedSize: 15, uncompressedSize: 50},
+		{platform: "linux/arm64", layers: 1, compressedSize: 12, uncompressedSize: -1},
+	}
+	if totals := platformTotals(reports); !slices.Equal(totals, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, totals)
+	}
+}
+
+func TestLayerReportsTransports(t *testing.T) {
+	layers := []imagetest.Layer{
+		{CreatedBy: "ADD rootfs.tar /", Files: []imagetest.File{{Path: "usr/bin/tool", Content: strings.Repeat("x", 4096)}}},
+		{CreatedBy: "RUN update", Uncompressed: true, Files: []imagetest.File{{Path: "etc/config", Content: "config"}}},
+	}
+	img := imagetest.Image{Layers: layers, EmptyLayers: []string{"ENV FOO=bar"}}
+
+	for name, uri := range imagetest.WriteAllTransports(t, img) {
+		t.Run(name, func(t *testing.T) {
+			reports, err := layerReports(context.Background(), nil, uri, true, false)
+			if err != nil {
+				t.Fatalf("layerReports failed: %v", err)
+			}
+			if len(reports) != 3 {
+				t.Fatalf("Expected 2 layers and one empty layer, got %+v", reports)
+			}
+
+			for i, l := range layers {
+				r := reports[i]
+				if r.DiffID != l.DiffID(t) {
+					t.Errorf("Expected the diffID %s, got %s", l.DiffID(t), r.DiffID)
+				}
+				if size := int64(len(l.Tar(t))); r.UncompressedSize != size {
+					t.Errorf("Expected the uncompressed size %d of layer %d, got %d", size, i, r.UncompressedSize)
+				}
+				if r.CompressedSize <= 0 || r.CompressionRatio <= 0 {
+					t.Errorf("Expected the compressed size and ratio of layer %d, got %+v", i, r)
+				}
+				if r.CreatedBy != l.CreatedBy {
+					t.Errorf("Expected layer %d to be created by %q, got %q", i, l.CreatedBy, r.CreatedBy)
+				}
+			}
+			if !reports[2].EmptyLayer || reports[2].CreatedBy != "ENV FOO=bar" {
+				t.Errorf("Expected the empty layer last, got %+v", reports[2])
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/urfave/cli/v3"
+	"go.podman.io/image/v5/types"
+
+	skiff "github.com/dcermak/skiff/pkg"
+)
+
+// failOnNone disables failing on findings with --fail-on
+const failOnNone = "none"
+
+// exitLintFindings is the exit code of the lint command if it found problems
+// with at least the severity of --fail-on, errors exit with 1
+const exitLintFindings = 2
+
+var lintCommand = cli.Command{
+	Name:      "lint",
+	Usage:     "Check an image for common sources of wasted space, like package manager caches or documentation",
+	ArgsUsage: "[image]",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "human-readable",
+			Usage: "Show sizes in human readable format",
+		},
+		&cli.BoolFlag{
+			Name:        "full-digest",
+			Usage:       "Show full digests instead of truncated (12 chars)",
+			Aliases:     []string{"full-diff-id"},
+			DefaultText: "false",
+		},
+		&configFlag,
+		&cli.StringFlag{
+			Name:        "fail-on",
+			Usage:       "Exit with 2 if there are findings with this or a higher severity: info, warning, error or none",
+			DefaultText: "warning",
+		},
+		&cli.BoolFlag{
+			Name:  "list-rules",
+			Usage: "List the rules instead of checking an image",
+		},
+		&jobsFlag,
+		&quietFlag,
+	},
+	Arguments: []cli.Argument{
+		&cli.StringArg{Name: "image", UsageText: "Container image ref"},
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		cfg, err := readConfig(c)
+		if err != nil {
+			return err
+		}
+		rules, err := cfg.Lint.rules()
+		if err != nil {
+			return err
+		}
+
+		opts := lintOptions{
+			humanReadable: c.Bool("human-readable"),
+			fullDigest:    c.Bool("full-digest"),
+			format:        c.String("format"),
+			rules:         rules,
+			jobs:          c.Int("jobs"),
+		}
+		failOn := cmp.Or(c.String("fail-on"), cfg.Lint.FailOn, skiff.SeverityWarning.String())
+		if failOn != failOnNone {
+			severity, err := skiff.ParseSeverity(failOn)
+			if err != nil {
+				return fmt.Errorf("invalid --fail-on: %w", err)
+			}
+			opts.failOn = &severity
+		}
+
+		if c.Bool("list-rules") {
+			return listLintRules(c.Writer, opts)
+		}
+
+		image := c.StringArg("image")
+		if image == "" {
+			return fmt.Errorf("image URL is required")
+		}
+
+		sysCtx, err := newSystemContext(c)
+		if err != nil {
+			return err
+		}
+
+		opts.progress = newLayerProgress(c)
+		if opts.progress != nil {
+			ctx = skiff.WithProgressReporter(ctx, opts.progress)
+			defer opts.progress.Wait()
+		}
+		failed, err := lintImage(ctx, sysCtx, image, opts, c.Writer)
+		if err != nil {
+			return err
+		}
+		if failed > 0 {
+			return cli.Exit(fmt.Sprintf("%d findings with severity %s or higher", failed, opts.failOn), exitLintFindings)
+		}
+		return nil
+	},
+}
+
+// lintOptions configures lintImage
+type lintOptions struct {
+	humanReadable bool
+	fullDigest    bool
+	format        string
+	rules         []skiff.LintRule
+	// failOn is the minimum severity of the findings that fail the check,
+	// nil never fails
+	failOn   *skiff.Severity
+	jobs     int
+	progress *layerProgress
+}
+
+// lintImage applies the rules to the image at uri and lists the findings,
+// largest first. It returns the number of findings with at least the severity
+// failOn.
+func lintImage(ctx context.Context, sysCtx *types.SystemContext, uri string, opts lintOptions, output io.Writer) (int, error) {
+	imgLayers, err := skiff.OpenImageLayers(ctx, sysCtx, uri)
+	if err != nil {
+		return 0, err
+	}
+	defer imgLayers.Close()
+
+	fs, err := imgLayers.Merge(ctx, opts.jobs, false)
+	if err != nil {
+		return 0, err
+	}
+	findings, err := imgLayers.Lint(ctx, fs, opts.rules, opts.jobs)
+	if err != nil {
+		return 0, err
+	}
+	opts.progress.Wait()
+
+	failed := 0
+	for _, f := range findings {
+		if opts.failOn != nil && f.Severity >= *opts.failOn {
+			failed++
+		}
+	}
+
+	if opts.format != formatTable {
+		reports := make([]skiff.LintReport, 0, len(findings))
+		for _, f := range findings {
+			reports = append(reports, skiff.LintReport{
+				Rule:     f.Rule,
+				Severity: f.Severity.String(),
+				Path:     f.Path,
+				Size:     f.Size,
+				Files:    f.Files,
+				DiffID:   f.DiffID,
+			})
+		}
+		return failed, writeReport(output, opts.format, reports)
+	}
+
+	var totalSize int64
+	w := tabwriter.NewWriter(output, 0, 0, 2, ' ', tabwriter.TabIndent)
+	fmt.Fprintln(w, "RULE\tSEVERITY\tSIZE\tFILES\tDIFF ID\tPATH")
+	for _, f := range findings {
+		size := strconv.FormatInt(f.Size, 10)
+		if opts.humanReadable {
+			size = skiff.HumanReadableSize(f.Size)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n",
+			f.Rule,
+			f.Severity,
+			size,
+			f.Files,
+			skiff.FormatDigest(f.DiffID, opts.fullDigest),
+			f.Path,
+		)
+		totalSize += f.Size
+	}
+	if err := w.Flush(); err != nil {
+		return failed, err
+	}
+
+	fmt.Fprintf(output, "\n%d findings, %s reclaimable\n", len(findings), formatTotalSize(totalSize, opts.humanReadable))
+	return failed, nil
+}
+
+// listLintRules lists the rules with their configuration
+func listLintRules(output io.Writer, opts lintOptions) error {
+	w := tabwriter.NewWriter(output, 0, 0, 2, ' ', tabwriter.TabIndent)
+	fmt.Fprintln(w, "RULE\tSEVERITY\tMIN SIZE\tPATHS\tDESCRIPTION")
+	for _, r := range opts.rules {
+		minSize := strconv.FormatInt(r.MinSize, 10)
+		if opts.humanReadable {
+			minSize = skiff.HumanReadableSize(r.MinSize)
+		}
+		paths := "-"
+		if len(r.Paths) > 0 {
+			paths = strings.Join(r.Paths, ",")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.ID, r.Severity, minSize, paths, r.Description)
+	}
+	return w.Flush()
+}
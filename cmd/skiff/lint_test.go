@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dcermak/skiff/pkg/imagetest"
+
+	skiff "github.com/dcermak/skiff/pkg"
+)
+
+func TestLintImage(t *testing.T) {
+	img := imagetest.Image{Layers: []imagetest.Layer{
+		{Files: []imagetest.File{
+			{Path: "var/cache/apt/archives/curl.deb", Content: strings.Repeat("x", 2000)},
+			{Path: "usr/share/doc/curl/README", Content: strings.Repeat("x", 300)},
+		}},
+	}}
+	uri := imagetest.WriteOCILayout(t, img)
+	diffID := img.Layers[0].DiffID(t)
+	base := diffID.Encoded()[:12]
+
+	warning, errorSeverity := skiff.SeverityWarning, skiff.SeverityError
+	configured, err := lintConfig{Rules: map[string]lintRuleConfig{
+		skiff.RuleDocumentation: {Severity: "error"},
+	}}.rules()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		opts     lintOptions
+		failed   int
+		expected string
+	}{
+		{
+			name:   "table",
+			opts:   lintOptions{format: formatTable, rules: skiff.DefaultLintRules(), failOn: &warning},
+			failed: 2,
+			expected: "RULE                   SEVERITY  SIZE  FILES  DIFF ID       PATH\n" +
+				"package-manager-cache  warning   2000  1      " + base + "  /var/cache/apt\n" +
+				"documentation          warning   300   1      " + base + "  /usr/share/doc\n" +
+				"\n2 findings, 2300 bytes reclaimable\n",
+		},
+		{
+			name:   "fail on error",
+			opts:   lintOptions{format: formatCSV, rules: configured, failOn: &errorSeverity},
+			failed: 1,
+			expected: "rule,severity,path,size,files,diffID\n" +
+				"package-manager-cache,warning,/var/cache/apt,2000,1," + diffID.String() + "\n" +
+				"documentation,error,/usr/share/doc,300,1," + diffID.String() + "\n",
+		},
+		{
+			name:   "never fail",
+			opts:   lintOptions{format: formatTable, rules: skiff.DefaultLintRules()[:1], humanReadable: true},
+			failed: 0,
+			expected: "RULE                   SEVERITY  SIZE    FILES  DIFF ID       PATH\n" +
+				"package-manager-cache  warning   2.0 kB  1      " + base + "  /var/cache/apt\n" +
+				"\n1 findings, 2.0 kB reclaimable\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			failed, err := lintImage(context.Background(), nil, uri, tt.opts, &buf)
+			if err != nil {
+				t.Fatalf("lintImage failed: %v", err)
+			}
+			if failed != tt.failed {
+				t.Errorf("Expected %d failed findings, got %d", tt.failed, failed)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tt.expected, buf.String())
+			}
+		})
+	}
+}
+
+func TestLintConfig(t *testing.T) {
+	write := func(t *testing.T, content string) string {
+		path := filepath.Join(t.TempDir(), "skiff.toml")
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	t.Run("rules", func(t *testing.T) {
+		cfg, err := loadConfig(write(t, `
+[lint]
+fail-on = "error"
+
+[lint.rules.documentation]
+enabled = false
+
+[lint.rules.package-manager-cache]
+severity = "error"
+min-size = "1MiB"
+exclude = ["/var/cache/apt/archives/partial"]
+
+[lint.rules.logs]
+description = "Log files"
+paths = ["/var/log", "*.log"]
+`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Lint.FailOn != "error" {
+			t.Errorf("Expected fail-on error, got %q", cfg.Lint.FailOn)
+		}
+		rules, err := cfg.Lint.rules()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var ids []string
+		for _, r := range rules {
+			ids = append(ids, r.ID)
+		}
+		expectedIDs := "package-manager-cache,python-bytecode,development-files,unstripped-binaries,deleted-files,logs"
+		if strings.Join(ids, ",") != expectedIDs {
+			t.Errorf("Expected rules %s, got %s", expectedIDs, strings.Join(ids, ","))
+		}
+		if r := rules[0]; r.Severity != skiff.SeverityError || r.MinSize != 1<<20 || len(r.Exclude) != 1 {
+			t.Errorf("Unexpected package-manager-cache rule %+v", r)
+		}
+		if r := rules[5]; r.Description != "Log files" || r.Severity != skiff.SeverityWarning || len(r.Paths) != 2 {
+			t.Errorf("Unexpected logs rule %+v", r)
+		}
+	})
+
+	errors := []struct {
+		name, content, expected string
+	}{
+		{"unknown key", "[lint]\nfail_on = \"error\"\n", "unknown keys in the configuration file"},
+		{"paths of a built-in check", "[lint.rules.unstripped-binaries]\npaths = [\"/usr/bin\"]\n", "the paths of this rule cannot be changed"},
+		{"rule without paths", "[lint.rules.logs]\nseverity = \"info\"\n", "additional rules must have paths"},
+		{"invalid severity", "[lint.rules.documentation]\nseverity = \"fatal\"\n", "invalid severity"},
+		{"invalid size", "[lint.rules.documentation]\nmin-size = \"lots\"\n", "invalid size"},
+		{"invalid pattern", "[lint.rules.documentation]\nexclude = [\"[\"]\n", "invalid pattern"},
+	}
+	for _, tt := range errors {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadConfig(write(t, tt.content))
+			if err == nil {
+				_, err = cfg.Lint.rules()
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("Expected an error containing %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
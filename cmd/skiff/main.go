@@ -4,12 +4,15 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"slices"
 
 	"github.com/syndtr/gocapability/capability"
 	"go.podman.io/storage/pkg/reexec"
 	"go.podman.io/storage/pkg/unshare"
 
 	"github.com/urfave/cli/v3"
+
+	skiff "github.com/dcermak/skiff/pkg"
 )
 
 func main() {
@@ -45,9 +48,25 @@ func main() {
 				}
 			}
 
+			cache, err := newBlobCache(c)
+			if err != nil {
+				return ctx, err
+			}
+			if cache != nil {
+				ctx = skiff.WithBlobCache(ctx, cache)
+			}
+			indexStore, err := newIndexStore(c)
+			if err != nil {
+				return ctx, err
+			}
+			if indexStore != nil {
+				ctx = skiff.WithIndexStore(ctx, indexStore)
+			}
+
 			return ctx, nil
 		},
-		Commands: []*cli.Command{&LayerUsage, &topCommand},
+		Flags:    slices.Concat([]cli.Flag{&formatFlag}, systemContextFlags, cacheFlags),
+		Commands: []*cli.Command{&LayerUsage, &topCommand, &wastedCommand, &diffCommand, &exploreCommand, &packagesCommand, &dependenciesCommand, &lintCommand, &checkCommand, &cacheCommand},
 	}
 
 	err := cmd.Run(context.Background(), os.Args)
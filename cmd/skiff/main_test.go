@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"go.podman.io/storage/pkg/reexec"
+
+	"github.com/dcermak/skiff/pkg/imagetest"
+)
+
+// TestMain runs the tests with a temporary container storage, which can run
+// its helper processes
+func TestMain(m *testing.M) {
+	if reexec.Init() {
+		return
+	}
+	cleanup, err := imagetest.UseTemporaryStorage()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	code := m.Run()
+	cleanup()
+	os.Exit(code)
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/urfave/cli/v3"
+	"go.podman.io/image/v5/types"
+
+	skiff "github.com/dcermak/skiff/pkg"
+)
+
+var packagesCommand = cli.Command{
+	Name:      "packages",
+	Usage:     "List the packages installed in a container image by their installed size",
+	ArgsUsage: "[image]",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "human-readable",
+			Usage: "Show package sizes in human readable format",
+		},
+		&cli.BoolFlag{
+			Name:        "full-digest",
+			Usage:       "Show full digests instead of truncated (12 chars)",
+			Aliases:     []string{"full-diff-id"},
+			DefaultText: "false",
+		},
+		&cli.BoolFlag{
+			Name:  "changes",
+			Usage: "List the packages that every layer installed or removed instead of the installed packages",
+		},
+		&jobsFlag,
+		&quietFlag,
+	},
+	Arguments: []cli.Argument{
+		&cli.StringArg{Name: "image", UsageText: "Container image ref"},
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		image := c.StringArg("image")
+		if image == "" {
+			return fmt.Errorf("image URL is required")
+		}
+
+		sysCtx, err := newSystemContext(c)
+		if err != nil {
+			return err
+		}
+
+		opts := packagesOptions{
+			humanReadable: c.Bool("human-readable"),
+			fullDigest:    c.Bool("full-digest"),
+			format:        c.String("format"),
+			changes:       c.Bool("changes"),
+			jobs:          c.Int("jobs"),
+			progress:      newLayerProgress(c),
+		}
+		if opts.progress != nil {
+			ctx = skiff.WithProgressReporter(ctx, opts.progress)
+			defer opts.progress.Wait()
+		}
+		return showPackages(ctx, sysCtx, image, opts, c.Writer)
+	},
+}
+
+// packagesOptions configures the output of showPackages
+type packagesOptions struct {
+	humanReadable bool
+	fullDigest    bool
+	format        string
+	// changes lists the packages that every layer installed or removed
+	changes  bool
+	jobs     int
+	progress *layerProgress
+}
+
+// imagePackages reads the merged filesystem of the image and the packages
+// that are installed in it.
+func imagePackages(ctx context.Context, imgLayers *skiff.ImageLayers, jobs int) (*skiff.InstalledPackages, error) {
+	fs, err := imgLayers.Merge(ctx, jobs, false)
+	if err != nil {
+		return nil, err
+	}
+	return imgLayers.Packages(ctx, fs, jobs)
+}
+
+// showPackages lists the packages installed in the image at uri, largest
+// first, with the layer that installed them.
+func showPackages(ctx context.Context, sysCtx *types.SystemContext, uri string, opts packagesOptions, output io.Writer) error {
+	imgLayers, err := skiff.OpenImageLayers(ctx, sysCtx, uri)
+	if err != nil {
+		return err
+	}
+	defer imgLayers.Close()
+
+	installed, err := imagePackages(ctx, imgLayers, opts.jobs)
+	if err != nil {
+		return err
+	}
+	opts.progress.Wait()
+
+	if opts.changes {
+		return writePackageChanges(output, opts, installed.Changes)
+	}
+
+	packages := installed.Packages
+	slices.SortFunc(packages, func(a, b skiff.Package) int {
+		return cmp.Or(cmp.Compare(b.InstalledSize, a.InstalledSize), strings.Compare(a.Name, b.Name), strings.Compare(a.Arch, b.Arch))
+	})
+
+	if opts.format != formatTable {
+		reports := make([]skiff.PackageReport, 0, len(packages))
+		for _, p := range packages {
+			reports = append(reports, skiff.PackageReport{
+				Name:          p.Name,
+				Version:       p.Version,
+				Arch:          p.Arch,
+				InstalledSize: p.InstalledSize,
+				DiffID:        p.DiffID,
+				Manager:       p.Manager,
+			})
+		}
+		return writeReport(output, opts.format, reports)
+	}
+
+	var totalSize int64
+	w := tabwriter.NewWriter(output, 0, 0, 2, ' ', tabwriter.TabIndent)
+	fmt.Fprintln(w, "NAME\tVERSION\tARCH\tSIZE\tDIFF ID")
+	for _, p := range packages {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			p.Name,
+			p.Version,
+			p.Arch,
+			formatPackageSize(p.InstalledSize, opts.humanReadable),
+			skiff.FormatDigest(p.DiffID, opts.fullDigest),
+		)
+		totalSize += max(p.InstalledSize, 0)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(output, "\n%d %s packages, %s installed\n", len(packages), installed.Manager, formatTotalSize(totalSize, opts.humanReadable))
+	return nil
+}
+
+// formatPackageSize formats the installed size of a package for a table
+func formatPackageSize(size int64, humanReadable bool) string {
+	switch {
+	case size < 0:
+		return "-"
+	case humanReadable:
+		return skiff.HumanReadableSize(size)
+	}
+	return strconv.FormatInt(size, 10)
+}
+
+// values of PackageChangeReport.Change
+const (
+	packageInstalled = "installed"
+	packageRemoved   = "removed"
+)
+
+// writePackageChanges lists the packages that every layer installed or
+// removed, starting with the bottom layer.
+func writePackageChanges(output io.Writer, opts packagesOptions, changes []skiff.PackageChanges) error {
+	reports := []skiff.PackageChangeReport{}
+	for _, c := range changes {
+		for _, p := range c.Installed {
+			reports = append(reports, newPackageChangeReport(c, p, packageInstalled))
+		}
+		for _, p := range c.Removed {
+			reports = append(reports, newPackageChangeReport(c, p, packageRemoved))
+		}
+	}
+	if opts.format != formatTable {
+		return writeReport(output, opts.format, reports)
+	}
+
+	w := tabwriter.NewWriter(output, 0, 0, 2, ' ', tabwriter.TabIndent)
+	fmt.Fprintln(w, "DIFF ID\tCHANGE\tNAME\tVERSION\tARCH\tSIZE")
+	for _, r := range reports {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			skiff.FormatDigest(r.DiffID, opts.fullDigest),
+			r.Change,
+			r.Name,
+			r.Version,
+			r.Arch,
+			formatPackageSize(r.InstalledSize, opts.humanReadable),
+		)
+	}
+	return w.Flush()
+}
+
+// newPackageChangeReport converts a package that the layer of c installed or
+// removed into a report
+func newPackageChangeReport(c skiff.PackageChanges, p skiff.Package, change string) skiff.PackageChangeReport {
+	return skiff.PackageChangeReport{
+		DiffID:        c.DiffID,
+		Change:        change,
+		Name:          p.Name,
+		Version:       p.Version,
+		Arch:          p.Arch,
+		InstalledSize: p.InstalledSize,
+		Manager:       p.Manager,
+	}
+}
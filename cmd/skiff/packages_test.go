@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/dcermak/skiff/pkg/imagetest"
+)
+
+func TestShowPackages(t *testing.T) {
+	bash := imagetest.RPM{Name: "bash", Version: "5.2.15", Release: "1.1", Arch: "x86_64", Size: 1000, Files: []string{"/usr/bin/bash"}}
+	vim := imagetest.RPM{Name: "vim", Version: "9.1", Release: "1.1", Arch: "x86_64", Epoch: 2, Size: 5000, Files: []string{"/usr/bin/vim"}}
+	img := imagetest.Image{Layers: []imagetest.Layer{
+		{Files: []imagetest.File{
+			{Path: "usr/lib/sysimage/rpm/Packages.db", Content: string(imagetest.NDBDatabase(bash))},
+			{Path: "usr/bin/bash", Content: strings.Repeat("x", 1000)},
+		}},
+		{Files: []imagetest.File{
+			{Path: "usr/lib/sysimage/rpm/Packages.db", Content: string(imagetest.NDBDatabase(bash, vim))},
+			{Path: "usr/bin/vim", Content: strings.Repeat("x", 5000)},
+		}},
+	}}
+	uri := imagetest.WriteOCILayout(t, img)
+	base, update := img.Layers[0].DiffID(t).Encoded()[:12], img.Layers[1].DiffID(t).Encoded()[:12]
+
+	tests := []struct {
+		name     string
+		opts     packagesOptions
+		expected string
+	}{
+		{
+			name: "table",
+			opts: packagesOptions{format: formatTable},
+			expected: "NAME  VERSION     ARCH    SIZE  DIFF ID\n" +
+				"vim   2:9.1-1.1   x86_64  5000  " + update + "\n" +
+				"bash  5.2.15-1.1  x86_64  1000  " + base + "\n" +
+				"\n2 rpm packages, 6000 bytes installed\n",
+		},
+		{
+			name: "changes",
+			opts: packagesOptions{format: formatTable, changes: true},
+			expected: "DIFF ID       CHANGE     NAME  VERSION     ARCH    SIZE\n" +
+				base + "  installed  bash  5.2.15-1.1  x86_64  1000\n" +
+				update + "  installed  vim   2:9.1-1.1   x86_64  5000\n",
+		},
+		{
+			name: "csv",
+			opts: packagesOptions{format: formatCSV},
+			expected: "name,version,arch,installedSize,diffID,manager\n" +
+				"vim,2:9.1-1.1,x86_64,5000,sha256:" + img.Layers[1].DiffID(t).Encoded() + ",rpm\n" +
+				"bash,5.2.15-1.1,x86_64,1000,sha256:" + img.Layers[0].DiffID(t).Encoded() + ",rpm\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := showPackages(context.Background(), nil, uri, tt.opts, &buf); err != nil {
+				t.Fatalf("showPackages failed: %v", err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tt.expected, buf.String())
+			}
+		})
+	}
+
+	t.Run("top", func(t *testing.T) {
+		var buf bytes.Buffer
+		opts := topOptions{Format: formatTable, Packages: true, Merged: true, Layers: []string{base}}
+		if err := analyzeLayers(context.Background(), nil, uri, opts, &buf); err != nil {
+			t.Fatalf("analyzeLayers failed: %v", err)
+		}
+		expected := "FILE PATH      SIZE  DIFF ID       PACKAGE\n" +
+			"/usr/bin/bash  1000  " + base + "  bash\n" +
+			"\nShadowed: 1 files, 4304 bytes overwritten or deleted by upper layers\n"
+		if buf.String() != expected {
+			t.Errorf("Expected:\n%s\ngot:\n%s", expected, buf.String())
+		}
+	})
+}
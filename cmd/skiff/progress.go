@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io"
+	"os"
+	"sync"
+
+	"github.com/urfave/cli/v3"
+	"github.com/vbauerster/mpb/v8"
+	"github.com/vbauerster/mpb/v8/decor"
+	"go.podman.io/image/v5/types"
+	"golang.org/x/term"
+
+	skiff "github.com/dcermak/skiff/pkg"
+)
+
+var quietFlag = cli.BoolFlag{
+	Name:    "quiet",
+	Aliases: []string{"q"},
+	Usage:   "Do not show the progress of reading layers on stderr",
+}
+
+// layerProgress shows a progress bar on stderr for every layer blob that is
+// being read. It implements skiff.ProgressReporter.
+type layerProgress struct {
+	output io.Writer
+
+	mu sync.Mutex
+	// bars renders the progress bars, it is created when the first blob
+	// is read and reset by Wait
+	bars *mpb.Progress
+}
+
+// newLayerProgress returns the progress reporter for c or nil if progress
+// bars are disabled via --quiet or because stderr is not a terminal.
+func newLayerProgress(c *cli.Command) *layerProgress {
+	if c.Bool(quietFlag.Name) {
+		return nil
+	}
+	stderr, ok := c.Root().ErrWriter.(*os.File)
+	if !ok || !term.IsTerminal(int(stderr.Fd())) {
+		return nil
+	}
+	return &layerProgress{output: stderr}
+}
+
+func (p *layerProgress) TrackBlob(layer types.BlobInfo, blob io.ReadCloser) io.ReadCloser {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.bars == nil {
+		p.bars = mpb.New(mpb.WithOutput(p.output), mpb.WithWidth(40))
+	}
+	bar := p.bars.AddBar(max(layer.Size, 0),
+		mpb.BarRemoveOnComplete(),
+		mpb.PrependDecorators(
+			decor.Name(skiff.FormatDigest(layer.Digest, false), decor.WCSyncSpaceR),
+			decor.CountersKibiByte("% .1f / % .1f", decor.WCSyncSpace),
+		),
+		mpb.AppendDecorators(
+			decor.AverageSpeed(decor.SizeB1024(0), "% .1f", decor.WCSyncSpace),
+		),
+	)
+	return &progressReader{ReadCloser: bar.ProxyReader(blob), bar: bar}
+}
+
+// Wait waits until the progress bars of all blobs have been removed. It must
+// be called before writing to stdout, as redrawing the progress bars would
+// otherwise overwrite the output on the terminal. It is safe to call Wait on
+// a nil layerProgress.
+func (p *layerProgress) Wait() {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.bars != nil {
+		p.bars.Wait()
+		p.bars = nil
+	}
+}
+
+// progressReader completes the progress bar of a blob once it is closed
+type progressReader struct {
+	io.ReadCloser
+	bar *mpb.Bar
+}
+
+func (r *progressReader) Close() error {
+	err := r.ReadCloser.Close()
+	// the blob is not necessarily read until the end and its size might
+	// be unknown, so the bar is completed with the bytes actually read
+	r.bar.SetTotal(-1, true)
+	return err
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+	"go.podman.io/image/v5/types"
+
+	skiff "github.com/dcermak/skiff/pkg"
+)
+
+var platformFlag = cli.StringFlag{
+	Name:  "platform",
+	Usage: "Select the image of this platform (os/arch[/variant]) from multi-arch images instead of the platform of the host",
+	Validator: func(platform string) error {
+		_, err := skiff.ParsePlatform(platform)
+		return err
+	},
+}
+
+var (
+	authfileFlag = cli.StringFlag{
+		Name:    "authfile",
+		Usage:   "Path of the authentication file for registries",
+		Sources: cli.EnvVars("REGISTRY_AUTH_FILE"),
+	}
+	credsFlag = cli.StringFlag{
+		Name:  "creds",
+		Usage: "Credentials (username:password) for accessing the registry",
+		Validator: func(creds string) error {
+			_, err := parseCreds(creds)
+			return err
+		},
+	}
+	certDirFlag = cli.StringFlag{
+		Name:  "cert-dir",
+		Usage: "Use certificates at this path (*.crt, *.cert, *.key) to connect to the registry",
+	}
+	tlsVerifyFlag = cli.BoolFlag{
+		Name:        "tls-verify",
+		Usage:       "Require HTTPS and verify certificates when contacting registries",
+		Value:       true,
+		DefaultText: "true",
+	}
+	registriesConfFlag = cli.StringFlag{
+		Name:    "registries-conf",
+		Usage:   "Path of the registries.conf file used to resolve short names and mirrors",
+		Sources: cli.EnvVars("REGISTRIES_CONFIG_PATH"),
+	}
+)
+
+// systemContextFlags are the global flags that configure how images are
+// accessed
+var systemContextFlags = []cli.Flag{
+	&platformFlag,
+	&authfileFlag,
+	&credsFlag,
+	&certDirFlag,
+	&tlsVerifyFlag,
+	&registriesConfFlag,
+}
+
+// parseCreds parses credentials in the form username:password.
+func parseCreds(creds string) (*types.DockerAuthConfig, error) {
+	username, password, found := strings.Cut(creds, ":")
+	if !found || username == "" {
+		return nil, fmt.Errorf("invalid credentials, must be in the form username:password")
+	}
+	return &types.DockerAuthConfig{Username: username, Password: password}, nil
+}
+
+var allPlatformsFlag = cli.BoolFlag{
+	Name:  "all-platforms",
+	Usage: "Analyze the images of all platforms of a multi-arch image",
+}
+
+// checkAllPlatforms returns an error if --all-platforms is combined with
+// --platform.
+func checkAllPlatforms(c *cli.Command) error {
+	if c.Bool(allPlatformsFlag.Name) && c.IsSet(platformFlag.Name) {
+		return fmt.Errorf("--%s and --%s cannot be used together", allPlatformsFlag.Name, platformFlag.Name)
+	}
+	return nil
+}
+
+// newSystemContext creates the SystemContext that is used to access images
+// from the global flags.
+func newSystemContext(c *cli.Command) (*types.SystemContext, error) {
+	sysCtx := &types.SystemContext{
+		AuthFilePath:             c.String(authfileFlag.Name),
+		DockerCertPath:           c.String(certDirFlag.Name),
+		SystemRegistriesConfPath: c.String(registriesConfFlag.Name),
+	}
+
+	if c.IsSet(credsFlag.Name) {
+		creds, err := parseCreds(c.String(credsFlag.Name))
+		if err != nil {
+			return nil, err
+		}
+		sysCtx.DockerAuthConfig = creds
+	}
+
+	if c.IsSet(tlsVerifyFlag.Name) {
+		skipVerify := !c.Bool(tlsVerifyFlag.Name)
+		sysCtx.DockerInsecureSkipTLSVerify = types.NewOptionalBool(skipVerify)
+		sysCtx.OCIInsecureSkipTLSVerify = skipVerify
+		sysCtx.DockerDaemonInsecureSkipTLSVerify = skipVerify
+	}
+
+	if c.IsSet(platformFlag.Name) {
+		p, err := skiff.ParsePlatform(c.String(platformFlag.Name))
+		if err != nil {
+			return nil, err
+		}
+		sysCtx = skiff.WithPlatform(sysCtx, p)
+	}
+	return sysCtx, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/urfave/cli/v3"
+	"go.podman.io/image/v5/types"
+)
+
+// runSystemContext parses args with the global flags and returns the
+// resulting SystemContext
+func runSystemContext(t *testing.T, args ...string) (*types.SystemContext, error) {
+	t.Helper()
+
+	// flags store their values, so every run needs its own copies
+	var flags []cli.Flag
+	for _, f := range systemContextFlags {
+		switch f := f.(type) {
+		case *cli.StringFlag:
+			c := *f
+			flags = append(flags, &c)
+		case *cli.BoolFlag:
+			c := *f
+			flags = append(flags, &c)
+		default:
+			t.Fatalf("unexpected flag type %T", f)
+		}
+	}
+
+	var sysCtx *types.SystemContext
+	var sysCtxErr error
+	cmd := &cli.Command{
+		Name:      "skiff",
+		Flags:     flags,
+		Writer:    io.Discard,
+		ErrWriter: io.Discard,
+		Action: func(ctx context.Context, c *cli.Command) error {
+			sysCtx, sysCtxErr = newSystemContext(c)
+			return nil
+		},
+	}
+	if err := cmd.Run(context.Background(), append([]string{"skiff"}, args...)); err != nil {
+		return nil, err
+	}
+	return sysCtx, sysCtxErr
+}
+
+func TestNewSystemContext(t *testing.T) {
+	sysCtx, err := runSystemContext(t,
+		"--authfile", "/run/auth.json",
+		"--creds", "user:pa:ss",
+		"--cert-dir", "/etc/certs",
+		"--tls-verify=false",
+		"--registries-conf", "/etc/registries.conf",
+		"--platform", "linux/arm64",
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if sysCtx.AuthFilePath != "/run/auth.json" {
+		t.Errorf("Expected the auth file to be set, got %q", sysCtx.AuthFilePath)
+	}
+	if sysCtx.DockerAuthConfig == nil || sysCtx.DockerAuthConfig.Username != "user" || sysCtx.DockerAuthConfig.Password != "pa:ss" {
+		t.Errorf("Unexpected credentials %+v", sysCtx.DockerAuthConfig)
+	}
+	if sysCtx.DockerCertPath != "/etc/certs" {
+		t.Errorf("Expected the certificate directory to be set, got %q", sysCtx.DockerCertPath)
+	}
+	if sysCtx.DockerInsecureSkipTLSVerify != types.OptionalBoolTrue || !sysCtx.OCIInsecureSkipTLSVerify {
+		t.Errorf("Expected TLS verification to be disabled, got %+v", sysCtx)
+	}
+	if sysCtx.SystemRegistriesConfPath != "/etc/registries.conf" {
+		t.Errorf("Expected the registries.conf path to be set, got %q", sysCtx.SystemRegistriesConfPath)
+	}
+	if sysCtx.ArchitectureChoice != "arm64" || sysCtx.OSChoice != "linux" {
+		t.Errorf("Expected the platform to be set, got %+v", sysCtx)
+	}
+}
+
+func TestNewSystemContextDefaults(t *testing.T) {
+	t.Setenv("REGISTRY_AUTH_FILE", "")
+	t.Setenv("REGISTRIES_CONFIG_PATH", "")
+
+	sysCtx, err := runSystemContext(t)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if sysCtx.DockerAuthConfig != nil || sysCtx.DockerInsecureSkipTLSVerify != types.OptionalBoolUndefined || sysCtx.OSChoice != "" {
+		t.Errorf("Expected the defaults of containers/image to be used, got %+v", sysCtx)
+	}
+}
+
+func TestNewSystemContextInvalidCreds(t *testing.T) {
+	for _, creds := range []string{"user", ":password"} {
+		if _, err := runSystemContext(t, "--creds", creds); err == nil {
+			t.Errorf("Expected an error for the credentials %q", creds)
+		}
+	}
+}
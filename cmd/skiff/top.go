@@ -2,11 +2,13 @@ package main
 
 import (
 	"archive/tar"
+	"cmp"
 	"container/heap"
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"os"
+	"path"
 	"path/filepath"
 	"slices"
 	"strconv"
@@ -15,8 +17,6 @@ import (
 
 	"github.com/opencontainers/go-digest"
 	"github.com/urfave/cli/v3"
-	"go.podman.io/image/v5/pkg/blobinfocache/none"
-	"go.podman.io/image/v5/pkg/compression"
 	"go.podman.io/image/v5/types"
 
 	skiff "github.com/dcermak/skiff/pkg"
@@ -27,12 +27,59 @@ var topCommand = cli.Command{
 	Usage:     "Analyze a container image and list files by size",
 	ArgsUsage: "[image]",
 	Flags: []cli.Flag{
-		&cli.BoolFlag{Name: "include-pseudo", Usage: "Include pseudo-filesystems (/dev, /proc, /sys)"},
-		&cli.BoolFlag{Name: "follow-symlinks", Usage: "Follow symbolic links"},
+		&cli.BoolFlag{Name: "include-pseudo", Usage: "Include pseudo-filesystems (/dev, /proc, /sys), which are excluded by default"},
+		&cli.BoolFlag{Name: "follow-symlinks", Usage: "Follow symbolic links and list links to files with the size of their target"},
 		&cli.BoolFlag{
 			Name:  "human-readable",
 			Usage: "Show file sizes in human readable format",
 		},
+		&cli.BoolFlag{
+			Name:  "merged",
+			Usage: "Apply the layers on top of each other and only list files present in the final root filesystem",
+		},
+		&cli.IntFlag{
+			Name:  "limit",
+			Usage: "Number of files to list, 0 lists all files",
+			Value: defaultFileLimit,
+		},
+		&cli.StringFlag{
+			Name:  "min-size",
+			Usage: "Only list files that are at least this large (e.g. 10MB)",
+		},
+		&cli.StringFlag{
+			Name:  "sort",
+			Usage: "Sort files by size (largest first), path or layer (bottom layer first)",
+			Value: sortBySize,
+			Validator: func(s string) error {
+				if _, ok := fileOrders[s]; !ok {
+					return fmt.Errorf("invalid sort order %q, must be one of size, path or layer", s)
+				}
+				return nil
+			},
+		},
+		&cli.BoolFlag{
+			Name:  "reverse",
+			Usage: "Reverse the sort order",
+		},
+		&cli.BoolFlag{
+			Name:  "by-directory",
+			Usage: "Aggregate the file sizes into the directories containing them and list the largest directories",
+		},
+		&cli.IntFlag{
+			Name:  "depth",
+			Usage: "Only list directories up to this depth with --by-directory (e.g. 2 for /usr/lib), 0 lists directories of any depth",
+		},
+		&cli.BoolFlag{
+			Name:  "list-links",
+			Usage: "List the paths of all hard links to a file below it",
+		},
+		&cli.BoolFlag{
+			Name:  "package",
+			Usage: "Show the package that owns each file according to the package database of the image",
+		},
+		&jobsFlag,
+		&allPlatformsFlag,
+		&quietFlag,
 		&cli.StringSliceFlag{
 			Name:    "layer",
 			Usage:   "Filter results to specific layer(s) by diffID (uncompressed SHA256). If not specified, all layers are included (not an empty result).",
@@ -48,42 +95,359 @@ var topCommand = cli.Command{
 			return fmt.Errorf("image URL is required")
 		}
 
-		humanReadable := c.Bool("human-readable")
-		layers := c.StringSlice("layer")
-		if c.IsSet("layer") && len(layers) == 0 {
+		opts := topOptions{
+			Layers:         c.StringSlice("layer"),
+			HumanReadable:  c.Bool("human-readable"),
+			Merged:         c.Bool("merged"),
+			Limit:          c.Int("limit"),
+			Order:          fileOrders[c.String("sort")],
+			Reverse:        c.Bool("reverse"),
+			ByDirectory:    c.Bool("by-directory"),
+			Depth:          c.Int("depth"),
+			Format:         c.String("format"),
+			Jobs:           c.Int("jobs"),
+			ListLinks:      c.Bool("list-links"),
+			FollowSymlinks: c.Bool("follow-symlinks"),
+			IncludePseudo:  c.Bool("include-pseudo"),
+			Packages:       c.Bool("package"),
+		}
+		if c.IsSet("layer") && len(opts.Layers) == 0 {
 			return fmt.Errorf("--layer flag provided but no diffID specified; please provide at least one diffID")
 		}
+		if opts.Limit < 0 {
+			return fmt.Errorf("--limit must not be negative")
+		}
+		if opts.Depth < 0 {
+			return fmt.Errorf("--depth must not be negative")
+		}
+		if opts.ByDirectory && c.String("sort") == sortByLayer {
+			return fmt.Errorf("directories cannot be sorted by layer")
+		}
+		if c.IsSet("min-size") {
+			minSize, err := skiff.ParseHumanReadableSize(c.String("min-size"))
+			if err != nil {
+				return err
+			}
+			opts.MinSize = minSize
+		}
+
+		sysCtx, err := newSystemContext(c)
+		if err != nil {
+			return err
+		}
+		if err := checkAllPlatforms(c); err != nil {
+			return err
+		}
 
-		sysCtx := types.SystemContext{}
+		opts.Progress = newLayerProgress(c)
+		if opts.Progress != nil {
+			ctx = skiff.WithProgressReporter(ctx, opts.Progress)
+			defer opts.Progress.Wait()
+		}
+
+		if c.Bool(allPlatformsFlag.Name) {
+			if opts.Format != formatTable {
+				return fmt.Errorf("--%s does not support the output format %s", allPlatformsFlag.Name, opts.Format)
+			}
+			return analyzeAllPlatforms(ctx, sysCtx, image, opts, c.Writer)
+		}
 
-		return analyzeLayers(ctx, &sysCtx, image, layers, humanReadable)
+		return analyzeLayers(ctx, sysCtx, image, opts, c.Writer)
 	},
 }
 
+// analyzeAllPlatforms runs analyzeLayers for the image of every platform of
+// a multi-arch image.
+func analyzeAllPlatforms(ctx context.Context, sysCtx *types.SystemContext, uri string, opts topOptions, output io.Writer) error {
+	platforms, err := skiff.ImagePlatforms(ctx, sysCtx, uri)
+	if err != nil {
+		return err
+	}
+
+	for i, p := range platforms {
+		if i > 0 {
+			fmt.Fprintln(output)
+		}
+		fmt.Fprintf(output, "Platform: %s\n", skiff.FormatPlatform(p))
+		if err := analyzeLayers(ctx, skiff.WithPlatform(sysCtx, p), uri, opts, output); err != nil {
+			return fmt.Errorf("platform %s: %w", skiff.FormatPlatform(p), err)
+		}
+	}
+	return nil
+}
+
 const defaultFileLimit = 10
 
+// defaultJobs is the default number of layers that are read concurrently
+const defaultJobs = 4
+
+var jobsFlag = cli.IntFlag{
+	Name:  "jobs",
+	Usage: "Number of layers to download and read concurrently",
+	Value: defaultJobs,
+	Validator: func(jobs int) error {
+		if jobs < 1 {
+			return fmt.Errorf("--jobs must be at least 1")
+		}
+		return nil
+	},
+}
+
+const (
+	sortBySize  = "size"
+	sortByPath  = "path"
+	sortByLayer = "layer"
+)
+
+// fileOrders maps the values of the --sort flag to comparison functions that
+// return a negative number if a should be listed before b
+var fileOrders = map[string]func(a, b FileInfo) int{
+	sortBySize: func(a, b FileInfo) int {
+		return cmp.Or(cmp.Compare(b.Size, a.Size), strings.Compare(a.Path, b.Path))
+	},
+	sortByPath: func(a, b FileInfo) int {
+		return cmp.Or(strings.Compare(a.Path, b.Path), cmp.Compare(a.Layer, b.Layer))
+	},
+	sortByLayer: func(a, b FileInfo) int {
+		return cmp.Or(cmp.Compare(a.Layer, b.Layer), cmp.Compare(b.Size, a.Size), strings.Compare(a.Path, b.Path))
+	},
+}
+
+// topOptions configures which files analyzeLayers lists and how
+type topOptions struct {
+	// Layers restricts the files to the layers with these (partial) diffIDs
+	Layers        []string
+	HumanReadable bool
+	// Merged lists only the files of the final root filesystem
+	Merged bool
+	// Limit is the maximum number of files to list, 0 lists all files
+	Limit int
+	// MinSize is the minimum size of listed files (or directories)
+	MinSize int64
+	// Order is the comparison function that sorts the files, files are
+	// sorted by size if nil
+	Order   func(a, b FileInfo) int
+	Reverse bool
+	// ByDirectory lists directories with the accumulated size of all files
+	// below them instead of individual files
+	ByDirectory bool
+	// Depth is the maximum depth of the listed directories, 0 lists all
+	// directories
+	Depth  int
+	Format string
+	// Jobs is the number of layers that are read concurrently, at least one
+	// layer is read at a time
+	Jobs int
+	// ListLinks lists the paths of the hard links to every file
+	ListLinks bool
+	// FollowSymlinks lists symbolic links to regular files with the size
+	// of the file they point to in the merged filesystem
+	FollowSymlinks bool
+	// IncludePseudo includes the files below /dev, /proc and /sys
+	IncludePseudo bool
+	// Packages shows the package that owns every file
+	Packages bool
+	// Progress shows the progress of reading the layers, it is nil if
+	// progress bars are disabled
+	Progress *layerProgress
+}
+
+// directoryUsage accumulates the size of files in the directories containing
+// them, including all parent directories
+type directoryUsage struct {
+	maxDepth int
+	sizes    map[string]int64
+	files    map[string]int
+}
+
+func newDirectoryUsage(maxDepth int) *directoryUsage {
+	return &directoryUsage{maxDepth: maxDepth, sizes: map[string]int64{}, files: map[string]int{}}
+}
+
+// add adds a file to every directory above it (except for the root
+// directory) that is not deeper than the maximum depth.
+func (d *directoryUsage) add(path string, size int64) {
+	for dir := filepath.Dir(path); dir != "/" && dir != "."; dir = filepath.Dir(dir) {
+		if d.maxDepth > 0 && strings.Count(dir, "/") > d.maxDepth {
+			continue
+		}
+		d.sizes[dir] += size
+		d.files[dir]++
+	}
+}
+
 type FileInfo struct {
 	Path              string
 	Size              int64
 	HumanReadableSize string
 	DiffID            digest.Digest // diffID of the layer this file belongs to
+	Layer             int           // index of the layer this file belongs to
+	// Links contains the paths of the other hard links to the file
+	Links []string
+	// Package is the name of the package that owns the file
+	Package string
+}
+
+// pseudoFilesystems are the mount points of filesystems that the container
+// runtime provides, files below them in an image are usually leftovers
+var pseudoFilesystems = []string{"/dev", "/proc", "/sys"}
+
+// isPseudoPath returns true if p is one of the pseudoFilesystems or below one
+func isPseudoPath(p string) bool {
+	return slices.ContainsFunc(pseudoFilesystems, func(dir string) bool {
+		return p == dir || strings.HasPrefix(p, dir+"/")
+	})
+}
+
+// symlinkTarget returns the path that a symbolic link points to. Relative
+// targets are appended to the directory containing the link without cleaning
+// the result, so that Filesystem.Resolve resolves `..` after following links.
+func symlinkTarget(entry skiff.FileEntry) string {
+	if path.IsAbs(entry.Linkname) {
+		return entry.Linkname
+	}
+	return path.Dir(entry.Path) + "/" + entry.Linkname
+}
+
+// linkTarget returns the absolute path of the file that a hard link points to
+func linkTarget(entry skiff.FileEntry) string {
+	return filepath.Join("/", entry.Linkname)
+}
+
+// hardlinks returns the paths of the hard links in the entries of a layer
+// grouped by the path of the regular file they point to. Hard links to files
+// outside of the layer are ignored, as the bytes of the file belong to
+// another layer.
+func hardlinks(entries []skiff.FileEntry) map[string][]string {
+	byPath := make(map[string]skiff.FileEntry, len(entries))
+	for _, entry := range entries {
+		byPath[entry.Path] = entry
+	}
+
+	links := map[string][]string{}
+	for _, entry := range entries {
+		if entry.Typeflag != tar.TypeLink {
+			continue
+		}
+		// archives should only link to regular files, but follow links
+		// to links anyway (at most once per entry to not loop forever)
+		target := linkTarget(entry)
+		for range entries {
+			t, ok := byPath[target]
+			if !ok || t.Typeflag != tar.TypeLink {
+				break
+			}
+			target = linkTarget(t)
+		}
+		if t, ok := byPath[target]; ok && t.IsRegular() {
+			links[target] = append(links[target], entry.Path)
+		}
+	}
+	for _, paths := range links {
+		slices.Sort(paths)
+	}
+	return links
+}
+
+// mergedHardlinks returns the paths of the hard links in the merged
+// filesystem grouped by the path that the size of their content is
+// attributed to. Like in hardlinks, only links to files of the same layer are
+// taken into account.
+//
+// Usually, the size is attributed to the regular file that the links point
+// to. If an upper layer removed or replaced that file, its content is still
+// reachable via the links, so it is attributed to the first surviving link
+// (sorted by path) instead and orphans contains the size of the file by the
+// path of that link.
+func mergedHardlinks(fs *skiff.Filesystem) (links map[string][]string, orphans map[string]int64) {
+	links = map[string][]string{}
+	var lost []*skiff.Node
+	_ = fs.Walk(func(n *skiff.Node) error {
+		if n.Entry.Typeflag != tar.TypeLink {
+			return nil
+		}
+		if t := fs.Lookup(linkTarget(n.Entry)); t != nil && t.Layer == n.Layer {
+			if t.Entry.IsRegular() {
+				links[t.Entry.Path] = append(links[t.Entry.Path], n.Entry.Path)
+			}
+			return nil
+		}
+		lost = append(lost, n)
+		return nil
+	})
+	for _, paths := range links {
+		slices.Sort(paths)
+	}
+
+	orphans = map[string]int64{}
+	if len(lost) == 0 {
+		return links, orphans
+	}
+
+	// the regular files that are gone, by their path and layer
+	type origin struct {
+		path  string
+		layer int
+	}
+	gone := map[origin]skiff.FileEntry{}
+	for _, f := range fs.Shadowed() {
+		if f.IsRegular() {
+			gone[origin{f.Path, f.Layer}] = f.FileEntry
+		}
+	}
+	survivors := map[origin][]string{}
+	for _, n := range lost {
+		o := origin{linkTarget(n.Entry), n.Layer}
+		if _, ok := gone[o]; ok {
+			survivors[o] = append(survivors[o], n.Entry.Path)
+		}
+	}
+	for o, paths := range survivors {
+		slices.Sort(paths)
+		orphans[paths[0]] = gone[o].Size
+		if len(paths) > 1 {
+			links[paths[0]] = paths[1:]
+		}
+	}
+	return links, orphans
 }
 
-type FileHeap []FileInfo
+// formatTotalSize formats a byte count for summary lines below a table
+func formatTotalSize(size int64, humanReadable bool) string {
+	if humanReadable {
+		return skiff.HumanReadableSize(size)
+	}
+	return fmt.Sprintf("%d bytes", size)
+}
 
-func (h FileHeap) Len() int           { return len(h) }
-func (h FileHeap) Less(i, j int) bool { return h[i].Size < h[j].Size }
-func (h FileHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+// FileHeap keeps the file that is listed last on top, so that popping it
+// leaves the files that are listed first in the heap.
+type FileHeap struct {
+	Files []FileInfo
+	// Order returns a negative number if a is listed before b, files are
+	// ordered by size (largest first) if nil
+	Order func(a, b FileInfo) int
+}
+
+func (h FileHeap) Len() int { return len(h.Files) }
+func (h FileHeap) Less(i, j int) bool {
+	order := h.Order
+	if order == nil {
+		order = fileOrders[sortBySize]
+	}
+	return order(h.Files[i], h.Files[j]) > 0
+}
+func (h FileHeap) Swap(i, j int) { h.Files[i], h.Files[j] = h.Files[j], h.Files[i] }
 
 func (h *FileHeap) Push(x interface{}) {
-	*h = append(*h, x.(FileInfo))
+	h.Files = append(h.Files, x.(FileInfo))
 }
 
 func (h *FileHeap) Pop() interface{} {
-	old := *h
+	old := h.Files
 	n := len(old)
 	item := old[n-1]
-	*h = old[0 : n-1]
+	h.Files = old[0 : n-1]
 	return item
 }
 
@@ -123,115 +487,264 @@ func getLayersByDiffID(manifestLayers []types.BlobInfo, allDiffIDs []digest.Dige
 
 // analyzeLayers fetches layers for a given image reference
 // reads the associated layer archives and lists file info
-func analyzeLayers(ctx context.Context, sysCtx *types.SystemContext, uri string, layers []string, humanReadable bool) error {
-	// represents an image from any transport (docker://, containers-storage://, etc.)
-	img, _, err := skiff.ImageAndLayersFromURI(ctx, sysCtx, uri)
+//
+// If opts.Merged is true, then the layers are applied on top of each other and
+// only the files present in the final root filesystem are listed. The size of
+// the files that were overwritten or deleted by upper layers is reported
+// separately.
+//
+// If opts.Limit is set, then only that many files are kept in memory while
+// the layers are read.
+func analyzeLayers(ctx context.Context, sysCtx *types.SystemContext, uri string, opts topOptions, output io.Writer) error {
+	imgLayers, err := skiff.OpenImageLayers(ctx, sysCtx, uri)
 	if err != nil {
 		return err
 	}
+	defer imgLayers.Close()
 
-	// image source that helps us fetch layers to eventually show files from the stream
-	imgSrc, err := img.Reference().NewImageSource(ctx, sysCtx)
+	// Get the diffIDs of the filtered layers
+	_, diffIDs, err := getLayersByDiffID(imgLayers.Blobs, imgLayers.DiffIDs, opts.Layers)
 	if err != nil {
 		return err
 	}
-	defer imgSrc.Close()
 
-	// Get transport-specific layer blob infos
-	manifestLayers, err := skiff.BlobInfoFromImage(ctx, sysCtx, img)
-	if err != nil {
-		return fmt.Errorf("failed to get blob info from image: %w", err)
+	order := opts.Order
+	if order == nil {
+		order = fileOrders[sortBySize]
+	}
+	if opts.Reverse {
+		forward := order
+		order = func(a, b FileInfo) int { return forward(b, a) }
 	}
 
-	conf, err := img.OCIConfig(ctx)
-	allDiffIDs := []digest.Digest{}
+	h := &FileHeap{Order: order}
+	heap.Init(h)
 
-	// only get them if the rootfs type is correct
-	if err == nil && conf != nil && conf.RootFS.Type == "layers" {
-		allDiffIDs = conf.RootFS.DiffIDs
+	// fs is the merged filesystem, it is needed with --merged, to resolve
+	// symbolic links and to read the package database
+	var fs *skiff.Filesystem
+	// owners maps the paths of files to the packages that own them
+	var owners map[string]string
+	noPackageDatabase := false
+	readOwners := func() error {
+		if !opts.Packages {
+			return nil
+		}
+		packages, err := imgLayers.Packages(ctx, fs, opts.Jobs)
+		if errors.Is(err, skiff.ErrNoPackageDatabase) {
+			noPackageDatabase = true
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		owners = skiff.PackageOwners(packages.Packages)
+		return nil
 	}
 
-	// Check that manifestLayers and allDiffIDs have matching lengths
-	if len(manifestLayers) != len(allDiffIDs) {
-		return fmt.Errorf("manifestLayers (%d) and allDiffIDs (%d) length mismatch", len(manifestLayers), len(allDiffIDs))
+	pushFile := func(path string, size int64, diffID digest.Digest, layer int, links []string) {
+		if size < opts.MinSize {
+			return
+		}
+		fileInfo := FileInfo{
+			Path:    path,
+			Size:    size,
+			DiffID:  diffID,
+			Layer:   layer,
+			Links:   links,
+			Package: owners[path],
+		}
+		if opts.HumanReadable {
+			fileInfo.HumanReadableSize = skiff.HumanReadableSize(size)
+		}
+		heap.Push(h, fileInfo)
+		if opts.Limit > 0 && h.Len() > opts.Limit {
+			heap.Pop(h)
+		}
 	}
 
-	// Get filtered layers and their diffIDs
-	layerInfos, diffIDs, err := getLayersByDiffID(manifestLayers, allDiffIDs, layers)
-	if err != nil {
-		return err
+	addFile := pushFile
+	if !opts.IncludePseudo {
+		addFile = func(path string, size int64, diffID digest.Digest, layer int, links []string) {
+			if !isPseudoPath(path) {
+				pushFile(path, size, diffID, layer, links)
+			}
+		}
+	}
+	var dirs *directoryUsage
+	if opts.ByDirectory {
+		dirs = newDirectoryUsage(opts.Depth)
+		// the size of files with several hard links is only added to
+		// the directory containing the file itself
+		addFile = func(path string, size int64, _ digest.Digest, _ int, _ []string) {
+			if opts.IncludePseudo || !isPseudoPath(path) {
+				dirs.add(path, size)
+			}
+		}
 	}
 
-	h := &FileHeap{}
-	heap.Init(h)
+	var loops []string
+	addSymlink := func(entry skiff.FileEntry, diffID digest.Digest, layer int) {
+		target, err := fs.Resolve(symlinkTarget(entry))
+		if errors.Is(err, skiff.ErrSymlinkLoop) {
+			loops = append(loops, entry.Path)
+			return
+		}
+		if target != nil && target.Entry.IsRegular() {
+			addFile(entry.Path, target.Entry.Size, diffID, layer, nil)
+		}
+	}
 
-	for i, layer := range layerInfos {
-		blob, _, err := imgSrc.GetBlob(context.Background(), layer, none.NoCache)
+	var shadowed []skiff.ShadowedFile
+	if opts.Merged {
+		// the merged filesystem needs all layers, the layer filter only
+		// restricts which files are shown
+		fs, err = imgLayers.Merge(ctx, opts.Jobs, false)
 		if err != nil {
 			return err
 		}
-		defer blob.Close()
+		if err := readOwners(); err != nil {
+			return err
+		}
 
-		uncompressedStream, _, err := compression.AutoDecompress(blob)
+		links, orphans := mergedHardlinks(fs)
+		err = fs.Walk(func(n *skiff.Node) error {
+			if !slices.Contains(diffIDs, n.DiffID) {
+				return nil
+			}
+			switch {
+			case n.Entry.IsRegular():
+				addFile(n.Entry.Path, n.Entry.Size, n.DiffID, n.Layer, links[n.Entry.Path])
+			case n.Entry.Typeflag == tar.TypeLink:
+				if size, ok := orphans[n.Entry.Path]; ok {
+					addFile(n.Entry.Path, size, n.DiffID, n.Layer, links[n.Entry.Path])
+				}
+			case n.Entry.Typeflag == tar.TypeSymlink && opts.FollowSymlinks:
+				addSymlink(n.Entry, n.DiffID, n.Layer)
+			}
+			return nil
+		})
 		if err != nil {
-			return fmt.Errorf("auto-decompressing input: %w", err)
+			return err
 		}
-		defer uncompressedStream.Close()
 
-		// Get the diffID for this layer
-		layerDiffID := diffIDs[i]
-
-		tr := tar.NewReader(uncompressedStream)
-		for {
-			hdr, err := tr.Next()
-			if err == io.EOF {
-				break
-			}
-			if err != nil {
-				return fmt.Errorf("failed to read tar header: %w", err)
+		for _, f := range fs.Shadowed() {
+			if slices.Contains(diffIDs, f.DiffID) {
+				shadowed = append(shadowed, f)
 			}
+		}
+	} else {
+		layerIndexes := make([]int, len(diffIDs))
+		for i, diffID := range diffIDs {
+			layerIndexes[i] = slices.Index(imgLayers.DiffIDs, diffID)
+		}
 
-			// TODO(danishprakash): follow symlinks
-			// if hdr.Typeflag == tar.TypeSymlink
+		// the layers are read concurrently, but their files are added
+		// in the order of the layers so that the output does not depend
+		// on which layer finished first
+		addLayer := func(layer int, entries []skiff.FileEntry) error {
+			links := hardlinks(entries)
+			diffID := imgLayers.DiffIDs[layer]
+			for _, entry := range entries {
+				switch {
+				case entry.IsRegular():
+					addFile(entry.Path, entry.Size, diffID, layer, links[entry.Path])
+				case entry.Typeflag == tar.TypeSymlink && opts.FollowSymlinks:
+					addSymlink(entry, diffID, layer)
+				}
+			}
+			return nil
+		}
 
-			path, err := filepath.Abs(filepath.Join("/", hdr.Name))
+		if opts.FollowSymlinks || opts.Packages {
+			// symbolic links are resolved and the package database
+			// is read in the merged filesystem, which needs the
+			// entries of all layers before any file can be added
+			allEntries, err := imgLayers.ReadEntries(ctx, nil, opts.Jobs, false)
 			if err != nil {
-				// Log the error but continue processing other files
-				fmt.Fprintf(os.Stderr, "warning: error generating absolute representation of path %s: %v\n", hdr.Name, err)
-				continue
+				return err
 			}
-
-			if hdr.Typeflag == tar.TypeReg {
-				fileInfo := FileInfo{
-					Path:   path,
-					Size:   hdr.Size,
-					DiffID: layerDiffID,
-				}
-				if humanReadable {
-					fileInfo.HumanReadableSize = skiff.HumanReadableSize(hdr.Size)
-				}
-				heap.Push(h, fileInfo)
-				if h.Len() > defaultFileLimit {
-					heap.Pop(h)
+			fs = skiff.NewFilesystem()
+			for i, entries := range allEntries {
+				fs.ApplyLayer(imgLayers.DiffIDs[i], entries)
+			}
+			if err := readOwners(); err != nil {
+				return err
+			}
+			for _, layer := range layerIndexes {
+				if err := addLayer(layer, allEntries[layer]); err != nil {
+					return err
 				}
 			}
+		} else {
+			// the entries of every layer are dropped once its files
+			// have been added, so that only the files in the heap
+			// are kept with --limit
+			if err := imgLayers.StreamEntries(ctx, layerIndexes, opts.Jobs, false, addLayer); err != nil {
+				return err
+			}
 		}
 	}
 
-	// Extract files from heap in reverse order (largest first)
+	// all layers have been read, remove the progress bars before the
+	// results are written
+	opts.Progress.Wait()
+
+	if opts.ByDirectory {
+		for dir, size := range dirs.sizes {
+			pushFile(dir, size, "", 0, nil)
+		}
+	}
+
+	// Extract files from heap in reverse order (first listed file last)
 	var files []FileInfo
 	for h.Len() > 0 {
 		files = append(files, heap.Pop(h).(FileInfo))
 	}
 
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.TabIndent)
-	defer w.Flush()
-	fmt.Fprintln(w, "FILE PATH\tSIZE\tDIFF ID")
-
 	slices.Reverse(files)
+
+	if opts.ByDirectory {
+		if err := writeDirectoryUsage(output, opts, files, dirs); err != nil {
+			return err
+		}
+		return writeSymlinkLoops(output, opts, loops)
+	}
+
+	var shadowedSize int64
+	for _, f := range shadowed {
+		shadowedSize += f.Size
+	}
+
+	if opts.Format != formatTable {
+		reports := make([]skiff.FileReport, 0, len(files))
+		for _, f := range files {
+			reports = append(reports, skiff.FileReport{Path: f.Path, Size: f.Size, DiffID: f.DiffID, HardLinks: f.Links, Package: f.Package})
+		}
+		// templates are rendered per file, so they only get the
+		// file rows and not the summary of the shadowed files
+		if opts.Merged && !isTemplate(opts.Format) {
+			return writeMergedReport(output, opts.Format, reports, skiff.ShadowedReport{Files: len(shadowed), Size: shadowedSize})
+		}
+		return writeReport(output, opts.Format, reports)
+	}
+
+	// the number of links is only shown if it is relevant for any file
+	showLinks := slices.ContainsFunc(files, func(f FileInfo) bool { return len(f.Links) > 0 })
+
+	w := tabwriter.NewWriter(output, 0, 0, 2, ' ', tabwriter.TabIndent)
+	header := []string{"FILE PATH", "SIZE", "DIFF ID"}
+	if showLinks {
+		header = append(header, "LINKS")
+	}
+	if opts.Packages {
+		header = append(header, "PACKAGE")
+	}
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+
 	for _, f := range files {
 		var size string
-		if humanReadable {
+		if opts.HumanReadable {
 			size = f.HumanReadableSize
 		} else {
 			size = strconv.FormatInt(f.Size, 10)
@@ -242,7 +755,80 @@ func analyzeLayers(ctx context.Context, sysCtx *types.SystemContext, uri string,
 		if len(diffIDDisplay) > 12 {
 			diffIDDisplay = diffIDDisplay[:12]
 		}
-		fmt.Fprintf(w, "%s\t%s\t%s\n", f.Path, size, diffIDDisplay)
+		row := []string{f.Path, size, diffIDDisplay}
+		if showLinks {
+			row = append(row, strconv.Itoa(len(f.Links)+1))
+		}
+		if opts.Packages {
+			row = append(row, cmp.Or(f.Package, "-"))
+		}
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+		if showLinks && opts.ListLinks {
+			for _, link := range f.Links {
+				fmt.Fprintf(w, "  ↳ %s%s\n", link, strings.Repeat("\t", len(header)-1))
+			}
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if opts.Merged {
+		fmt.Fprintf(output, "\nShadowed: %d files, %s overwritten or deleted by upper layers\n", len(shadowed), formatTotalSize(shadowedSize, opts.HumanReadable))
+	}
+	if noPackageDatabase {
+		fmt.Fprintln(output, "\nNo package database found, files are not attributed to packages")
+	}
+	return writeSymlinkLoops(output, opts, loops)
+}
+
+// writeMergedReport writes the files of the merged filesystem together with
+// the summary of the shadowed files. JSON and YAML wrap both in a
+// MergedFilesReport, CSV appends the summary as a second table after an empty
+// line.
+func writeMergedReport(output io.Writer, format string, files []skiff.FileReport, shadowed skiff.ShadowedReport) error {
+	if format != formatCSV {
+		return writeReport(output, format, skiff.MergedFilesReport{Files: files, Shadowed: shadowed})
+	}
+	if err := writeCSV(output, files); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(output); err != nil {
+		return err
+	}
+	return writeCSV(output, []skiff.ShadowedReport{shadowed})
+}
+
+// writeSymlinkLoops prints the symbolic links that were skipped by
+// analyzeLayers because they could not be resolved.
+func writeSymlinkLoops(output io.Writer, opts topOptions, loops []string) error {
+	if opts.Format != formatTable || len(loops) == 0 {
+		return nil
+	}
+	_, err := fmt.Fprintf(output, "\nSkipped %d symbolic links that form a loop: %s\n", len(loops), strings.Join(loops, ", "))
+	return err
+}
+
+// writeDirectoryUsage prints the directories that were selected by
+// analyzeLayers with the number of files below them.
+func writeDirectoryUsage(output io.Writer, opts topOptions, dirs []FileInfo, usage *directoryUsage) error {
+	if opts.Format != formatTable {
+		reports := make([]skiff.DirectoryReport, 0, len(dirs))
+		for _, d := range dirs {
+			reports = append(reports, skiff.DirectoryReport{Path: d.Path, Size: d.Size, Files: usage.files[d.Path]})
+		}
+		return writeReport(output, opts.Format, reports)
+	}
+
+	w := tabwriter.NewWriter(output, 0, 0, 2, ' ', tabwriter.TabIndent)
+	defer w.Flush()
+	fmt.Fprintln(w, "DIRECTORY\tSIZE\tFILES")
+	for _, d := range dirs {
+		size := strconv.FormatInt(d.Size, 10)
+		if opts.HumanReadable {
+			size = d.HumanReadableSize
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\n", d.Path, size, usage.files[d.Path])
 	}
 	return nil
 }
@@ -1,6 +1,10 @@
 package main
 
 import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -10,6 +14,7 @@ import (
 	"go.podman.io/image/v5/types"
 
 	skiff "github.com/dcermak/skiff/pkg"
+	"github.com/dcermak/skiff/pkg/imagetest"
 )
 
 func TestHumanReadableSize(t *testing.T) {
@@ -39,6 +44,56 @@ func TestHumanReadableSize(t *testing.T) {
 	}
 }
 
+func TestParseHumanReadableSize(t *testing.T) {
+	tests := []struct {
+		input       string
+		expected    int64
+		expectError bool
+	}{
+		{"0", 0, false},
+		{"500", 500, false},
+		{"500 B", 500, false},
+		{"1.5 kB", 1500, false},
+		{"10MB", 10000000, false},
+		{"10mb", 10000000, false},
+		{"1.2 GB", 1200000000, false},
+		{"2G", 2000000000, false},
+		{"1KiB", 1024, false},
+		{"1 MiB", 1048576, false},
+		{"", 0, true},
+		{"MB", 0, true},
+		{"-1MB", 0, true},
+		{"10 XB", 0, true},
+		{"10 KBB", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := skiff.ParseHumanReadableSize(tt.input)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected an error for %q, got %d", tt.input, result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("ParseHumanReadableSize(%q) = %d, want %d", tt.input, result, tt.expected)
+			}
+		})
+	}
+
+	// ParseHumanReadableSize should be the inverse of HumanReadableSize
+	for _, size := range []int64{0, 999, 1500, 2400000, 7800000000} {
+		parsed, err := skiff.ParseHumanReadableSize(skiff.HumanReadableSize(size))
+		if err != nil || parsed != size {
+			t.Errorf("ParseHumanReadableSize(HumanReadableSize(%d)) = %d, %v", size, parsed, err)
+		}
+	}
+}
+
 func TestFileHeap(t *testing.T) {
 	h := &FileHeap{}
 	heap.Init(h)
@@ -89,6 +144,41 @@ func TestFileHeap(t *testing.T) {
 	}
 }
 
+func TestFileHeapOrder(t *testing.T) {
+	files := []FileInfo{
+		{Path: "/b", Size: 100, Layer: 1},
+		{Path: "/a", Size: 50, Layer: 0},
+		{Path: "/c", Size: 200, Layer: 0},
+	}
+
+	tests := []struct {
+		order    string
+		expected []string
+	}{
+		{sortBySize, []string{"/c", "/b", "/a"}},
+		{sortByPath, []string{"/a", "/b", "/c"}},
+		{sortByLayer, []string{"/c", "/a", "/b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.order, func(t *testing.T) {
+			h := &FileHeap{Order: fileOrders[tt.order]}
+			for _, f := range files {
+				heap.Push(h, f)
+			}
+
+			// the heap pops the file that is listed last first
+			var paths []string
+			for h.Len() > 0 {
+				paths = append([]string{heap.Pop(h).(FileInfo).Path}, paths...)
+			}
+			if strings.Join(paths, " ") != strings.Join(tt.expected, " ") {
+				t.Errorf("Expected files in order %v, got %v", tt.expected, paths)
+			}
+		})
+	}
+}
+
 func TestGetLayersByDiffID(t *testing.T) {
 	// Create test layers
 	layer1 := types.BlobInfo{Digest: digest.Digest("sha256:layer1digest")}
@@ -178,3 +268,291 @@ func TestGetLayersByDiffID(t *testing.T) {
 		})
 	}
 }
+
+func TestDirectoryUsage(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxDepth int
+		expected map[string]int64
+	}{
+		{"unlimited depth", 0, map[string]int64{
+			"/usr":                    350,
+			"/usr/lib64":              300,
+			"/usr/lib64/python3.11":   300,
+			"/usr/lib64/python3.11/x": 100,
+			"/usr/share":              50,
+		}},
+		{"depth 2", 2, map[string]int64{
+			"/usr":       350,
+			"/usr/lib64": 300,
+			"/usr/share": 50,
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDirectoryUsage(tt.maxDepth)
+			d.add("/usr/lib64/python3.11/a.py", 200)
+			d.add("/usr/lib64/python3.11/x/b.py", 100)
+			d.add("/usr/share/doc", 50)
+			d.add("/top-level-file", 1000)
+
+			if len(d.sizes) != len(tt.expected) {
+				t.Errorf("Expected directories %v, got %v", tt.expected, d.sizes)
+			}
+			for dir, size := range tt.expected {
+				if d.sizes[dir] != size {
+					t.Errorf("Expected %s to have size %d, got %d", dir, size, d.sizes[dir])
+				}
+			}
+			if d.files["/usr/lib64"] != 2 {
+				t.Errorf("Expected 2 files below /usr/lib64, got %d", d.files["/usr/lib64"])
+			}
+		})
+	}
+}
+
+func TestAnalyzeLayersTransports(t *testing.T) {
+	img := imagetest.Image{Layers: []imagetest.Layer{
+		{Files: []imagetest.File{
+			{Path: "usr/bin/big", Content: strings.Repeat("x", 300)},
+			{Path: "usr/bin/small", Content: "x"},
+		}},
+		{Files: []imagetest.File{
+			{Path: "usr/bin/.wh.big"},
+			{Path: "opt/app", Content: strings.Repeat("x", 20)},
+		}},
+	}}
+	base, update := img.Layers[0].DiffID(t).Encoded()[:12], img.Layers[1].DiffID(t).Encoded()[:12]
+
+	for name, uri := range imagetest.WriteAllTransports(t, img) {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := analyzeLayers(context.Background(), nil, uri, topOptions{Merged: true, Format: formatTable}, &buf); err != nil {
+				t.Fatalf("analyzeLayers failed: %v", err)
+			}
+
+			expected := "FILE PATH       SIZE  DIFF ID\n" +
+				"/opt/app        20    " + update + "\n" +
+				"/usr/bin/small  1     " + base + "\n" +
+				"\nShadowed: 1 files, 300 bytes overwritten or deleted by upper layers\n"
+			if buf.String() != expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", expected, buf.String())
+			}
+		})
+	}
+}
+
+func TestAnalyzeLayersMergedFormats(t *testing.T) {
+	img := imagetest.Image{Layers: []imagetest.Layer{
+		{Files: []imagetest.File{
+			{Path: "usr/bin/big", Content: strings.Repeat("x", 300)},
+		}},
+		{Files: []imagetest.File{
+			{Path: "usr/bin/.wh.big"},
+			{Path: "opt/app", Content: strings.Repeat("x", 20)},
+		}},
+	}}
+	uri := imagetest.WriteOCILayout(t, img)
+	update := img.Layers[1].DiffID(t).String()
+
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{
+			format: formatJSON,
+			expected: `{
+  "files": [
+    {
+      "path": "/opt/app",
+      "size": 20,
+      "diffID": "` + update + `"
+    }
+  ],
+  "shadowed": {
+    "files": 1,
+    "size": 300
+  }
+}
+`,
+		},
+		{
+			format: formatYAML,
+			expected: `files:
+    - path: /opt/app
+      size: 20
+      diffID: ` + update + `
+shadowed:
+    files: 1
+    size: 300
+`,
+		},
+		{
+			format: formatCSV,
+			expected: "path,size,diffID,hardLinks,package\n" +
+				"/opt/app,20," + update + ",,\n" +
+				"\nfiles,size\n" +
+				"1,300\n",
+		},
+		{
+			// templates render the file rows only, without the
+			// shadowed summary
+			format:   "table {{.Path}}\t{{.Size}}",
+			expected: "PATH        SIZE\n/opt/app    20\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := analyzeLayers(context.Background(), nil, uri, topOptions{Merged: true, Format: tt.format}, &buf); err != nil {
+				t.Fatalf("analyzeLayers failed: %v", err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tt.expected, buf.String())
+			}
+		})
+	}
+}
+
+func TestHardlinks(t *testing.T) {
+	entries := []skiff.FileEntry{
+		{Path: "/usr/bin/perl5.36", Typeflag: tar.TypeReg, Size: 100},
+		{Path: "/usr/bin/perl", Typeflag: tar.TypeLink, Linkname: "usr/bin/perl5.36"},
+		{Path: "/usr/bin/perl-link", Typeflag: tar.TypeLink, Linkname: "usr/bin/perl"},
+		{Path: "/usr/lib/base", Typeflag: tar.TypeLink, Linkname: "usr/lib/from-lower-layer"},
+		{Path: "/loop", Typeflag: tar.TypeLink, Linkname: "loop"},
+	}
+
+	links := hardlinks(entries)
+	expected := map[string][]string{"/usr/bin/perl5.36": {"/usr/bin/perl", "/usr/bin/perl-link"}}
+	if !reflect.DeepEqual(links, expected) {
+		t.Errorf("Expected %v, got %v", expected, links)
+	}
+}
+
+func TestAnalyzeLayersHardlinks(t *testing.T) {
+	img := imagetest.Image{Layers: []imagetest.Layer{
+		{Files: []imagetest.File{
+			{Path: "usr/bin/python3.11", Content: strings.Repeat("x", 300)},
+			{Path: "usr/bin/python3", Typeflag: tar.TypeLink, Linkname: "usr/bin/python3.11"},
+			{Path: "usr/bin/small", Content: "x"},
+		}},
+	}}
+	uri := imagetest.WriteOCILayout(t, img)
+	diffID := img.Layers[0].DiffID(t).Encoded()[:12]
+
+	for _, merged := range []bool{false, true} {
+		var buf bytes.Buffer
+		opts := topOptions{Merged: merged, ListLinks: true, Format: formatTable}
+		if err := analyzeLayers(context.Background(), nil, uri, opts, &buf); err != nil {
+			t.Fatalf("analyzeLayers failed: %v", err)
+		}
+
+		expected := "FILE PATH             SIZE  DIFF ID       LINKS\n" +
+			"/usr/bin/python3.11   300   " + diffID + "  2\n" +
+			"  ↳ /usr/bin/python3                      \n" +
+			"/usr/bin/small        1     " + diffID + "  1\n"
+		if merged {
+			expected += "\nShadowed: 0 files, 0 bytes overwritten or deleted by upper layers\n"
+		}
+		if buf.String() != expected {
+			t.Errorf("Expected (merged: %t):\n%s\ngot:\n%s", merged, expected, buf.String())
+		}
+	}
+}
+
+func TestAnalyzeLayersMergedHardlinkTargetRemoved(t *testing.T) {
+	img := imagetest.Image{Layers: []imagetest.Layer{
+		{Files: []imagetest.File{
+			{Path: "usr/bin/python3.11", Content: strings.Repeat("x", 300)},
+			{Path: "usr/bin/python3", Typeflag: tar.TypeLink, Linkname: "usr/bin/python3.11"},
+			{Path: "usr/bin/python", Typeflag: tar.TypeLink, Linkname: "usr/bin/python3.11"},
+		}},
+		{Files: []imagetest.File{
+			// the content survives via the links
+			{Path: "usr/bin/.wh.python3.11"},
+		}},
+	}}
+	uri := imagetest.WriteOCILayout(t, img)
+	diffID := img.Layers[0].DiffID(t).Encoded()[:12]
+
+	var buf bytes.Buffer
+	opts := topOptions{Merged: true, ListLinks: true, Format: formatTable}
+	if err := analyzeLayers(context.Background(), nil, uri, opts, &buf); err != nil {
+		t.Fatalf("analyzeLayers failed: %v", err)
+	}
+
+	expected := "FILE PATH             SIZE  DIFF ID       LINKS\n" +
+		"/usr/bin/python       300   " + diffID + "  2\n" +
+		"  ↳ /usr/bin/python3                      \n" +
+		"\nShadowed: 1 files, 300 bytes overwritten or deleted by upper layers\n"
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+func TestAnalyzeLayersSymlinksAndPseudo(t *testing.T) {
+	img := imagetest.Image{Layers: []imagetest.Layer{
+		{Files: []imagetest.File{
+			{Path: "usr/lib/libfoo.so.1", Content: strings.Repeat("x", 100)},
+			{Path: "usr/lib/libfoo.so", Typeflag: tar.TypeSymlink, Linkname: "libfoo.so.1"},
+			{Path: "lib", Typeflag: tar.TypeSymlink, Linkname: "usr/lib"},
+			{Path: "loop", Typeflag: tar.TypeSymlink, Linkname: "/loop"},
+			{Path: "proc/leftover", Content: strings.Repeat("x", 50)},
+		}},
+		{Files: []imagetest.File{
+			// links are resolved in the merged filesystem
+			{Path: "usr/lib/libfoo.so.1", Content: strings.Repeat("x", 200)},
+			{Path: "opt/lib", Typeflag: tar.TypeSymlink, Linkname: "../lib/libfoo.so"},
+		}},
+	}}
+	uri := imagetest.WriteOCILayout(t, img)
+	base, update := img.Layers[0].DiffID(t).Encoded()[:12], img.Layers[1].DiffID(t).Encoded()[:12]
+
+	tests := []struct {
+		name     string
+		opts     topOptions
+		expected string
+	}{
+		{
+			name: "default",
+			opts: topOptions{},
+			expected: "FILE PATH             SIZE  DIFF ID\n" +
+				"/usr/lib/libfoo.so.1  200   " + update + "\n" +
+				"/usr/lib/libfoo.so.1  100   " + base + "\n",
+		},
+		{
+			name: "follow symlinks",
+			opts: topOptions{FollowSymlinks: true},
+			expected: "FILE PATH             SIZE  DIFF ID\n" +
+				"/opt/lib              200   " + update + "\n" +
+				"/usr/lib/libfoo.so    200   " + base + "\n" +
+				"/usr/lib/libfoo.so.1  200   " + update + "\n" +
+				"/usr/lib/libfoo.so.1  100   " + base + "\n" +
+				"\nSkipped 1 symbolic links that form a loop: /loop\n",
+		},
+		{
+			name: "include pseudo",
+			opts: topOptions{IncludePseudo: true},
+			expected: "FILE PATH             SIZE  DIFF ID\n" +
+				"/usr/lib/libfoo.so.1  200   " + update + "\n" +
+				"/usr/lib/libfoo.so.1  100   " + base + "\n" +
+				"/proc/leftover        50    " + base + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tt.opts.Format = formatTable
+			if err := analyzeLayers(context.Background(), nil, uri, tt.opts, &buf); err != nil {
+				t.Fatalf("analyzeLayers failed: %v", err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tt.expected, buf.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"archive/tar"
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/urfave/cli/v3"
+	"go.podman.io/image/v5/types"
+
+	skiff "github.com/dcermak/skiff/pkg"
+)
+
+var wastedCommand = cli.Command{
+	Name:  "wasted",
+	Usage: "List files that are overwritten or deleted by a later layer and the space they waste",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "human-readable",
+			Usage: "Show file sizes in human readable format",
+		},
+		&cli.BoolFlag{
+			Name:        "full-digest",
+			Usage:       "Show full digests instead of truncated (12 chars)",
+			Aliases:     []string{"full-diff-id"},
+			DefaultText: "false",
+		},
+		&jobsFlag,
+	},
+	Arguments: []cli.Argument{
+		&cli.StringArg{Name: "image", UsageText: "Container image ref"},
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		image := c.StringArg("image")
+		if image == "" {
+			return fmt.Errorf("image URL is required")
+		}
+
+		if err := requireTableFormat(c); err != nil {
+			return err
+		}
+
+		sysCtx, err := newSystemContext(c)
+		if err != nil {
+			return err
+		}
+		return showWastedSpace(ctx, sysCtx, image, c.Writer, c.Bool("human-readable"), c.Bool("full-digest"), c.Int("jobs"))
+	},
+}
+
+// wastedFiles returns the files of fs that are shadowed by an upper layer,
+// except for the regular files that a hard link from the same layer still
+// references in the merged filesystem: their content is still part of the
+// final root filesystem, just under the path of the link.
+func wastedFiles(fs *skiff.Filesystem) []skiff.ShadowedFile {
+	type origin struct {
+		path  string
+		layer int
+	}
+	referenced := map[origin]bool{}
+	_ = fs.Walk(func(n *skiff.Node) error {
+		if n.Entry.Typeflag == tar.TypeLink {
+			referenced[origin{linkTarget(n.Entry), n.Layer}] = true
+		}
+		return nil
+	})
+
+	var files []skiff.ShadowedFile
+	for _, f := range fs.Shadowed() {
+		if f.IsRegular() && referenced[origin{f.Path, f.Layer}] {
+			continue
+		}
+		files = append(files, f)
+	}
+	return files
+}
+
+// wastedSpace sums up the size of all files in the merged filesystem and of
+// all files that are shadowed by an upper layer, and the size of the wasted
+// files among them.
+func wastedSpace(fs *skiff.Filesystem) (totalSize int64, wastedSize int64) {
+	_ = fs.Walk(func(n *skiff.Node) error {
+		totalSize += n.Entry.Size
+		return nil
+	})
+	for _, f := range fs.Shadowed() {
+		totalSize += f.Size
+	}
+	for _, f := range wastedFiles(fs) {
+		wastedSize += f.Size
+	}
+	return totalSize, wastedSize
+}
+
+// efficiency returns the percentage of bytes of the image that end up in the
+// final root filesystem.
+func efficiency(totalSize, wastedSize int64) float64 {
+	if totalSize == 0 {
+		return 100
+	}
+	return float64(totalSize-wastedSize) / float64(totalSize) * 100
+}
+
+// showWastedSpace lists every file that is written in one layer and then
+// overwritten or deleted in a later layer, the layer that wrote it, the layer
+// that hid it and the bytes that it still occupies in the image. Up to jobs
+// layers are read concurrently.
+func showWastedSpace(ctx context.Context, sysCtx *types.SystemContext, uri string, output io.Writer, humanReadable bool, fullDigest bool, jobs int) error {
+	imgLayers, err := skiff.OpenImageLayers(ctx, sysCtx, uri)
+	if err != nil {
+		return err
+	}
+	defer imgLayers.Close()
+
+	fs, err := imgLayers.Merge(ctx, jobs, false)
+	if err != nil {
+		return err
+	}
+
+	formatSize := func(size int64) string {
+		if humanReadable {
+			return skiff.HumanReadableSize(size)
+		}
+		return strconv.FormatInt(size, 10)
+	}
+
+	shadowed := wastedFiles(fs)
+	slices.SortStableFunc(shadowed, func(a, b skiff.ShadowedFile) int {
+		return cmp.Or(cmp.Compare(b.Size, a.Size), strings.Compare(a.Path, b.Path))
+	})
+
+	w := tabwriter.NewWriter(output, 0, 0, 2, ' ', tabwriter.TabIndent)
+	fmt.Fprintln(w, "FILE PATH\tSIZE\tWRITTEN BY\tHIDDEN BY\tACTION")
+	for _, f := range shadowed {
+		action := "overwritten"
+		if f.Deleted {
+			action = "deleted"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			f.Path,
+			formatSize(f.Size),
+			skiff.FormatDigest(f.DiffID, fullDigest),
+			skiff.FormatDigest(f.ShadowedBy, fullDigest),
+			action,
+		)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	totalSize, wastedSize := wastedSpace(fs)
+	fmt.Fprintf(output, "\nTotal file size: %s\n", formatTotalSize(totalSize, humanReadable))
+	fmt.Fprintf(output, "Wasted space: %s\n", formatTotalSize(wastedSize, humanReadable))
+	fmt.Fprintf(output, "Image efficiency: %.2f %%\n", efficiency(totalSize, wastedSize))
+	return nil
+}
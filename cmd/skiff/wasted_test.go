@@ -0,0 +1,68 @@
+package main
+
+import (
+	"archive/tar"
+	"testing"
+
+	skiff "github.com/dcermak/skiff/pkg"
+)
+
+func TestWastedSpace(t *testing.T) {
+	fs := skiff.NewFilesystem()
+	fs.ApplyLayer("sha256:lower", []skiff.FileEntry{
+		{Path: "/big", Typeflag: tar.TypeReg, Size: 600},
+		{Path: "/keep", Typeflag: tar.TypeReg, Size: 100},
+		{Path: "/changed", Typeflag: tar.TypeReg, Size: 200},
+	})
+	fs.ApplyLayer("sha256:upper", []skiff.FileEntry{
+		{Path: "/.wh.big", Typeflag: tar.TypeReg},
+		{Path: "/changed", Typeflag: tar.TypeReg, Size: 100},
+	})
+
+	totalSize, wastedSize := wastedSpace(fs)
+	if totalSize != 1000 {
+		t.Errorf("Expected a total size of 1000, got %d", totalSize)
+	}
+	if wastedSize != 800 {
+		t.Errorf("Expected a wasted size of 800, got %d", wastedSize)
+	}
+	if e := efficiency(totalSize, wastedSize); e != 20 {
+		t.Errorf("Expected an efficiency of 20%%, got %f", e)
+	}
+}
+
+func TestWastedSpaceHardlinkSurvives(t *testing.T) {
+	fs := skiff.NewFilesystem()
+	fs.ApplyLayer("sha256:lower", []skiff.FileEntry{
+		{Path: "/usr/bin/tool", Typeflag: tar.TypeReg, Size: 600},
+		{Path: "/usr/bin/alias", Typeflag: tar.TypeLink, Linkname: "usr/bin/tool"},
+		{Path: "/removed", Typeflag: tar.TypeReg, Size: 200},
+	})
+	fs.ApplyLayer("sha256:upper", []skiff.FileEntry{
+		{Path: "/usr/bin/.wh.tool", Typeflag: tar.TypeReg},
+		{Path: "/.wh.removed", Typeflag: tar.TypeReg},
+	})
+
+	files := wastedFiles(fs)
+	if len(files) != 1 || files[0].Path != "/removed" {
+		t.Errorf("Expected only /removed to be wasted, got %+v", files)
+	}
+
+	// the content of /usr/bin/tool is still reachable via /usr/bin/alias
+	totalSize, wastedSize := wastedSpace(fs)
+	if totalSize != 800 {
+		t.Errorf("Expected a total size of 800, got %d", totalSize)
+	}
+	if wastedSize != 200 {
+		t.Errorf("Expected a wasted size of 200, got %d", wastedSize)
+	}
+	if e := efficiency(totalSize, wastedSize); e != 75 {
+		t.Errorf("Expected an efficiency of 75%%, got %f", e)
+	}
+}
+
+func TestEfficiencyOfEmptyImage(t *testing.T) {
+	if e := efficiency(0, 0); e != 100 {
+		t.Errorf("Expected an efficiency of 100%% for an empty image, got %f", e)
+	}
+}
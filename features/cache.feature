@@ -0,0 +1,17 @@
+Feature: `skiff cache` command
+
+  Scenario: Prune the layer cache
+    Given I run skiff with the subcommand "cache prune"
+    Then the exit code is 0
+    And stdout contains
+      """
+      Removed \d+ layers and layer indexes, freed
+      """
+
+  Scenario: Prune the layer cache with an invalid size
+    Given I run skiff with the subcommand "cache prune --max-size foo"
+    Then the exit code is 1
+    And stderr contains
+      """
+      invalid size "foo"
+      """
@@ -0,0 +1,46 @@
+Feature: `skiff check` command
+
+  Scenario: Run `skiff check` without any arguments
+    Given I run skiff with the subcommand "check"
+    Then the exit code is 1
+    And stderr contains
+      """
+      image URL is required
+      """
+
+  Scenario: Run `skiff check` without a budget
+    Given I run skiff with the subcommand "check registry.suse.com/bci/python@sha256:677b52cc1d587ff72430f1b607343a3d1f88b15a9bbd999601554ff303d6774f"
+    Then the exit code is 1
+    And stderr contains
+      """
+      no budget given, set at least one of --max-size, --max-compressed-size, --max-layer-size, --max-file-size or --max-wasted
+      """
+
+  Scenario: Run `skiff check` with an invalid size
+    Given I run skiff with the subcommand "check --max-size lots registry.suse.com/bci/python@sha256:677b52cc1d587ff72430f1b607343a3d1f88b15a9bbd999601554ff303d6774f"
+    Then the exit code is 1
+    And stderr contains
+      """
+      invalid --max-size: invalid size "lots"
+      """
+
+  Scenario: An image within its budget
+    Given I run skiff with the subcommand "check --max-size 10GB registry.suse.com/bci/python@sha256:677b52cc1d587ff72430f1b607343a3d1f88b15a9bbd999601554ff303d6774f"
+    Then the exit code is 0
+    And stdout contains
+      """
+      BUDGET\s+LIMIT\s+ACTUAL\s+STATUS\s+SUBJECT
+      max-size\s+10000000000\s+\d+\s+ok\s+-
+      """
+
+  Scenario: An image that exceeds its budget
+    Given I run skiff with the subcommand "check --max-layer-size 1MB registry.suse.com/bci/python@sha256:677b52cc1d587ff72430f1b607343a3d1f88b15a9bbd999601554ff303d6774f"
+    Then the exit code is 2
+    And stdout contains
+      """
+      max-layer-size\s+1000000\s+\d+\s+exceeded\s+4672d0cba723
+      """
+    And stdout contains
+      """
+      max-layer-size\s+1000000\s+\d+\s+exceeded\s+88304527ded0
+      """
@@ -0,0 +1,26 @@
+Feature: `skiff dependencies` command
+
+  Scenario: Run `skiff dependencies` without any arguments
+    Given I run skiff with the subcommand "dependencies"
+    Then the exit code is 1
+    And stderr contains
+      """
+      image URL is required
+      """
+
+  Scenario: Run `skiff dependencies` with an invalid ecosystem
+    Given I run skiff with the subcommand "dependencies --ecosystem cobol registry.suse.com/bci/python@sha256:677b52cc1d587ff72430f1b607343a3d1f88b15a9bbd999601554ff303d6774f"
+    Then the exit code is 1
+    And stderr contains
+      """
+      invalid ecosystem "cobol", must be one of python, npm, gem, maven or go
+      """
+
+  Scenario: List the Python packages of an image
+    Given I run skiff with the subcommand "dependencies --ecosystem python registry.suse.com/bci/python@sha256:677b52cc1d587ff72430f1b607343a3d1f88b15a9bbd999601554ff303d6774f"
+    Then the exit code is 0
+    And stdout contains
+      """
+      ECOSYSTEM\s+NAME\s+VERSION\s+SIZE\s+FILES\s+DIFF ID\s+PATH
+      python\s+pip\s+\S+\s+\d+\s+\d+\s+88304527ded0\s+/usr/lib\S*/python3.11/site-packages/pip-\S+.dist-info
+      """
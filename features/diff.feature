@@ -0,0 +1,9 @@
+Feature: `skiff diff` command
+
+  Scenario: Run `skiff diff` with only one image
+    Given I run skiff with the subcommand "diff registry.suse.com/bci/python:3.11"
+    Then the exit code is 1
+    And stderr contains
+      """
+      two image URLs are required
+      """
@@ -0,0 +1,17 @@
+Feature: `skiff explore` command
+
+  Scenario: Run `skiff explore` without any arguments
+    Given I run skiff with the subcommand "explore"
+    Then the exit code is 1
+    And stderr contains
+      """
+      image URL is required
+      """
+
+  Scenario: Run `skiff explore` without a terminal
+    Given I run skiff with the subcommand "explore registry.suse.com/bci/python:3.11"
+    Then the exit code is 1
+    And stderr contains
+      """
+      the explore command requires an interactive terminal
+      """
@@ -19,6 +19,11 @@ Feature: `skiff layers` command
       """
       OPTIONS:
          --full-digest, --full-diff-id\s+Show full digests instead of truncated \(12 chars\) \(default: false\)
+         --empty-layers\s+Also list build steps that did not create a layer \(e.g. ENV or LABEL\)
+         --no-trunc\s+Do not truncate the build instructions
+         --no-download\s+Do not download the layers of images from registries to determine their uncompressed size
+         --all-platforms\s+Analyze the images of all platforms of a multi-arch image
+         --quiet, -q\s+Do not show the progress of reading layers on stderr
          --help, -h\s+show help
       """
 
@@ -26,22 +31,22 @@ Feature: `skiff layers` command
     Given I run podman rmi registry.suse.com/bci/python@sha256:677b52cc1d587ff72430f1b607343a3d1f88b15a9bbd999601554ff303d6774f --ignore
     And I run skiff with the subcommand "layers registry.suse.com/bci/python@sha256:677b52cc1d587ff72430f1b607343a3d1f88b15a9bbd999601554ff303d6774f"
     Then the exit code is 0
-    And stdout is
+    And stdout contains
       """
-      Diff ID       Compressed Size
-      4672d0cba723  47480531
-      88304527ded0  46534194
+      Diff ID\s+Compressed Size\s+Uncompressed Size\s+Ratio\s+Media Type\s+Created\s+Created By\s+Comment
+      4672d0cba723\s+47480531\s+125604864\s+2.65\s+\S+\s+\S.*
+      88304527ded0\s+46534194\s+129486336\s+2.78\s+\S+\s+\S.*
       """
 
   Scenario: Analyze a local image pulled from the registry with an explicit containers-storage transport
     Given I run podman pull registry.suse.com/bci/python@sha256:677b52cc1d587ff72430f1b607343a3d1f88b15a9bbd999601554ff303d6774f
     And I run skiff with the subcommand "layers containers-storage:registry.suse.com/bci/python@sha256:677b52cc1d587ff72430f1b607343a3d1f88b15a9bbd999601554ff303d6774f"
     Then the exit code is 0
-    And stdout is
+    And stdout contains
       """
-      Diff ID       Uncompressed Size
-      4672d0cba723  125604864
-      88304527ded0  129486336
+      Diff ID\s+Compressed Size\s+Uncompressed Size\s+Ratio\s+Media Type\s+Created\s+Created By\s+Comment
+      4672d0cba723\s+\S+\s+125604864\s+\S+\s+\S+\s+\S.*
+      88304527ded0\s+\S+\s+129486336\s+\S+\s+\S+\s+\S.*
       """
 
   Scenario: Analyze image from podman storage
@@ -49,44 +54,95 @@ Feature: `skiff layers` command
     Then the exit code is 0
     Given I run skiff with the subcommand "layers ghcr.io/github/github-mcp-server@sha256:0c720d3b8aab0e5107a2631516543095c6967637b52b8782dc9ee527a0803012"
     Then the exit code is 0
-    And stdout is
-      """
-      Diff ID       Uncompressed Size
-      f464af4b9b25  327680
-      8fa10c0194df  40960
-      48c0fb67386e  2406400
-      114dde0fefeb  102400
-      4d049f83d9cf  1536
-      af5aa97ebe6c  2560
-      6f1cdceb6a31  2560
-      bbb6cacb8c82  2560
-      2a92d6ac9e4f  1536
-      1a73b54f556b  10240
-      f4aee9e53c42  3072
-      bfe9137a1b04  241664
-      d5a3e014161b  13056000
-      2e4983c761ce  5918720
-      76dbf54073c9  1536
-      2c8b3de21aa2  13228544
+    And stdout contains
+      """
+      Diff ID\s+Compressed Size\s+Uncompressed Size\s+Ratio\s+Media Type\s+Created\s+Created By\s+Comment
+      f464af4b9b25\s+\S+\s+327680\s+\S+\s+\S+\s+\S.*
+      8fa10c0194df\s+\S+\s+40960\s+\S+\s+\S+\s+\S.*
+      48c0fb67386e\s+\S+\s+2406400\s+\S+\s+\S+\s+\S.*
+      114dde0fefeb\s+\S+\s+102400\s+\S+\s+\S+\s+\S.*
+      4d049f83d9cf\s+\S+\s+1536\s+\S+\s+\S+\s+\S.*
+      af5aa97ebe6c\s+\S+\s+2560\s+\S+\s+\S+\s+\S.*
+      6f1cdceb6a31\s+\S+\s+2560\s+\S+\s+\S+\s+\S.*
+      bbb6cacb8c82\s+\S+\s+2560\s+\S+\s+\S+\s+\S.*
+      2a92d6ac9e4f\s+\S+\s+1536\s+\S+\s+\S+\s+\S.*
+      1a73b54f556b\s+\S+\s+10240\s+\S+\s+\S+\s+\S.*
+      f4aee9e53c42\s+\S+\s+3072\s+\S+\s+\S+\s+\S.*
+      bfe9137a1b04\s+\S+\s+241664\s+\S+\s+\S+\s+\S.*
+      d5a3e014161b\s+\S+\s+13056000\s+\S+\s+\S+\s+\S.*
+      2e4983c761ce\s+\S+\s+5918720\s+\S+\s+\S+\s+\S.*
+      76dbf54073c9\s+\S+\s+1536\s+\S+\s+\S+\s+\S.*
+      2c8b3de21aa2\s+\S+\s+13228544\s+\S+\s+\S+\s+\S.*
       """
 
   Scenario: Analyze an image from a registry with full digests
     Given I run podman rmi registry.suse.com/bci/python@sha256:677b52cc1d587ff72430f1b607343a3d1f88b15a9bbd999601554ff303d6774f --ignore
     And I run skiff with the subcommand "layers --full-digest registry.suse.com/bci/python@sha256:677b52cc1d587ff72430f1b607343a3d1f88b15a9bbd999601554ff303d6774f"
     Then the exit code is 0
-    And stdout is
+    And stdout contains
       """
-      Diff ID                                                                  Compressed Size
-      sha256:4672d0cba723f1a9a7b91c1e06f5d8801a076b1bdf4990806cdaabcd53992738  47480531
-      sha256:88304527ded0288579ec4780fe377a7fabc5bc92f965c18e9ee734a8bb1794bb  46534194
+      Diff ID\s+Compressed Size\s+Uncompressed Size\s+Ratio\s+Media Type\s+Created\s+Created By\s+Comment
+      sha256:4672d0cba723f1a9a7b91c1e06f5d8801a076b1bdf4990806cdaabcd53992738\s+47480531\s+125604864\s+2.65\s+\S+\s+\S.*
+      sha256:88304527ded0288579ec4780fe377a7fabc5bc92f965c18e9ee734a8bb1794bb\s+46534194\s+129486336\s+2.78\s+\S+\s+\S.*
       """
 
   Scenario: Analyze an image with full digests
     Given I run skiff with the subcommand "layers --full-diff-id registry.suse.com/bci/python@sha256:677b52cc1d587ff72430f1b607343a3d1f88b15a9bbd999601554ff303d6774f"
     Then the exit code is 0
-    And stdout is
+    And stdout contains
+      """
+      Diff ID\s+Compressed Size\s+Uncompressed Size\s+Ratio\s+Media Type\s+Created\s+Created By\s+Comment
+      sha256:4672d0cba723f1a9a7b91c1e06f5d8801a076b1bdf4990806cdaabcd53992738\s+47480531\s+125604864\s+2.65\s+\S+\s+\S.*
+      sha256:88304527ded0288579ec4780fe377a7fabc5bc92f965c18e9ee734a8bb1794bb\s+46534194\s+129486336\s+2.78\s+\S+\s+\S.*
+      """
+
+  Scenario: Analyze an image from a registry without downloading its layers
+    Given I run podman rmi registry.suse.com/bci/python@sha256:677b52cc1d587ff72430f1b607343a3d1f88b15a9bbd999601554ff303d6774f --ignore
+    And I run skiff with the subcommand "layers --no-download registry.suse.com/bci/python@sha256:677b52cc1d587ff72430f1b607343a3d1f88b15a9bbd999601554ff303d6774f"
+    Then the exit code is 0
+    And stdout contains
+      """
+      Diff ID\s+Compressed Size\s+Uncompressed Size\s+Ratio\s+Media Type\s+Created\s+Created By\s+Comment
+      4672d0cba723\s+47480531\s+-\s+-\s+\S+\s+\S.*
+      88304527ded0\s+46534194\s+-\s+-\s+\S+\s+\S.*
+      """
+
+  Scenario: Run `skiff layers` with an invalid platform
+    Given I run skiff with the subcommand "layers --platform linux registry.suse.com/bci/python:3.11"
+    Then the exit code is 1
+    And stderr contains
+      """
+      invalid platform "linux", must be in the form os/arch\[/variant\]
+      """
+
+  Scenario: Run `skiff layers` with `--platform` and `--all-platforms`
+    Given I run skiff with the subcommand "layers --platform linux/arm64 --all-platforms registry.suse.com/bci/python:3.11"
+    Then the exit code is 1
+    And stderr contains
+      """
+      --all-platforms and --platform cannot be used together
+      """
+
+  Scenario: Analyze all platforms of a multi-arch image
+    Given I run skiff with the subcommand "layers --no-download --all-platforms registry.suse.com/bci/python:3.11"
+    Then the exit code is 0
+    And stdout contains
+      """
+      Platform: linux/amd64
+      """
+    And stdout contains
+      """
+      Platform: linux/arm64
+      """
+    And stdout contains
+      """
+      Platform\s+Layers\s+Compressed Size\s+Uncompressed Size
+      """
+
+  Scenario: Run `skiff layers` with invalid credentials
+    Given I run skiff with the subcommand "--creds user layers registry.suse.com/bci/python:3.11"
+    Then the exit code is 1
+    And stderr contains
       """
-      Diff ID                                                                  Compressed Size
-      sha256:4672d0cba723f1a9a7b91c1e06f5d8801a076b1bdf4990806cdaabcd53992738  47480531
-      sha256:88304527ded0288579ec4780fe377a7fabc5bc92f965c18e9ee734a8bb1794bb  46534194
+      invalid credentials, must be in the form username:password
       """
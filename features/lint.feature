@@ -0,0 +1,46 @@
+Feature: `skiff lint` command
+
+  Scenario: Run `skiff lint` without any arguments
+    Given I run skiff with the subcommand "lint"
+    Then the exit code is 1
+    And stderr contains
+      """
+      image URL is required
+      """
+
+  Scenario: List the lint rules
+    Given I run skiff with the subcommand "lint --list-rules"
+    Then the exit code is 0
+    And stdout contains
+      """
+      RULE\s+SEVERITY\s+MIN SIZE\s+PATHS\s+DESCRIPTION
+      package-manager-cache\s+warning\s+0\s+/var/cache/zypp,
+      """
+
+  Scenario: Run `skiff lint` with an invalid severity
+    Given I run skiff with the subcommand "lint --fail-on fatal registry.suse.com/bci/python@sha256:677b52cc1d587ff72430f1b607343a3d1f88b15a9bbd999601554ff303d6774f"
+    Then the exit code is 1
+    And stderr contains
+      """
+      invalid --fail-on: invalid severity "fatal", must be one of info, warning or error
+      """
+
+  Scenario: Lint an image with documentation
+    Given I run skiff with the subcommand "lint --fail-on none registry.suse.com/bci/python@sha256:677b52cc1d587ff72430f1b607343a3d1f88b15a9bbd999601554ff303d6774f"
+    Then the exit code is 0
+    And stdout contains
+      """
+      RULE\s+SEVERITY\s+SIZE\s+FILES\s+DIFF ID\s+PATH
+      """
+    And stdout contains
+      """
+      documentation\s+warning\s+\d+\s+\d+\s+\S{12}\s+/usr/share/(doc|man)
+      """
+
+  Scenario: Fail on lint findings
+    Given I run skiff with the subcommand "lint registry.suse.com/bci/python@sha256:677b52cc1d587ff72430f1b607343a3d1f88b15a9bbd999601554ff303d6774f"
+    Then the exit code is 2
+    And stderr contains
+      """
+      findings with severity warning or higher
+      """
@@ -0,0 +1,42 @@
+Feature: `skiff packages` command
+
+  Scenario: Run `skiff packages` without any arguments
+    Given I run skiff with the subcommand "packages"
+    Then the exit code is 1
+    And stderr contains
+      """
+      image URL is required
+      """
+
+  Scenario: List the packages of an image
+    Given I run skiff with the subcommand "packages registry.suse.com/bci/python@sha256:677b52cc1d587ff72430f1b607343a3d1f88b15a9bbd999601554ff303d6774f"
+    Then the exit code is 0
+    And stdout contains
+      """
+      NAME\s+VERSION\s+ARCH\s+SIZE\s+DIFF ID
+      """
+    And stdout contains
+      """
+      python311-base\s+\S+\s+x86_64\s+\d+\s+88304527ded0
+      """
+    And stdout contains
+      """
+      \d+ rpm packages, \d+ bytes installed
+      """
+
+  Scenario: Show the owning package of files with top
+    Given I run skiff with the subcommand "top --merged --package registry.suse.com/bci/python@sha256:677b52cc1d587ff72430f1b607343a3d1f88b15a9bbd999601554ff303d6774f"
+    Then the exit code is 0
+    And stdout contains
+      """
+      /usr/bin/zypper\s+2915456\s+4672d0cba723\s+zypper
+      """
+
+  Scenario: List the packages that every layer installed or removed
+    Given I run skiff with the subcommand "packages --changes registry.suse.com/bci/python@sha256:677b52cc1d587ff72430f1b607343a3d1f88b15a9bbd999601554ff303d6774f"
+    Then the exit code is 0
+    And stdout contains
+      """
+      DIFF ID\s+CHANGE\s+NAME\s+VERSION\s+ARCH\s+SIZE
+      4672d0cba723\s+installed\s+\S+
+      """
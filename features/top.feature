@@ -144,3 +144,19 @@ Feature: `skiff top` command
       /usr/lib/locale/locale-archive     3.1 MB  4672d0cba723
       /usr/bin/zypper                    2.9 MB  4672d0cba723
       """
+
+  Scenario: Read the layers concurrently
+    Given I run skiff with the subcommand "top --jobs 8 registry.suse.com/bci/python@sha256:677b52cc1d587ff72430f1b607343a3d1f88b15a9bbd999601554ff303d6774f"
+    Then the exit code is 0
+    And stdout contains
+      """
+      /usr/bin/container-suseconnect     9245304  4672d0cba723
+      """
+
+  Scenario: Invalid number of jobs
+    Given I run skiff with the subcommand "top --jobs 0 registry.suse.com/bci/python:3.11"
+    Then the exit code is 1
+    And stderr contains
+      """
+      --jobs must be at least 1
+      """
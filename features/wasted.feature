@@ -0,0 +1,9 @@
+Feature: `skiff wasted` command
+
+  Scenario: Run `skiff wasted` without any arguments
+    Given I run skiff with the subcommand "wasted"
+    Then the exit code is 1
+    And stderr contains
+      """
+      image URL is required
+      """
@@ -0,0 +1,67 @@
+package skiff
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+)
+
+// readAPKDatabase reads the packages from the apk database (`installed`) at
+// dbPath below root.
+//
+// The database consists of one paragraph per package, every line starts with
+// a single letter that identifies the field followed by a colon. Files are
+// listed as `R:` lines below the `F:` line of their directory.
+func readAPKDatabase(root, dbPath string) ([]Package, error) {
+	f, err := os.Open(filepath.Join(root, dbPath))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var packages []Package
+	var pkg *Package
+	dir := ""
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			pkg = nil
+			continue
+		}
+		if len(line) < 2 || line[1] != ':' {
+			return nil, fmt.Errorf("failed to parse %s: invalid line %q", dbPath, line)
+		}
+		if pkg == nil {
+			packages = append(packages, Package{InstalledSize: -1})
+			pkg = &packages[len(packages)-1]
+			dir = ""
+		}
+
+		value := line[2:]
+		switch line[0] {
+		case 'P':
+			pkg.Name = value
+		case 'V':
+			pkg.Version = value
+		case 'A':
+			pkg.Arch = value
+		case 'I':
+			if size, err := strconv.ParseInt(value, 10, 64); err == nil {
+				pkg.InstalledSize = size
+			}
+		case 'F':
+			dir = value
+		case 'R':
+			pkg.Files = append(pkg.Files, path.Join("/", dir, value))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", dbPath, err)
+	}
+	return packages, nil
+}
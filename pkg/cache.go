@@ -0,0 +1,286 @@
+package skiff
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"go.podman.io/image/v5/pkg/blobinfocache/none"
+	"go.podman.io/image/v5/types"
+)
+
+// BlobCache is a content-addressed cache of layer blobs on disk, so that the
+// layers of images from registries only have to be downloaded once.
+//
+// Blobs are stored as blobs/<algorithm>/<encoded digest> below the cache
+// directory. The least recently used blobs and layer indexes of an IndexStore
+// in the same directory are removed once the cache grows beyond its maximum
+// size.
+type BlobCache struct {
+	dir string
+	// maxSize is the maximum size of all blobs, 0 disables the limit
+	maxSize int64
+}
+
+// DefaultCacheDir returns the default cache directory $XDG_CACHE_HOME/skiff.
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "skiff"), nil
+}
+
+// NewBlobCache returns a cache that stores blobs in dir and keeps them below
+// maxSize bytes. A maxSize of 0 disables the limit.
+func NewBlobCache(dir string, maxSize int64) *BlobCache {
+	return &BlobCache{dir: dir, maxSize: maxSize}
+}
+
+type blobCacheKey struct{}
+
+// WithBlobCache returns a context that makes WalkLayer and
+// UncompressedLayerSize read the blobs of images from registries through the
+// cache.
+func WithBlobCache(ctx context.Context, c *BlobCache) context.Context {
+	return context.WithValue(ctx, blobCacheKey{}, c)
+}
+
+func blobCacheFromContext(ctx context.Context) *BlobCache {
+	c, _ := ctx.Value(blobCacheKey{}).(*BlobCache)
+	return c
+}
+
+func (c *BlobCache) blobsDir() string {
+	return filepath.Join(c.dir, "blobs")
+}
+
+func (c *BlobCache) path(d digest.Digest) string {
+	return filepath.Join(c.blobsDir(), d.Algorithm().String(), d.Encoded())
+}
+
+// getBlob returns the blob of the layer from the cache. Blobs that are not
+// cached yet or whose cached content does not match their digest are fetched
+// from imgSrc and added to the cache while they are read.
+func (c *BlobCache) getBlob(ctx context.Context, imgSrc types.ImageSource, layer types.BlobInfo) (io.ReadCloser, error) {
+	if err := layer.Digest.Validate(); err != nil {
+		// blobs without a valid digest cannot be stored
+		blob, _, err := imgSrc.GetBlob(ctx, layer, none.NoCache)
+		return blob, err
+	}
+
+	path := c.path(layer.Digest)
+	if f, err := openCachedBlob(path, layer.Digest); err == nil {
+		// mark the blob as recently used for pruning
+		now := time.Now()
+		_ = os.Chtimes(path, now, now)
+		return f, nil
+	}
+
+	blob, _, err := imgSrc.GetBlob(ctx, layer, none.NoCache)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return blob, nil
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		// the cache is optional, read the blob without caching it
+		return blob, nil
+	}
+	return &cachingReader{
+		cache:    c,
+		blob:     blob,
+		tmp:      tmp,
+		path:     path,
+		digester: layer.Digest.Algorithm().Digester(),
+		expected: layer.Digest,
+	}, nil
+}
+
+// openCachedBlob opens the cached blob at path and verifies that its content
+// matches the digest d. Blobs that do not match, e.g. because they were
+// modified or truncated on disk, are removed from the cache.
+func openCachedBlob(path string, d digest.Digest) (*os.File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	verifier := d.Verifier()
+	if _, err := io.Copy(verifier, f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if !verifier.Verified() {
+		f.Close()
+		os.Remove(path)
+		return nil, fmt.Errorf("cached blob %s does not match its digest", d)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// maxDrainSize is the number of unread bytes that are still read from a blob
+// when it is closed so that it can be cached. The decompressor stops at the
+// end of the layer archive and may leave a small trailer unread.
+const maxDrainSize = 1 << 20
+
+// cachingReader copies a blob into a temporary file while it is read and
+// moves it into the cache once it has been read completely and its digest
+// has been verified.
+type cachingReader struct {
+	cache    *BlobCache
+	blob     io.ReadCloser
+	tmp      *os.File
+	path     string
+	digester digest.Digester
+	expected digest.Digest
+	eof      bool
+	failed   bool
+}
+
+func (r *cachingReader) Read(p []byte) (int, error) {
+	n, err := r.blob.Read(p)
+	if n > 0 && !r.failed {
+		if _, werr := r.tmp.Write(p[:n]); werr != nil {
+			r.failed = true
+		}
+		r.digester.Hash().Write(p[:n])
+	}
+	if err == io.EOF {
+		r.eof = true
+	}
+	return n, err
+}
+
+func (r *cachingReader) Close() error {
+	if !r.eof && !r.failed {
+		if _, err := io.CopyN(io.Discard, r, maxDrainSize); err != nil && err != io.EOF {
+			r.failed = true
+		}
+	}
+	err := r.blob.Close()
+
+	tmpName := r.tmp.Name()
+	if cerr := r.tmp.Close(); cerr != nil {
+		r.failed = true
+	}
+	if !r.eof || r.failed || r.digester.Digest() != r.expected {
+		os.Remove(tmpName)
+		return err
+	}
+	if rerr := os.Rename(tmpName, r.path); rerr != nil {
+		os.Remove(tmpName)
+		return err
+	}
+
+	if r.cache.maxSize > 0 {
+		// failing to prune is not fatal, the cache is just too large
+		_, _, _ = r.cache.Prune(r.cache.maxSize)
+	}
+	return err
+}
+
+// cacheSubdirs are the directories below the cache directory whose files
+// count toward its maximum size: the blobs of the BlobCache and the layer
+// indexes of the IndexStore.
+var cacheSubdirs = []string{"blobs", "index"}
+
+type cachedFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// cachedFiles returns the blobs and layer indexes below the cache directory dir
+func cachedFiles(dir string) ([]cachedFile, error) {
+	var files []cachedFile
+	for _, subdir := range cacheSubdirs {
+		err := filepath.WalkDir(filepath.Join(dir, subdir), func(path string, d fs.DirEntry, err error) error {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			// temporary files belong to blobs that are still being
+			// downloaded or to indexes that are still being written
+			if !d.Type().IsRegular() || strings.HasPrefix(d.Name(), ".tmp-") {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			files = append(files, cachedFile{path: path, size: info.Size(), modTime: info.ModTime()})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// Size returns the number and the total size of all cached blobs and layer
+// indexes.
+func (c *BlobCache) Size() (files int, size int64, err error) {
+	cached, err := cachedFiles(c.dir)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, f := range cached {
+		size += f.size
+	}
+	return len(cached), size, nil
+}
+
+// Prune removes the least recently used blobs and layer indexes until the
+// total size of the cache is at most maxSize bytes. All blobs and indexes are
+// removed if maxSize is 0.
+func (c *BlobCache) Prune(maxSize int64) (removed int, freed int64, err error) {
+	return pruneCache(c.dir, maxSize)
+}
+
+// pruneCache implements Prune for the cache directory dir, so that it can be
+// shared by the BlobCache and the IndexStore.
+func pruneCache(dir string, maxSize int64) (removed int, freed int64, err error) {
+	cached, err := cachedFiles(dir)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var size int64
+	for _, f := range cached {
+		size += f.size
+	}
+
+	slices.SortFunc(cached, func(a, b cachedFile) int { return cmp.Compare(a.modTime.UnixNano(), b.modTime.UnixNano()) })
+	for _, f := range cached {
+		if size <= maxSize {
+			break
+		}
+		if err := os.Remove(f.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return removed, freed, fmt.Errorf("failed to remove %s from the cache: %w", f.path, err)
+		}
+		size -= f.size
+		freed += f.size
+		removed++
+	}
+	return removed, freed, nil
+}
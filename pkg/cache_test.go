@@ -0,0 +1,155 @@
+package skiff
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"go.podman.io/image/v5/types"
+)
+
+// countingSource is an image source that serves blobs from memory and counts
+// how often they were fetched
+type countingSource struct {
+	types.ImageSource
+	blobs map[digest.Digest][]byte
+	gets  int
+}
+
+func (s *countingSource) GetBlob(_ context.Context, info types.BlobInfo, _ types.BlobInfoCache) (io.ReadCloser, int64, error) {
+	s.gets++
+	data := s.blobs[info.Digest]
+	return io.NopCloser(bytes.NewReader(data)), int64(len(data)), nil
+}
+
+func readBlob(t *testing.T, c *BlobCache, src types.ImageSource, d digest.Digest) []byte {
+	t.Helper()
+
+	blob, err := c.getBlob(context.Background(), src, types.BlobInfo{Digest: d})
+	if err != nil {
+		t.Fatalf("getBlob failed: %v", err)
+	}
+	data, err := io.ReadAll(blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := blob.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestBlobCache(t *testing.T) {
+	content := []byte("layer content")
+	d := digest.FromBytes(content)
+	src := &countingSource{blobs: map[digest.Digest][]byte{d: content}}
+	c := NewBlobCache(t.TempDir(), 0)
+
+	for range 3 {
+		if data := readBlob(t, c, src, d); !bytes.Equal(data, content) {
+			t.Errorf("Expected %q, got %q", content, data)
+		}
+	}
+	if src.gets != 1 {
+		t.Errorf("Expected the blob to be fetched once, got %d fetches", src.gets)
+	}
+
+	blobs, size, err := c.Size()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blobs != 1 || size != int64(len(content)) {
+		t.Errorf("Expected one blob of %d bytes, got %d blobs with %d bytes", len(content), blobs, size)
+	}
+}
+
+func TestBlobCacheDigestMismatch(t *testing.T) {
+	d := digest.FromString("expected")
+	src := &countingSource{blobs: map[digest.Digest][]byte{d: []byte("corrupted")}}
+	c := NewBlobCache(t.TempDir(), 0)
+
+	readBlob(t, c, src, d)
+	readBlob(t, c, src, d)
+	if src.gets != 2 {
+		t.Errorf("Expected corrupted blobs not to be cached, got %d fetches", src.gets)
+	}
+	if blobs, _, _ := c.Size(); blobs != 0 {
+		t.Errorf("Expected an empty cache, got %d blobs", blobs)
+	}
+}
+
+func TestBlobCacheCorruptedEntry(t *testing.T) {
+	content := []byte("layer content")
+	d := digest.FromBytes(content)
+	src := &countingSource{blobs: map[digest.Digest][]byte{d: content}}
+	c := NewBlobCache(t.TempDir(), 0)
+
+	readBlob(t, c, src, d)
+	if err := os.WriteFile(c.path(d), []byte("layer cont"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the truncated blob is fetched again and replaced in the cache
+	if data := readBlob(t, c, src, d); !bytes.Equal(data, content) {
+		t.Errorf("Expected %q, got %q", content, data)
+	}
+	if src.gets != 2 {
+		t.Errorf("Expected the corrupted blob to be fetched again, got %d fetches", src.gets)
+	}
+	if cached, err := os.ReadFile(c.path(d)); err != nil || !bytes.Equal(cached, content) {
+		t.Errorf("Expected the cache to contain %q, got %q (%v)", content, cached, err)
+	}
+}
+
+func TestBlobCachePrune(t *testing.T) {
+	c := NewBlobCache(t.TempDir(), 0)
+	src := &countingSource{blobs: map[digest.Digest][]byte{}}
+
+	var digests []digest.Digest
+	for i, content := range []string{"oldest", "middle", "newest"} {
+		d := digest.FromString(content)
+		src.blobs[d] = []byte(content)
+		readBlob(t, c, src, d)
+
+		// make the access times distinguishable
+		mtime := time.Now().Add(time.Duration(i-3) * time.Hour)
+		if err := os.Chtimes(c.path(d), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		digests = append(digests, d)
+	}
+
+	removed, freed, err := c.Prune(12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 || freed != 6 {
+		t.Errorf("Expected one blob with 6 bytes to be removed, got %d blobs with %d bytes", removed, freed)
+	}
+	if _, err := os.Stat(c.path(digests[0])); err == nil {
+		t.Errorf("Expected the least recently used blob to be removed")
+	}
+
+	if removed, _, _ := c.Prune(0); removed != 2 {
+		t.Errorf("Expected all remaining blobs to be removed, got %d", removed)
+	}
+}
+
+func TestBlobCacheMaxSize(t *testing.T) {
+	c := NewBlobCache(t.TempDir(), 10)
+	src := &countingSource{blobs: map[digest.Digest][]byte{}}
+
+	for _, content := range []string{"first blob", "second blob"} {
+		d := digest.FromString(content)
+		src.blobs[d] = []byte(content)
+		readBlob(t, c, src, d)
+	}
+
+	if _, size, _ := c.Size(); size > 10 {
+		t.Errorf("Expected the cache to stay below 10 bytes, got %d bytes", size)
+	}
+}
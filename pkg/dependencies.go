@@ -0,0 +1,372 @@
+package skiff
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"io"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/opencontainers/go-digest"
+	"go.podman.io/storage/pkg/archive"
+)
+
+// Ecosystems of the dependencies found by ImageLayers.Dependencies
+const (
+	EcosystemPython = "python"
+	EcosystemNPM    = "npm"
+	EcosystemGem    = "gem"
+	EcosystemMaven  = "maven"
+	EcosystemGo     = "go"
+)
+
+// Dependency is a dependency of a language ecosystem that is installed in an
+// image, e.g. a Python package in site-packages or a package in node_modules.
+type Dependency struct {
+	Ecosystem string
+	Name      string
+	// Version is empty if it is not known
+	Version string
+	// Path is the directory that contains the dependency (or its metadata
+	// directory for Python packages)
+	Path string
+}
+
+// DependencyUsage is the disk space that the files of a dependency occupy in
+// a single layer.
+type DependencyUsage struct {
+	Dependency
+	// DiffID is the diffID of the layer
+	DiffID digest.Digest
+	// Layer is the index of the layer
+	Layer int
+	// Size is the accumulated size of the files of the dependency in the
+	// layer
+	Size int64
+	// Files is the number of files of the dependency in the layer
+	Files int
+}
+
+// maxMetadataSize is the maximum size of the metadata files (package.json,
+// RECORD) that are read to determine the version or the files of a dependency
+const maxMetadataSize = 4 * 1024 * 1024
+
+// dependencyIndex maps the files of an image to the dependencies that own
+// them
+type dependencyIndex struct {
+	// roots maps the directories of dependencies to the dependencies
+	roots map[string]*Dependency
+	// files maps files outside of the directory of a dependency (e.g.
+	// Python modules listed in RECORD) to the dependencies that own them
+	files map[string]*Dependency
+	// metadata maps the paths of the metadata files whose content is needed
+	// to the dependencies that they describe
+	metadata map[string]*Dependency
+}
+
+// owner returns the dependency that owns the file at p or nil
+func (idx *dependencyIndex) owner(p string) *Dependency {
+	if d, ok := idx.files[p]; ok {
+		return d
+	}
+	for dir := p; dir != "/"; dir = path.Dir(dir) {
+		if d, ok := idx.roots[dir]; ok {
+			return d
+		}
+	}
+	return nil
+}
+
+// add registers a dependency with the directory root, the dependency that is
+// found first wins
+func (idx *dependencyIndex) add(d Dependency) *Dependency {
+	if existing, ok := idx.roots[d.Path]; ok {
+		return existing
+	}
+	idx.roots[d.Path] = &d
+	return &d
+}
+
+// detect registers the dependency that the entry at p belongs to, if p is the
+// metadata of a dependency
+func (idx *dependencyIndex) detect(p string) {
+	dir, base := path.Split(p)
+	dir = path.Clean(dir)
+	parent := path.Base(dir)
+	components := strings.Split(strings.TrimPrefix(p, "/"), "/")
+
+	switch {
+	// Python packages are described by a .dist-info or .egg-info
+	// directory in site-packages, whose name contains the name and the
+	// version of the package
+	case (parent == "site-packages" || parent == "dist-packages") &&
+		(strings.HasSuffix(base, ".dist-info") || strings.HasSuffix(base, ".egg-info")):
+		name, version := pythonDistribution(base)
+		d := idx.add(Dependency{Ecosystem: EcosystemPython, Name: name, Version: version, Path: p})
+		if strings.HasSuffix(base, ".dist-info") {
+			idx.metadata[path.Join(p, "RECORD")] = d
+		} else {
+			idx.metadata[path.Join(p, "installed-files.txt")] = d
+		}
+
+	// npm packages are directories in node_modules (or in a scope below
+	// it) with a package.json, which contains the version
+	case base == "package.json" && path.Base(path.Dir(dir)) == "node_modules":
+		d := idx.add(Dependency{Ecosystem: EcosystemNPM, Name: parent, Path: dir})
+		idx.metadata[p] = d
+	case base == "package.json" && strings.HasPrefix(path.Base(path.Dir(dir)), "@") &&
+		path.Base(path.Dir(path.Dir(dir))) == "node_modules":
+		d := idx.add(Dependency{Ecosystem: EcosystemNPM, Name: path.Base(path.Dir(dir)) + "/" + parent, Path: dir})
+		idx.metadata[p] = d
+
+	// every installed gem has a gemspec in the specifications directory
+	// next to the gems directory that contains the gem
+	case parent == "specifications" && strings.HasSuffix(base, ".gemspec"):
+		nameVersion := strings.TrimSuffix(base, ".gemspec")
+		name, version := splitNameVersion(nameVersion)
+		idx.add(Dependency{Ecosystem: EcosystemGem, Name: name, Version: version, Path: path.Join(path.Dir(dir), "gems", nameVersion)})
+
+	// the local Maven repository stores artifacts below
+	// <group>/<artifact>/<version>/<artifact>-<version>.pom
+	case strings.HasSuffix(base, ".pom") && slices.Contains(components, ".m2"):
+		i := slices.Index(components, ".m2")
+		coordinates := components[i+1 : len(components)-1]
+		if len(coordinates) < 4 || coordinates[0] != "repository" {
+			return
+		}
+		group, artifact, version := coordinates[1:len(coordinates)-2], coordinates[len(coordinates)-2], coordinates[len(coordinates)-1]
+		if base != artifact+"-"+version+".pom" {
+			return
+		}
+		idx.add(Dependency{Ecosystem: EcosystemMaven, Name: strings.Join(group, ".") + ":" + artifact, Version: version, Path: dir})
+
+	default:
+		idx.detectGo(components)
+	}
+}
+
+// detectGo registers the Go module or the Go cache that the path with the
+// given components belongs to
+func (idx *dependencyIndex) detectGo(components []string) {
+	for i, c := range components {
+		switch {
+		// the build cache, usually in ~/.cache/go-build
+		case c == "go-build" && i > 0 && components[i-1] == ".cache":
+			idx.add(Dependency{Ecosystem: EcosystemGo, Name: "build cache", Path: "/" + path.Join(components[:i+1]...)})
+			return
+
+		// the module cache stores the extracted modules in
+		// pkg/mod/<module>@<version> and the downloaded archives in
+		// pkg/mod/cache
+		case c == "mod" && i > 0 && components[i-1] == "pkg" && i+1 < len(components):
+			if components[i+1] == "cache" {
+				idx.add(Dependency{Ecosystem: EcosystemGo, Name: "module cache", Path: "/" + path.Join(components[:i+2]...)})
+				return
+			}
+			for j := i + 1; j < len(components); j++ {
+				escapedPath, escapedVersion, ok := strings.Cut(components[j], "@")
+				if !ok {
+					continue
+				}
+				name := path.Join(append(slices.Clone(components[i+1:j]), escapedPath)...)
+				idx.add(Dependency{
+					Ecosystem: EcosystemGo,
+					Name:      unescapeModulePath(name),
+					Version:   unescapeModulePath(escapedVersion),
+					Path:      "/" + path.Join(components[:j+1]...),
+				})
+				return
+			}
+			return
+		}
+	}
+}
+
+// unescapeModulePath reverts the escaping of upper case letters in the paths
+// and versions of the Go module cache, which stores e.g.
+// github.com/BurntSushi/toml as github.com/!burnt!sushi/toml
+func unescapeModulePath(escaped string) string {
+	var b strings.Builder
+	upper := false
+	for _, r := range escaped {
+		switch {
+		case r == '!':
+			upper = true
+			continue
+		case upper:
+			r = unicode.ToUpper(r)
+		}
+		upper = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// pythonDistribution returns the name and the version of a Python package
+// from the name of its .dist-info (name-version.dist-info) or .egg-info
+// (name-version[-pyX.Y].egg-info) directory
+func pythonDistribution(metadataDir string) (name, version string) {
+	nameVersion := strings.TrimSuffix(strings.TrimSuffix(metadataDir, ".dist-info"), ".egg-info")
+	name, version, _ = strings.Cut(nameVersion, "-")
+	version, _, _ = strings.Cut(version, "-py")
+	return name, version
+}
+
+// splitNameVersion splits a name-version string, like the directory of a
+// gem, at the last dash that is followed by a digit
+func splitNameVersion(s string) (name, version string) {
+	for i := len(s) - 2; i > 0; i-- {
+		if s[i] == '-' && unicode.IsDigit(rune(s[i+1])) {
+			return s[:i], s[i+1:]
+		}
+	}
+	return s, ""
+}
+
+// readMetadata updates the dependency d from the content of its metadata file
+// at p
+func (idx *dependencyIndex) readMetadata(p string, d *Dependency, content []byte) {
+	switch {
+	case d.Ecosystem == EcosystemNPM:
+		var pkg struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		}
+		if json.Unmarshal(content, &pkg) == nil {
+			d.Name = cmp.Or(pkg.Name, d.Name)
+			d.Version = pkg.Version
+		}
+
+	case d.Ecosystem == EcosystemPython:
+		// RECORD is a CSV file with the paths of the installed files
+		// relative to site-packages, installed-files.txt lists them
+		// relative to the .egg-info directory
+		base := path.Dir(d.Path)
+		if path.Base(p) == "installed-files.txt" {
+			base = d.Path
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(content))
+		for scanner.Scan() {
+			file, _, _ := strings.Cut(scanner.Text(), ",")
+			if file == "" {
+				continue
+			}
+			file = path.Join(base, strings.Trim(file, `"`))
+			if _, ok := idx.files[file]; !ok {
+				idx.files[file] = d
+			}
+		}
+	}
+}
+
+// Dependencies finds the dependencies of language ecosystems (Python, npm,
+// Ruby gems, Maven and Go) in the layers of the image and returns the disk
+// space that every dependency occupies in every layer that contains files of
+// it, ordered by size. entries must contain the entries of all layers, e.g.
+// as returned by ReadEntries.
+//
+// Dependencies are recognized by their metadata. The layers that contain
+// metadata files whose content is needed (package.json for the version of npm
+// packages and RECORD for the files of Python packages) are fetched again, up
+// to jobs of them concurrently.
+func (l *ImageLayers) Dependencies(ctx context.Context, entries [][]FileEntry, jobs int) ([]DependencyUsage, error) {
+	idx := &dependencyIndex{
+		roots:    map[string]*Dependency{},
+		files:    map[string]*Dependency{},
+		metadata: map[string]*Dependency{},
+	}
+
+	// metadata files are read from the top most layer that contains them
+	metadataLayers := map[string]int{}
+	layersWithMetadata := map[int]bool{}
+	for layer, layerEntries := range entries {
+		for _, entry := range layerEntries {
+			if strings.HasPrefix(path.Base(entry.Path), archive.WhiteoutPrefix) {
+				continue
+			}
+			idx.detect(entry.Path)
+			// layer archives do not need to contain the
+			// directories of their files
+			idx.detect(path.Dir(entry.Path))
+		}
+		for _, entry := range layerEntries {
+			if _, ok := idx.metadata[entry.Path]; ok && entry.IsRegular() && entry.Size <= maxMetadataSize {
+				metadataLayers[entry.Path] = layer
+			}
+		}
+	}
+
+	for _, layer := range metadataLayers {
+		layersWithMetadata[layer] = true
+	}
+	var layers []int
+	for layer := range entries {
+		if layersWithMetadata[layer] {
+			layers = append(layers, layer)
+		}
+	}
+
+	var mu sync.Mutex
+	contents := map[string][]byte{}
+	err := l.WalkLayers(ctx, layers, jobs, func(layer int, entry FileEntry, content io.Reader) error {
+		if top, ok := metadataLayers[entry.Path]; !ok || top != layer || !entry.IsRegular() {
+			return nil
+		}
+		data, err := io.ReadAll(io.LimitReader(content, maxMetadataSize))
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		contents[entry.Path] = data
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// the metadata is read from the bottom to the top layer in a fixed
+	// order, as the first dependency that lists a file owns it
+	paths := slices.SortedFunc(maps.Keys(contents), func(a, b string) int {
+		return cmp.Or(cmp.Compare(metadataLayers[a], metadataLayers[b]), strings.Compare(a, b))
+	})
+	for _, p := range paths {
+		idx.readMetadata(p, idx.metadata[p], contents[p])
+	}
+
+	var usage []DependencyUsage
+	for layer, layerEntries := range entries {
+		byDependency := map[*Dependency]*DependencyUsage{}
+		for _, entry := range layerEntries {
+			if !entry.IsRegular() {
+				continue
+			}
+			d := idx.owner(entry.Path)
+			if d == nil {
+				continue
+			}
+			u, ok := byDependency[d]
+			if !ok {
+				u = &DependencyUsage{DiffID: l.DiffIDs[layer], Layer: layer}
+				byDependency[d] = u
+			}
+			u.Size += entry.Size
+			u.Files++
+		}
+		for d, u := range byDependency {
+			u.Dependency = *d
+			usage = append(usage, *u)
+		}
+	}
+
+	slices.SortFunc(usage, func(a, b DependencyUsage) int {
+		return cmp.Or(cmp.Compare(b.Size, a.Size), strings.Compare(a.Path, b.Path), cmp.Compare(a.Layer, b.Layer))
+	})
+	return usage, nil
+}
@@ -0,0 +1,76 @@
+package skiff
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dcermak/skiff/pkg/imagetest"
+)
+
+func TestDependencies(t *testing.T) {
+	ctx := context.Background()
+
+	sitePackages := "usr/lib/python3.11/site-packages/"
+	img := imagetest.Image{Layers: []imagetest.Layer{
+		{Files: []imagetest.File{
+			{Path: sitePackages + "requests-2.31.0.dist-info/METADATA", Content: "Name: requests"},
+			{Path: sitePackages + "requests-2.31.0.dist-info/RECORD", Content: "requests/__init__.py,sha256=abc,100\nrequests-2.31.0.dist-info/METADATA,,\n../../../bin/requests,,\n"},
+			{Path: sitePackages + "requests/__init__.py", Content: strings.Repeat("x", 100)},
+			{Path: "usr/bin/requests", Content: strings.Repeat("x", 10)},
+			{Path: sitePackages + "six.py", Content: strings.Repeat("x", 30)},
+			{Path: "app/node_modules/left-pad/package.json", Content: `{"name": "left-pad", "version": "1.3.0"}`},
+			{Path: "app/node_modules/left-pad/index.js", Content: strings.Repeat("x", 200)},
+			{Path: "app/node_modules/@types/node/package.json", Content: `{"name": "@types/node", "version": "20.1.0"}`},
+			{Path: "app/node_modules/left-pad/node_modules/nested/package.json", Content: `{"version": "0.1.0"}`},
+		}},
+		{Files: []imagetest.File{
+			{Path: "app/node_modules/left-pad/index.js", Content: strings.Repeat("x", 300)},
+			{Path: "usr/lib64/ruby/gems/3.3.0/specifications/rake-13.1.0.gemspec", Content: "spec"},
+			{Path: "usr/lib64/ruby/gems/3.3.0/gems/rake-13.1.0/lib/rake.rb", Content: strings.Repeat("x", 50)},
+			{Path: "root/.m2/repository/org/apache/commons/commons-lang3/3.14.0/commons-lang3-3.14.0.pom", Content: "pom"},
+			{Path: "root/.m2/repository/org/apache/commons/commons-lang3/3.14.0/commons-lang3-3.14.0.jar", Content: strings.Repeat("x", 600)},
+			{Path: "root/go/pkg/mod/github.com/!burnt!sushi/toml@v1.4.0/decode.go", Content: strings.Repeat("x", 70)},
+			{Path: "root/go/pkg/mod/cache/download/github.com/!burnt!sushi/toml/@v/v1.4.0.zip", Content: strings.Repeat("x", 40)},
+			{Path: "root/.cache/go-build/00/0011-d", Content: strings.Repeat("x", 20)},
+		}},
+	}}
+	layers, err := OpenImageLayers(ctx, nil, imagetest.WriteOCILayout(t, img))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer layers.Close()
+
+	entries, err := layers.ReadEntries(ctx, nil, 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	usage, err := layers.Dependencies(ctx, entries, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base, update := layers.DiffIDs[0], layers.DiffIDs[1]
+	expected := []DependencyUsage{
+		{Dependency{EcosystemMaven, "org.apache.commons:commons-lang3", "3.14.0", "/root/.m2/repository/org/apache/commons/commons-lang3/3.14.0"}, update, 1, 603, 2},
+		{Dependency{EcosystemNPM, "left-pad", "1.3.0", "/app/node_modules/left-pad"}, update, 1, 300, 1},
+		{Dependency{EcosystemNPM, "left-pad", "1.3.0", "/app/node_modules/left-pad"}, base, 0, 240, 2},
+		{Dependency{EcosystemPython, "requests", "2.31.0", "/usr/lib/python3.11/site-packages/requests-2.31.0.dist-info"}, base, 0, int64(124 + len(img.Layers[0].Files[1].Content)), 4},
+		{Dependency{EcosystemGo, "github.com/BurntSushi/toml", "v1.4.0", "/root/go/pkg/mod/github.com/!burnt!sushi/toml@v1.4.0"}, update, 1, 70, 1},
+		{Dependency{EcosystemGem, "rake", "13.1.0", "/usr/lib64/ruby/gems/3.3.0/gems/rake-13.1.0"}, update, 1, 50, 1},
+		{Dependency{EcosystemNPM, "@types/node", "20.1.0", "/app/node_modules/@types/node"}, base, 0, 44, 1},
+		{Dependency{EcosystemGo, "module cache", "", "/root/go/pkg/mod/cache"}, update, 1, 40, 1},
+		{Dependency{EcosystemNPM, "nested", "0.1.0", "/app/node_modules/left-pad/node_modules/nested"}, base, 0, 20, 1},
+		{Dependency{EcosystemGo, "build cache", "", "/root/.cache/go-build"}, update, 1, 20, 1},
+	}
+	if !reflect.DeepEqual(usage, expected) {
+		t.Errorf("Expected:\n%+v\ngot:\n%+v", expected, usage)
+	}
+}
+
+func TestUnescapeModulePath(t *testing.T) {
+	if got := unescapeModulePath("github.com/!burnt!sushi/toml"); got != "github.com/BurntSushi/toml" {
+		t.Errorf("Expected github.com/BurntSushi/toml, got %s", got)
+	}
+}
@@ -0,0 +1,204 @@
+package skiff
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// ChangeKind describes how a file differs between two filesystems.
+type ChangeKind string
+
+const (
+	FileAdded   ChangeKind = "added"
+	FileRemoved ChangeKind = "removed"
+	FileChanged ChangeKind = "changed"
+)
+
+// FileChange is a file that differs between two filesystems.
+type FileChange struct {
+	Path string
+	Kind ChangeKind
+	// Old is the entry in the first filesystem, nil if the file was added
+	Old *FileEntry
+	// New is the entry in the second filesystem, nil if the file was
+	// removed
+	New *FileEntry
+	// Changes lists the attributes that differ between Old and New, it is
+	// only set for changed files
+	Changes []string
+}
+
+// SizeDelta returns the number of bytes that the change adds to the second
+// filesystem. The result is negative if the file shrank or was removed.
+func (c FileChange) SizeDelta() int64 {
+	var delta int64
+	if c.New != nil {
+		delta += c.New.Size
+	}
+	if c.Old != nil {
+		delta -= c.Old.Size
+	}
+	return delta
+}
+
+// compareEntries returns the list of attributes that differ between old and
+// new.
+func compareEntries(old, new FileEntry) []string {
+	var changes []string
+	if old.Typeflag != new.Typeflag {
+		changes = append(changes, "type")
+	}
+	if old.Size != new.Size {
+		changes = append(changes, "size")
+	}
+	if old.Mode != new.Mode {
+		changes = append(changes, "mode")
+	}
+	if old.UID != new.UID || old.GID != new.GID {
+		changes = append(changes, "owner")
+	}
+	if old.Linkname != new.Linkname {
+		changes = append(changes, "link")
+	}
+	if old.Digest != "" && new.Digest != "" && old.Digest != new.Digest {
+		changes = append(changes, "content")
+	}
+	return changes
+}
+
+// DiffFilesystems returns all files that were added, removed or changed in the
+// filesystem b compared to the filesystem a, sorted by path.
+//
+// Directories are not reported, as adding or removing a directory is already
+// reflected by its contents. Files that were provided by a layer with the
+// same diffID in both filesystems are considered equal.
+func DiffFilesystems(a, b *Filesystem) []FileChange {
+	var changes []FileChange
+	diffNodes(a.Root(), b.Root(), &changes)
+	return changes
+}
+
+// ContentCandidates returns the paths of the regular files in b whose content
+// has to be hashed to tell whether they differ from the file at the same path
+// in a: all other attributes of the two entries are equal, but they were
+// provided by layers with different diffIDs.
+func ContentCandidates(a, b *Filesystem) []string {
+	var paths []string
+	_ = b.Walk(func(n *Node) error {
+		if !n.Entry.IsRegular() {
+			return nil
+		}
+		o := a.Lookup(n.Entry.Path)
+		if o != nil && o.Entry.IsRegular() && !sameLayer(o.DiffID, n.DiffID) && len(compareEntries(o.Entry, n.Entry)) == 0 {
+			paths = append(paths, n.Entry.Path)
+		}
+		return nil
+	})
+	return paths
+}
+
+// DigestFiles hashes the content of the regular files at the given paths in fs,
+// which has to be the merged filesystem of l, and stores it in the Digest field
+// of their entries. Only the layers that provide one of the files are read, up
+// to jobs of them concurrently.
+func (l *ImageLayers) DigestFiles(ctx context.Context, fs *Filesystem, paths []string, jobs int) error {
+	byLayer := map[int]map[string]*Node{}
+	for _, p := range paths {
+		n := fs.Lookup(p)
+		if n == nil || !n.Entry.IsRegular() {
+			continue
+		}
+		if byLayer[n.Layer] == nil {
+			byLayer[n.Layer] = map[string]*Node{}
+		}
+		byLayer[n.Layer][n.Entry.Path] = n
+	}
+	layers := make([]int, 0, len(byLayer))
+	for layer := range byLayer {
+		layers = append(layers, layer)
+	}
+
+	// every node is provided by a single layer, so the layers can set the
+	// digests concurrently
+	return l.WalkLayers(ctx, layers, jobs, func(layer int, entry FileEntry, content io.Reader) error {
+		n, ok := byLayer[layer][entry.Path]
+		if !ok || !entry.IsRegular() {
+			return nil
+		}
+		d, err := digest.Canonical.FromReader(content)
+		if err != nil {
+			return fmt.Errorf("failed to hash %s: %w", entry.Path, err)
+		}
+		// a later entry for the same path in the layer replaces the
+		// earlier one
+		n.Entry.Digest = d
+		return nil
+	})
+}
+
+func diffNodes(old, new *Node, changes *[]FileChange) {
+	oldChildren, newChildren := old.Children(), new.Children()
+
+	// both slices are sorted by name => merge them like in merge sort
+	i, j := 0, 0
+	for i < len(oldChildren) || j < len(newChildren) {
+		switch {
+		case j >= len(newChildren) || (i < len(oldChildren) && oldChildren[i].Name < newChildren[j].Name):
+			reportSubtree(oldChildren[i], FileRemoved, changes)
+			i++
+		case i >= len(oldChildren) || newChildren[j].Name < oldChildren[i].Name:
+			reportSubtree(newChildren[j], FileAdded, changes)
+			j++
+		default:
+			o, n := oldChildren[i], newChildren[j]
+			i++
+			j++
+
+			switch {
+			case o.Entry.IsDir() && n.Entry.IsDir():
+				diffNodes(o, n, changes)
+			case o.Entry.IsDir() || n.Entry.IsDir():
+				reportSubtree(o, FileRemoved, changes)
+				reportSubtree(n, FileAdded, changes)
+			case sameLayer(o.DiffID, n.DiffID):
+				// identical layers provide identical files
+			default:
+				if c := compareEntries(o.Entry, n.Entry); len(c) > 0 {
+					oldEntry, newEntry := o.Entry, n.Entry
+					*changes = append(*changes, FileChange{
+						Path:    n.Entry.Path,
+						Kind:    FileChanged,
+						Old:     &oldEntry,
+						New:     &newEntry,
+						Changes: c,
+					})
+				}
+			}
+		}
+	}
+}
+
+func sameLayer(a, b digest.Digest) bool {
+	return a != "" && a == b
+}
+
+// reportSubtree adds all files below n (including n) as added or removed
+func reportSubtree(n *Node, kind ChangeKind, changes *[]FileChange) {
+	if !n.Entry.IsDir() {
+		entry := n.Entry
+		c := FileChange{Path: entry.Path, Kind: kind}
+		if kind == FileAdded {
+			c.New = &entry
+		} else {
+			c.Old = &entry
+		}
+		*changes = append(*changes, c)
+		return
+	}
+	for _, child := range n.Children() {
+		reportSubtree(child, kind, changes)
+	}
+}
@@ -0,0 +1,136 @@
+package skiff
+
+import (
+	"archive/tar"
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/dcermak/skiff/pkg/imagetest"
+)
+
+func TestDiffFilesystems(t *testing.T) {
+	base := []FileEntry{
+		regularFile("/usr/bin/tool", 100),
+		regularFile("/usr/lib/removed", 50),
+		regularFile("/etc/config", 10),
+		directory("/var/data"),
+		regularFile("/var/data/file", 10),
+	}
+
+	a := NewFilesystem()
+	a.ApplyLayer("sha256:base", base)
+	a.ApplyLayer("sha256:old", []FileEntry{
+		{Path: "/etc/config", Typeflag: tar.TypeReg, Size: 10, Digest: "sha256:aaaa"},
+		regularFile("/etc/same", 20),
+	})
+
+	b := NewFilesystem()
+	b.ApplyLayer("sha256:base", base)
+	b.ApplyLayer("sha256:new", []FileEntry{
+		{Path: "/etc/config", Typeflag: tar.TypeReg, Size: 10, Digest: "sha256:bbbb"},
+		regularFile("/etc/same", 20),
+		regularFile("/usr/lib/.wh.removed", 0),
+		regularFile("/usr/bin/added", 30),
+		{Path: "/usr/bin/tool", Typeflag: tar.TypeReg, Size: 100, Mode: 0o755, UID: 1},
+		regularFile("/var/data", 5),
+	})
+
+	changes := DiffFilesystems(a, b)
+
+	expected := []struct {
+		path    string
+		kind    ChangeKind
+		changes []string
+		delta   int64
+	}{
+		{"/etc/config", FileChanged, []string{"content"}, 0},
+		{"/usr/bin/added", FileAdded, nil, 30},
+		{"/usr/bin/tool", FileChanged, []string{"mode", "owner"}, 0},
+		{"/usr/lib/removed", FileRemoved, nil, -50},
+		{"/var/data/file", FileRemoved, nil, -10},
+		{"/var/data", FileAdded, nil, 5},
+	}
+
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected %d changes, got %d: %+v", len(expected), len(changes), changes)
+	}
+	for i, e := range expected {
+		c := changes[i]
+		if c.Path != e.path || c.Kind != e.kind {
+			t.Errorf("Expected change %d to be %s %s, got %s %s", i, e.kind, e.path, c.Kind, c.Path)
+		}
+		if !slices.Equal(c.Changes, e.changes) {
+			t.Errorf("Expected changes of %s to be %v, got %v", e.path, e.changes, c.Changes)
+		}
+		if c.SizeDelta() != e.delta {
+			t.Errorf("Expected size delta of %s to be %d, got %d", e.path, e.delta, c.SizeDelta())
+		}
+	}
+}
+
+func TestDigestFilesOnlyHashesCandidates(t *testing.T) {
+	base := imagetest.Layer{Files: []imagetest.File{{Path: "etc/shared", Content: "shared"}}}
+	from := imagetest.Image{Layers: []imagetest.Layer{base, {Files: []imagetest.File{
+		{Path: "etc/config", Content: "aaaa"},
+		{Path: "etc/grown", Content: "x"},
+		{Path: "etc/same", Content: "same"},
+	}}}}
+	to := imagetest.Image{Layers: []imagetest.Layer{base, {Files: []imagetest.File{
+		{Path: "etc/config", Content: "bbbb"},
+		{Path: "etc/grown", Content: "xx"},
+		{Path: "etc/same", Content: "same"},
+	}}}}
+
+	reporter := &openedReporter{}
+	ctx := WithProgressReporter(context.Background(), reporter)
+	merge := func(img imagetest.Image) (*ImageLayers, *Filesystem) {
+		layers, err := OpenImageLayers(ctx, nil, imagetest.WriteOCILayout(t, img))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { layers.Close() })
+		fs, err := layers.Merge(ctx, 2, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return layers, fs
+	}
+	fromLayers, fromFs := merge(from)
+	toLayers, toFs := merge(to)
+
+	candidates := ContentCandidates(fromFs, toFs)
+	if expected := []string{"/etc/config", "/etc/same"}; !slices.Equal(candidates, expected) {
+		t.Fatalf("Expected the candidates %v, got %v", expected, candidates)
+	}
+
+	reporter.opened.Store(0)
+	if err := fromLayers.DigestFiles(ctx, fromFs, candidates, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := toLayers.DigestFiles(ctx, toFs, candidates, 2); err != nil {
+		t.Fatal(err)
+	}
+	// only the top layer of each image provides a candidate
+	if opened := reporter.opened.Load(); opened != 2 {
+		t.Errorf("Expected 2 opened layers, got %d", opened)
+	}
+	for _, fs := range []*Filesystem{fromFs, toFs} {
+		for _, p := range []string{"/etc/shared", "/etc/grown"} {
+			if d := fs.Lookup(p).Entry.Digest; d != "" {
+				t.Errorf("Expected %s not to be hashed, got %s", p, d)
+			}
+		}
+		if fs.Lookup("/etc/same").Entry.Digest == "" {
+			t.Errorf("Expected /etc/same to be hashed")
+		}
+	}
+
+	var changes []string
+	for _, c := range DiffFilesystems(fromFs, toFs) {
+		changes = append(changes, c.Path+":"+c.Changes[0])
+	}
+	if expected := []string{"/etc/config:content", "/etc/grown:size"}; !slices.Equal(changes, expected) {
+		t.Errorf("Expected the changes %v, got %v", expected, changes)
+	}
+}
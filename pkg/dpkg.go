@@ -0,0 +1,129 @@
+package skiff
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// isDpkgFileList returns true if p is the list of files of a package in the
+// info directory next to the dpkg status file at statusPath
+func isDpkgFileList(statusPath, p string) bool {
+	return path.Dir(p) == path.Join(path.Dir(statusPath), "info") && strings.HasSuffix(p, ".list")
+}
+
+// readDeb822 invokes fn for every paragraph of a file in the deb822 format
+// (the format of debian/control) with the fields of the paragraph. Field
+// names are converted to lower case and continuation lines are dropped, as
+// none of the fields that skiff needs span multiple lines.
+func readDeb822(r io.Reader, fn func(fields map[string]string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	fields := map[string]string{}
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.TrimSpace(line) == "":
+			if len(fields) > 0 {
+				if err := fn(fields); err != nil {
+					return err
+				}
+				fields = map[string]string{}
+			}
+		case line[0] == ' ' || line[0] == '\t':
+			// continuation of the previous field
+		default:
+			name, value, ok := strings.Cut(line, ":")
+			if !ok {
+				return fmt.Errorf("invalid line %q", line)
+			}
+			fields[strings.ToLower(name)] = strings.TrimSpace(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(fields) > 0 {
+		return fn(fields)
+	}
+	return nil
+}
+
+// readDpkgDatabase reads the packages from the dpkg status file at statusPath
+// below root and their files from the file lists in the info directory next to
+// it. Packages that were removed without purging their configuration files
+// are skipped.
+func readDpkgDatabase(root, statusPath string) ([]Package, error) {
+	f, err := os.Open(filepath.Join(root, statusPath))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	infoDir := filepath.Join(root, path.Dir(statusPath), "info")
+	var packages []Package
+	err = readDeb822(f, func(fields map[string]string) error {
+		if status := strings.Fields(fields["status"]); len(status) == 3 && (status[2] == "not-installed" || status[2] == "config-files") {
+			return nil
+		}
+
+		pkg := Package{
+			Name:          fields["package"],
+			Version:       fields["version"],
+			Arch:          fields["architecture"],
+			InstalledSize: -1,
+		}
+		if pkg.Name == "" {
+			return fmt.Errorf("package without a name")
+		}
+		if size, err := strconv.ParseInt(fields["installed-size"], 10, 64); err == nil {
+			// the installed size is stored in KiB
+			pkg.InstalledSize = size * 1024
+		}
+
+		// the file lists of packages that are installed for several
+		// architectures (Multi-Arch: same) contain the architecture
+		for _, name := range []string{pkg.Name + ":" + pkg.Arch + ".list", pkg.Name + ".list"} {
+			files, err := readDpkgFileList(filepath.Join(infoDir, name))
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			pkg.Files = files
+			break
+		}
+		packages = append(packages, pkg)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", statusPath, err)
+	}
+	return packages, nil
+}
+
+// readDpkgFileList reads the paths of the files of a package from its file
+// list. The list also contains the directories of the package.
+func readDpkgFileList(listPath string) ([]string, error) {
+	f, err := os.Open(listPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var files []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if p := scanner.Text(); p != "" && p != "/." {
+			files = append(files, path.Clean(p))
+		}
+	}
+	return files, scanner.Err()
+}
@@ -0,0 +1,301 @@
+package skiff
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	"go.podman.io/storage/pkg/archive"
+)
+
+// Node is an entry in the merged filesystem of an image.
+type Node struct {
+	Name  string
+	Entry FileEntry
+	// DiffID is the diffID of the layer that provided this entry
+	DiffID digest.Digest
+	// Layer is the index of the layer that provided this entry, with 0 being
+	// the bottom layer
+	Layer int
+
+	parent   *Node
+	children map[string]*Node
+}
+
+// Children returns the direct children of the node sorted by name.
+func (n *Node) Children() []*Node {
+	children := make([]*Node, 0, len(n.children))
+	for _, c := range n.children {
+		children = append(children, c)
+	}
+	slices.SortFunc(children, func(a, b *Node) int { return strings.Compare(a.Name, b.Name) })
+	return children
+}
+
+// ShadowedFile is a file that was written in one layer and was then either
+// overwritten or deleted in a later layer. It is not visible in the final
+// root filesystem, but its bytes are still part of the image.
+type ShadowedFile struct {
+	FileEntry
+	// DiffID is the diffID of the layer that wrote the file
+	DiffID digest.Digest
+	// Layer is the index of the layer that wrote the file
+	Layer int
+	// ShadowedBy is the diffID of the layer that hid the file
+	ShadowedBy digest.Digest
+	// ShadowedByLayer is the index of the layer that hid the file
+	ShadowedByLayer int
+	// Deleted is true if the file was removed via a whiteout and false if
+	// it was overwritten
+	Deleted bool
+}
+
+// Filesystem is the root filesystem that results from applying the layers of
+// an image on top of each other, in the same way as a container runtime would.
+//
+// Whiteouts (`.wh.<name>`) and opaque directories (`.wh..wh..opq`) are
+// honored and remove entries from the lower layers. Files that are hidden this
+// way are recorded as shadowed files.
+type Filesystem struct {
+	root     *Node
+	layers   []digest.Digest
+	shadowed []ShadowedFile
+}
+
+// NewFilesystem creates an empty filesystem.
+func NewFilesystem() *Filesystem {
+	return &Filesystem{
+		root: &Node{
+			Name:     "/",
+			Entry:    FileEntry{Path: "/", Typeflag: tar.TypeDir, Mode: 0o755},
+			Layer:    -1,
+			children: map[string]*Node{},
+		},
+	}
+}
+
+// Layers returns the diffIDs of the layers that have been applied so far.
+func (fs *Filesystem) Layers() []digest.Digest {
+	return fs.layers
+}
+
+// Shadowed returns all files that were hidden by an upper layer, in the order
+// in which they were hidden.
+func (fs *Filesystem) Shadowed() []ShadowedFile {
+	return fs.shadowed
+}
+
+// Root returns the root directory of the filesystem.
+func (fs *Filesystem) Root() *Node {
+	return fs.root
+}
+
+// Lookup returns the node at the absolute path p or nil if no such entry
+// exists.
+func (fs *Filesystem) Lookup(p string) *Node {
+	n := fs.root
+	for _, name := range splitPath(p) {
+		n = n.children[name]
+		if n == nil {
+			return nil
+		}
+	}
+	return n
+}
+
+// maxSymlinks is the maximum number of symbolic links that Resolve follows,
+// like the limit of the Linux kernel
+const maxSymlinks = 40
+
+// ErrSymlinkLoop is returned by Resolve if a path cannot be resolved without
+// following more than 40 symbolic links, which usually means that the links
+// form a loop.
+var ErrSymlinkLoop = errors.New("too many levels of symbolic links")
+
+// Resolve returns the node at the absolute path p like Lookup, but follows
+// symbolic links in all components of p, including the last one. Absolute
+// link targets are resolved against the root of the filesystem, so that links
+// can never point outside of it. nil is returned if p or the target of a link
+// does not exist.
+func (fs *Filesystem) Resolve(p string) (*Node, error) {
+	followed := 0
+	names := rawSplitPath(p)
+	n := fs.root
+	for len(names) > 0 {
+		name := names[0]
+		names = names[1:]
+
+		switch name {
+		case ".":
+			continue
+		case "..":
+			if n.parent != nil {
+				n = n.parent
+			}
+			continue
+		}
+
+		c := n.children[name]
+		if c == nil {
+			return nil, nil
+		}
+		if c.Entry.Typeflag != tar.TypeSymlink {
+			n = c
+			continue
+		}
+
+		followed++
+		if followed > maxSymlinks {
+			return nil, fmt.Errorf("%s: %w", p, ErrSymlinkLoop)
+		}
+		// relative targets are resolved against the directory
+		// containing the link, which is n
+		if path.IsAbs(c.Entry.Linkname) {
+			n = fs.root
+		}
+		names = append(rawSplitPath(c.Entry.Linkname), names...)
+	}
+	return n, nil
+}
+
+// Walk calls fn for every node in the filesystem in lexical order, starting
+// with the root directory. Returning an error from fn aborts the walk.
+func (fs *Filesystem) Walk(fn func(n *Node) error) error {
+	return walkNode(fs.root, fn)
+}
+
+func walkNode(n *Node, fn func(n *Node) error) error {
+	if err := fn(n); err != nil {
+		return err
+	}
+	for _, c := range n.Children() {
+		if err := walkNode(c, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ApplyLayer applies the entries of the layer with the given diffID on top of
+// the filesystem. The entries have to be passed in the order in which they
+// appear in the layer archive.
+func (fs *Filesystem) ApplyLayer(diffID digest.Digest, entries []FileEntry) {
+	layer := len(fs.layers)
+	fs.layers = append(fs.layers, diffID)
+
+	for _, entry := range entries {
+		dir, base := path.Split(entry.Path)
+
+		switch {
+		case base == archive.WhiteoutOpaqueDir:
+			if n := fs.Lookup(dir); n != nil {
+				for _, c := range n.Children() {
+					fs.hide(c, layer, true)
+				}
+			}
+		case strings.HasPrefix(base, archive.WhiteoutMetaPrefix):
+			// other AUFS metadata, not part of the filesystem
+		case strings.HasPrefix(base, archive.WhiteoutPrefix):
+			if n := fs.Lookup(path.Join(dir, strings.TrimPrefix(base, archive.WhiteoutPrefix))); n != nil && n != fs.root {
+				fs.hide(n, layer, true)
+			}
+		default:
+			fs.add(entry, layer)
+		}
+	}
+}
+
+// add inserts entry into the filesystem, creating missing parent directories
+// and shadowing any entry that already exists at the same path.
+func (fs *Filesystem) add(entry FileEntry, layer int) {
+	names := splitPath(entry.Path)
+	if len(names) == 0 {
+		fs.root.Entry = entry
+		return
+	}
+
+	parent := fs.root
+	for i, name := range names[:len(names)-1] {
+		n := parent.children[name]
+		if n != nil && !n.Entry.IsDir() {
+			fs.hide(n, layer, false)
+			n = nil
+		}
+		if n == nil {
+			n = fs.newNode(parent, name, FileEntry{
+				Path:     "/" + path.Join(names[:i+1]...),
+				Typeflag: tar.TypeDir,
+				Mode:     0o755,
+			}, layer)
+		}
+		parent = n
+	}
+
+	name := names[len(names)-1]
+	if existing := parent.children[name]; existing != nil {
+		if existing.Entry.IsDir() && entry.IsDir() {
+			existing.Entry = entry
+			existing.DiffID = fs.layers[layer]
+			existing.Layer = layer
+			return
+		}
+		fs.hide(existing, layer, false)
+	}
+	fs.newNode(parent, name, entry, layer)
+}
+
+func (fs *Filesystem) newNode(parent *Node, name string, entry FileEntry, layer int) *Node {
+	n := &Node{
+		Name:   name,
+		Entry:  entry,
+		DiffID: fs.layers[layer],
+		Layer:  layer,
+		parent: parent,
+	}
+	if entry.IsDir() {
+		n.children = map[string]*Node{}
+	}
+	parent.children[name] = n
+	return n
+}
+
+// hide removes everything below n (including n) that was provided by a layer
+// below layer and records the removed files as shadowed.
+func (fs *Filesystem) hide(n *Node, layer int, deleted bool) {
+	for _, c := range n.Children() {
+		fs.hide(c, layer, deleted)
+	}
+	if n.Layer >= layer || len(n.children) > 0 {
+		return
+	}
+
+	if !n.Entry.IsDir() {
+		fs.shadowed = append(fs.shadowed, ShadowedFile{
+			FileEntry:       n.Entry,
+			DiffID:          n.DiffID,
+			Layer:           n.Layer,
+			ShadowedBy:      fs.layers[layer],
+			ShadowedByLayer: layer,
+			Deleted:         deleted,
+		})
+	}
+	delete(n.parent.children, n.Name)
+}
+
+// rawSplitPath splits p into its components without cleaning it, so that
+// `..` can be resolved after following symbolic links.
+func rawSplitPath(p string) []string {
+	return strings.FieldsFunc(p, func(r rune) bool { return r == '/' })
+}
+
+func splitPath(p string) []string {
+	p = strings.Trim(path.Clean("/"+p), "/")
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
@@ -0,0 +1,210 @@
+package skiff
+
+import (
+	"archive/tar"
+	"errors"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+)
+
+func regularFile(path string, size int64) FileEntry {
+	return FileEntry{Path: path, Typeflag: tar.TypeReg, Size: size}
+}
+
+func directory(path string) FileEntry {
+	return FileEntry{Path: path, Typeflag: tar.TypeDir}
+}
+
+func TestFilesystemApplyLayer(t *testing.T) {
+	lower := digest.Digest("sha256:lower")
+	upper := digest.Digest("sha256:upper")
+
+	fs := NewFilesystem()
+	fs.ApplyLayer(lower, []FileEntry{
+		directory("/usr"),
+		regularFile("/usr/big", 5000),
+		regularFile("/usr/keep", 300),
+		directory("/etc/cache"),
+		regularFile("/etc/cache/a", 700),
+		regularFile("/etc/cache/b", 800),
+		regularFile("/etc/passwd", 10),
+		regularFile("/var/lib/file", 20),
+	})
+	fs.ApplyLayer(upper, []FileEntry{
+		regularFile("/usr/.wh.big", 0),
+		regularFile("/usr/keep", 600),
+		directory("/etc/cache"),
+		regularFile("/etc/cache/.wh..wh..opq", 0),
+		regularFile("/etc/cache/c", 50),
+		regularFile("/var/lib", 1),
+	})
+
+	tests := []struct {
+		path   string
+		exists bool
+		size   int64
+		diffID digest.Digest
+	}{
+		{"/usr/big", false, 0, ""},
+		{"/usr/keep", true, 600, upper},
+		{"/etc/cache/a", false, 0, ""},
+		{"/etc/cache/b", false, 0, ""},
+		{"/etc/cache/c", true, 50, upper},
+		{"/etc/cache", true, 0, upper},
+		{"/etc/passwd", true, 10, lower},
+		{"/var/lib/file", false, 0, ""},
+		{"/var/lib", true, 1, upper},
+		{"/usr/.wh.big", false, 0, ""},
+		{"/etc/cache/.wh..wh..opq", false, 0, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			n := fs.Lookup(tt.path)
+			if !tt.exists {
+				if n != nil {
+					t.Errorf("Expected %s to not exist, got %+v", tt.path, n.Entry)
+				}
+				return
+			}
+			if n == nil {
+				t.Fatalf("Expected %s to exist", tt.path)
+			}
+			if n.Entry.Size != tt.size {
+				t.Errorf("Expected %s to have size %d, got %d", tt.path, tt.size, n.Entry.Size)
+			}
+			if n.DiffID != tt.diffID {
+				t.Errorf("Expected %s to come from %s, got %s", tt.path, tt.diffID, n.DiffID)
+			}
+		})
+	}
+
+	expectedShadowed := map[string]bool{
+		"/usr/big":      true,
+		"/usr/keep":     false,
+		"/etc/cache/a":  true,
+		"/etc/cache/b":  true,
+		"/var/lib/file": false,
+	}
+	shadowed := fs.Shadowed()
+	if len(shadowed) != len(expectedShadowed) {
+		t.Fatalf("Expected %d shadowed files, got %d: %+v", len(expectedShadowed), len(shadowed), shadowed)
+	}
+	for _, s := range shadowed {
+		deleted, ok := expectedShadowed[s.Path]
+		if !ok {
+			t.Errorf("Unexpected shadowed file %s", s.Path)
+			continue
+		}
+		if s.Deleted != deleted {
+			t.Errorf("Expected %s to have Deleted=%t", s.Path, deleted)
+		}
+		if s.DiffID != lower || s.ShadowedBy != upper {
+			t.Errorf("Expected %s to be written by %s and hidden by %s, got %s and %s", s.Path, lower, upper, s.DiffID, s.ShadowedBy)
+		}
+	}
+}
+
+func TestFilesystemWhiteoutOnlyAffectsLowerLayers(t *testing.T) {
+	fs := NewFilesystem()
+	fs.ApplyLayer("sha256:lower", []FileEntry{regularFile("/dir/old", 1)})
+	// the opaque marker can appear after entries of the same layer
+	fs.ApplyLayer("sha256:upper", []FileEntry{
+		directory("/dir"),
+		regularFile("/dir/new", 2),
+		regularFile("/dir/.wh..wh..opq", 0),
+	})
+
+	if fs.Lookup("/dir/old") != nil {
+		t.Errorf("Expected /dir/old to be removed by the opaque directory")
+	}
+	if fs.Lookup("/dir/new") == nil {
+		t.Errorf("Expected /dir/new to survive the opaque marker of its own layer")
+	}
+}
+
+func TestFilesystemWalk(t *testing.T) {
+	fs := NewFilesystem()
+	fs.ApplyLayer("sha256:layer", []FileEntry{
+		regularFile("/b/file", 1),
+		regularFile("/a", 1),
+	})
+
+	var paths []string
+	err := fs.Walk(func(n *Node) error {
+		paths = append(paths, n.Entry.Path)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []string{"/", "/a", "/b", "/b/file"}
+	if len(paths) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, paths)
+	}
+	for i := range expected {
+		if paths[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected, paths)
+			break
+		}
+	}
+}
+
+func symlink(path, target string) FileEntry {
+	return FileEntry{Path: path, Typeflag: tar.TypeSymlink, Linkname: target}
+}
+
+func TestFilesystemResolve(t *testing.T) {
+	fs := NewFilesystem()
+	fs.ApplyLayer("sha256:base", []FileEntry{
+		directory("/usr"),
+		directory("/usr/lib"),
+		regularFile("/usr/lib/libfoo.so.1.2", 100),
+		symlink("/usr/lib/libfoo.so.1", "libfoo.so.1.2"),
+		symlink("/usr/lib/libfoo.so", "./libfoo.so.1"),
+		symlink("/lib", "usr/lib"),
+		symlink("/usr/lib64", "/lib"),
+		symlink("/usr/up", "../usr/lib/libfoo.so"),
+		symlink("/escape", "../../../usr/lib/libfoo.so.1.2"),
+		symlink("/dangling", "/nonexistent"),
+		symlink("/loop-a", "loop-b"),
+		symlink("/loop-b", "/loop-a"),
+	})
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/usr/lib/libfoo.so.1.2", "/usr/lib/libfoo.so.1.2"},
+		{"/usr/lib/libfoo.so", "/usr/lib/libfoo.so.1.2"},
+		{"/lib/libfoo.so", "/usr/lib/libfoo.so.1.2"},
+		{"/usr/lib64/libfoo.so.1", "/usr/lib/libfoo.so.1.2"},
+		{"/usr/up", "/usr/lib/libfoo.so.1.2"},
+		{"/escape", "/usr/lib/libfoo.so.1.2"},
+		{"/lib", "/usr/lib"},
+		{"/dangling", ""},
+		{"/usr/lib/libfoo.so.1.2/file", ""},
+	}
+	for _, tt := range tests {
+		n, err := fs.Resolve(tt.path)
+		if err != nil {
+			t.Errorf("Resolving %s failed: %v", tt.path, err)
+			continue
+		}
+		if tt.expected == "" {
+			if n != nil {
+				t.Errorf("Expected %s not to exist, got %s", tt.path, n.Entry.Path)
+			}
+			continue
+		}
+		if n == nil || n.Entry.Path != tt.expected {
+			t.Errorf("Expected %s to resolve to %s, got %v", tt.path, tt.expected, n)
+		}
+	}
+
+	if _, err := fs.Resolve("/loop-a"); !errors.Is(err, ErrSymlinkLoop) {
+		t.Errorf("Expected a symlink loop to be detected, got %v", err)
+	}
+}
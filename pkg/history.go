@@ -0,0 +1,55 @@
+package skiff
+
+import imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+
+// LayerHistory returns the history entries of the image config that created
+// the layers of the image, in the same order as the layers. Entries of build
+// steps that did not create a layer (e.g. `ENV` or `LABEL`) are skipped.
+//
+// nil is returned if the number of history entries that created a layer does
+// not match numLayers, as the history cannot be mapped onto the layers in
+// that case.
+func LayerHistory(conf *imgspecv1.Image, numLayers int) []imgspecv1.History {
+	if conf == nil {
+		return nil
+	}
+
+	history := make([]imgspecv1.History, 0, numLayers)
+	for _, h := range conf.History {
+		if !h.EmptyLayer {
+			history = append(history, h)
+		}
+	}
+	if len(history) != numLayers {
+		return nil
+	}
+	return history
+}
+
+// InsertEmptyLayers returns the layers with an entry for every build step of
+// the image history that did not create a layer (e.g. `ENV` or `LABEL`)
+// inserted at the position in which it was executed.
+//
+// The layers are returned unchanged if the history cannot be mapped onto the
+// layers.
+func InsertEmptyLayers(layers []LayerReport, conf *imgspecv1.Image) []LayerReport {
+	if LayerHistory(conf, len(layers)) == nil {
+		return layers
+	}
+
+	res := make([]LayerReport, 0, len(conf.History))
+	i := 0
+	for _, h := range conf.History {
+		if !h.EmptyLayer {
+			res = append(res, layers[i])
+			i++
+			continue
+		}
+		report := LayerReport{CreatedBy: h.CreatedBy, Comment: h.Comment, EmptyLayer: true, CompressionRatio: -1}
+		if h.Created != nil {
+			report.Created = *h.Created
+		}
+		res = append(res, report)
+	}
+	return res
+}
@@ -0,0 +1,62 @@
+package skiff
+
+import (
+	"testing"
+	"time"
+
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestLayerHistory(t *testing.T) {
+	conf := &imgspecv1.Image{
+		History: []imgspecv1.History{
+			{CreatedBy: "ADD rootfs.tar /"},
+			{CreatedBy: "ENV FOO=bar", EmptyLayer: true},
+			{CreatedBy: "RUN zypper in python3"},
+			{CreatedBy: "LABEL foo=bar", EmptyLayer: true},
+		},
+	}
+
+	history := LayerHistory(conf, 2)
+	if len(history) != 2 {
+		t.Fatalf("Expected 2 history entries, got %d", len(history))
+	}
+	if history[0].CreatedBy != "ADD rootfs.tar /" || history[1].CreatedBy != "RUN zypper in python3" {
+		t.Errorf("Unexpected history entries: %+v", history)
+	}
+
+	if history := LayerHistory(conf, 3); history != nil {
+		t.Errorf("Expected no history for a mismatching number of layers, got %+v", history)
+	}
+	if history := LayerHistory(nil, 2); history != nil {
+		t.Errorf("Expected no history without an image config, got %+v", history)
+	}
+}
+
+func TestInsertEmptyLayers(t *testing.T) {
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	conf := &imgspecv1.Image{
+		History: []imgspecv1.History{
+			{CreatedBy: "ADD rootfs.tar /"},
+			{CreatedBy: "ENV FOO=bar", EmptyLayer: true, Created: &created, Comment: "env"},
+			{CreatedBy: "RUN zypper in python3"},
+		},
+	}
+	layers := []LayerReport{{DiffID: "sha256:aaaa"}, {DiffID: "sha256:bbbb"}}
+
+	res := InsertEmptyLayers(layers, conf)
+	if len(res) != 3 {
+		t.Fatalf("Expected 3 entries, got %d: %+v", len(res), res)
+	}
+	if res[0].DiffID != "sha256:aaaa" || res[2].DiffID != "sha256:bbbb" {
+		t.Errorf("Layers are not in the order of the history: %+v", res)
+	}
+	empty := res[1]
+	if !empty.EmptyLayer || empty.CreatedBy != "ENV FOO=bar" || empty.Comment != "env" || !empty.Created.Equal(created) {
+		t.Errorf("Unexpected empty layer entry: %+v", empty)
+	}
+
+	if res := InsertEmptyLayers(layers[:1], conf); len(res) != 1 {
+		t.Errorf("Expected the layers to be unchanged for a mismatching history, got %+v", res)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/opencontainers/go-digest"
 	"go.podman.io/common/libimage"
@@ -43,38 +45,72 @@ func layersFromImageDigest(store storage.Store, digest digest.Digest) ([]storage
 	return nil, fmt.Errorf("Did not find image %s in the image store", digest)
 }
 
+// localStore opens the local container storage.
+func localStore() (storage.Store, error) {
+	opts, err := storage.DefaultStoreOptions()
+	if err != nil {
+		return nil, err
+	}
+	return storage.GetStore(opts)
+}
+
+// localRuntime opens the local container storage.
+func localRuntime() (*libimage.Runtime, storage.Store, error) {
+	store, err := localStore()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	runtime, err := libimage.RuntimeFromStore(store, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return runtime, store, nil
+}
+
 // ImageAndLayersFromURI tries to obtain the image from the "most likely source"
 //
 // If the uri includes a transport, then the uri is parsed and an Image instance
 // is returned.
 //
-// If the uri does not contain a transport, then this function first tries to
-// load the image from the (rootless) container storage. If that fails, we try
-// to load it from a registry by prepending the `docker://` transport.
+// Uris with a transport (e.g. `oci:`, `oci-archive:`, `docker-archive:` or
+// `dir:`) are opened with that transport.
+//
+// If the uri does not contain a transport, then this function first checks
+// whether it is the path of an OCI layout, `dir:` directory or an OCI or
+// docker archive. Otherwise it tries to load the image from the (rootless)
+// container storage. If that fails, we try to load it from a registry by
+// prepending the `docker://` transport.
 //
 // If the image is present in the local container store, then we also return the
 // layers of that image.
-func ImageAndLayersFromURI(ctx context.Context, sysCtx *types.SystemContext, uri string) (types.Image, []storage.Layer, error) {
+//
+// The caller has to close the returned image. Images from archives are
+// extracted into a temporary directory that is removed once the image is
+// closed.
+func ImageAndLayersFromURI(ctx context.Context, sysCtx *types.SystemContext, uri string) (types.ImageCloser, []storage.Layer, error) {
+	uri, err := withPathTransport(uri)
+	if err != nil {
+		return nil, nil, err
+	}
 	ref, err := alltransports.ParseImageName(uri)
 
 	// transport name missing or its using the containers-storage
 	// => lookup in storage first:
 	if err != nil || ref.Transport().Name() == storageTransport.Transport.Name() {
-		opts, err := storage.DefaultStoreOptions()
-		if err != nil {
-			return nil, nil, err
-		}
-		store, err := storage.GetStore(opts)
+		runtime, store, err := localRuntime()
 		if err != nil {
 			return nil, nil, err
 		}
 
-		runtime, err := libimage.RuntimeFromStore(store, nil)
-		if err != nil {
-			return nil, nil, err
+		// select the instance of the requested platform from manifest lists
+		lookupOpts := &libimage.LookupImageOptions{}
+		if sysCtx != nil {
+			lookupOpts.OS = sysCtx.OSChoice
+			lookupOpts.Architecture = sysCtx.ArchitectureChoice
+			lookupOpts.Variant = sysCtx.VariantChoice
 		}
-
-		img, _, err := runtime.LookupImage(uri, nil)
+		img, _, err := runtime.LookupImage(uri, lookupOpts)
 		if err == nil {
 			ref, err := img.StorageReference()
 			if err != nil {
@@ -85,7 +121,6 @@ func ImageAndLayersFromURI(ctx context.Context, sysCtx *types.SystemContext, uri
 			if err != nil {
 				return nil, nil, err
 			}
-			defer imgCloser.Close()
 
 			layers, err := layersFromImageDigest(store, img.Digest())
 			if err == nil {
@@ -110,11 +145,26 @@ func ImageAndLayersFromURI(ctx context.Context, sysCtx *types.SystemContext, uri
 	if err != nil {
 		return nil, nil, err
 	}
-	defer img.Close()
 
 	return img, nil, nil
 }
 
+// withPathTransport prepends the transport to uri if it is the path of an
+// image on disk and does not contain a transport already.
+func withPathTransport(uri string) (string, error) {
+	if _, err := alltransports.ParseImageName(uri); err == nil {
+		return uri, nil
+	}
+	transport, err := transportForPath(uri)
+	if err != nil {
+		return "", err
+	}
+	if transport != "" {
+		return transport + ":" + uri, nil
+	}
+	return uri, nil
+}
+
 // BlobInfoFromImage extracts layer blob information that can be later used with
 // `GetBlob` from a container image, handling different transport types
 // appropriately.
@@ -175,3 +225,40 @@ func HumanReadableSize(b int64) string {
 	return fmt.Sprintf("%.1f %cB",
 		float64(b)/float64(div), "kMGTPE"[exp])
 }
+
+// ParseHumanReadableSize is the inverse of HumanReadableSize and converts a
+// size like "10MB", "1.5 kB" or "512" into a byte count.
+//
+// Units are case insensitive and use a base of 1000, unless the binary units
+// (KiB, MiB, ...) are used, which use a base of 1024. The trailing "B" is
+// optional.
+func ParseHumanReadableSize(s string) (int64, error) {
+	str := strings.TrimSpace(s)
+	num := strings.TrimRightFunc(str, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	unit := strings.ToUpper(strings.TrimSpace(str[len(num):]))
+
+	value, err := strconv.ParseFloat(num, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	unit = strings.TrimSuffix(unit, "B")
+	base := 1000.0
+	if prefix, ok := strings.CutSuffix(unit, "I"); ok && prefix != "" {
+		unit = prefix
+		base = 1024
+	}
+
+	if unit != "" {
+		exp := strings.Index("KMGTPE", unit)
+		if len(unit) != 1 || exp < 0 {
+			return 0, fmt.Errorf("invalid size %q: unknown unit", s)
+		}
+		for range exp + 1 {
+			value *= base
+		}
+	}
+	return int64(value), nil
+}
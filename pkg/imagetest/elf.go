@@ -0,0 +1,75 @@
+package imagetest
+
+import (
+	"debug/elf"
+	"encoding/binary"
+)
+
+// ELFSection is a section of the files created by ELF, its content consists
+// of Size zero bytes
+type ELFSection struct {
+	Name string
+	Type elf.SectionType
+	Size int
+}
+
+// ELF returns a 64 bit little endian ELF executable without program headers
+// that contains the given sections and a section name table
+func ELF(sections ...ELFSection) []byte {
+	const headerSize, sectionHeaderSize = 64, 64
+
+	names := []byte{0}
+	nameOffsets := make([]int, len(sections)+1)
+	for i, s := range append(sections, ELFSection{Name: ".shstrtab"}) {
+		nameOffsets[i] = len(names)
+		names = append(append(names, s.Name...), 0)
+	}
+	sections = append(sections, ELFSection{Name: ".shstrtab", Type: elf.SHT_STRTAB, Size: len(names)})
+
+	le := binary.LittleEndian
+	data := make([]byte, headerSize)
+	offsets := make([]int, len(sections))
+	for i, s := range sections {
+		offsets[i] = len(data)
+		if s.Name == ".shstrtab" {
+			data = append(data, names...)
+		} else {
+			data = append(data, make([]byte, s.Size)...)
+		}
+	}
+	for len(data)%8 != 0 {
+		data = append(data, 0)
+	}
+	sectionHeaders := len(data)
+
+	// the first section header is the null section
+	data = append(data, make([]byte, sectionHeaderSize)...)
+	for i, s := range sections {
+		sh := make([]byte, sectionHeaderSize)
+		le.PutUint32(sh[0:], uint32(nameOffsets[i]))
+		le.PutUint32(sh[4:], uint32(s.Type))
+		le.PutUint64(sh[24:], uint64(offsets[i]))
+		le.PutUint64(sh[32:], uint64(s.Size))
+		le.PutUint64(sh[48:], 1)
+		if s.Type == elf.SHT_SYMTAB {
+			le.PutUint64(sh[56:], 24)
+		}
+		data = append(data, sh...)
+	}
+
+	h := data[:headerSize]
+	copy(h, elf.ELFMAG)
+	h[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	h[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	h[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	le.PutUint16(h[16:], uint16(elf.ET_EXEC))
+	le.PutUint16(h[18:], uint16(elf.EM_X86_64))
+	le.PutUint32(h[20:], uint32(elf.EV_CURRENT))
+	le.PutUint64(h[40:], uint64(sectionHeaders))
+	le.PutUint16(h[52:], headerSize)
+	le.PutUint16(h[54:], 56)
+	le.PutUint16(h[58:], sectionHeaderSize)
+	le.PutUint16(h[60:], uint16(len(sections)+1))
+	le.PutUint16(h[62:], uint16(len(sections)))
+	return data
+}
@@ -0,0 +1,240 @@
+// Package imagetest builds small container images for tests, so that they do
+// not need to pull images from a registry.
+package imagetest
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	imgspec "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"go.podman.io/image/v5/copy"
+	"go.podman.io/image/v5/signature"
+	"go.podman.io/image/v5/transports/alltransports"
+)
+
+// Created is the creation time of all images, layers and files
+var Created = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// File is an entry of a layer archive. Regular files are created if Typeflag
+// is not set.
+type File struct {
+	Path     string
+	Content  string
+	Typeflag byte
+	Linkname string
+	Mode     int64
+}
+
+// Layer is a layer of an image
+type Layer struct {
+	Files     []File
+	CreatedBy string
+	// Uncompressed stores the layer without compressing it
+	Uncompressed bool
+}
+
+// Tar returns the uncompressed layer archive. The archive only depends on
+// the files of the layer, so that its digest is the diffID of the layer.
+func (l Layer) Tar(t testing.TB) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range l.Files {
+		hdr := &tar.Header{
+			Name:     f.Path,
+			Typeflag: f.Typeflag,
+			Linkname: f.Linkname,
+			Mode:     f.Mode,
+			ModTime:  Created,
+			Format:   tar.FormatPAX,
+		}
+		if hdr.Typeflag == 0 {
+			hdr.Typeflag = tar.TypeReg
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Size = int64(len(f.Content))
+		}
+		if hdr.Mode == 0 {
+			hdr.Mode = 0o644
+			if hdr.Typeflag == tar.TypeDir {
+				hdr.Mode = 0o755
+			}
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("failed to write the tar header of %s: %v", f.Path, err)
+		}
+		if _, err := tw.Write([]byte(f.Content)); err != nil {
+			t.Fatalf("failed to write %s: %v", f.Path, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("failed to close the layer archive: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// DiffID returns the digest of the uncompressed layer archive
+func (l Layer) DiffID(t testing.TB) digest.Digest {
+	t.Helper()
+	return digest.FromBytes(l.Tar(t))
+}
+
+// Image is a single platform image
+type Image struct {
+	Layers []Layer
+	// EmptyLayers are build steps without a layer (e.g. ENV) that are
+	// appended to the history after the layers
+	EmptyLayers []string
+	// OS and Architecture default to linux/amd64
+	OS           string
+	Architecture string
+}
+
+// WriteOCILayout writes img as an OCI layout into a new temporary directory
+// and returns its reference for the oci: transport.
+func WriteOCILayout(t testing.TB, img Image) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "blobs", "sha256"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	writeBlob := func(mediaType string, data []byte) imgspecv1.Descriptor {
+		d := digest.FromBytes(data)
+		if err := os.WriteFile(filepath.Join(dir, "blobs", "sha256", d.Encoded()), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return imgspecv1.Descriptor{MediaType: mediaType, Digest: d, Size: int64(len(data))}
+	}
+	writeJSON := func(mediaType string, v any) imgspecv1.Descriptor {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return writeBlob(mediaType, data)
+	}
+
+	config := imgspecv1.Image{
+		Created:  &Created,
+		Platform: imgspecv1.Platform{OS: img.OS, Architecture: img.Architecture},
+		RootFS:   imgspecv1.RootFS{Type: "layers"},
+	}
+	if config.OS == "" {
+		config.OS = "linux"
+	}
+	if config.Architecture == "" {
+		config.Architecture = "amd64"
+	}
+
+	manifest := imgspecv1.Manifest{
+		Versioned: imgspec.Versioned{SchemaVersion: 2},
+		MediaType: imgspecv1.MediaTypeImageManifest,
+	}
+	for _, l := range img.Layers {
+		archive := l.Tar(t)
+		config.RootFS.DiffIDs = append(config.RootFS.DiffIDs, digest.FromBytes(archive))
+		config.History = append(config.History, imgspecv1.History{Created: &Created, CreatedBy: l.CreatedBy})
+
+		if l.Uncompressed {
+			manifest.Layers = append(manifest.Layers, writeBlob(imgspecv1.MediaTypeImageLayer, archive))
+			continue
+		}
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write(archive); err != nil {
+			t.Fatal(err)
+		}
+		if err := gz.Close(); err != nil {
+			t.Fatal(err)
+		}
+		manifest.Layers = append(manifest.Layers, writeBlob(imgspecv1.MediaTypeImageLayerGzip, buf.Bytes()))
+	}
+	for _, createdBy := range img.EmptyLayers {
+		config.History = append(config.History, imgspecv1.History{Created: &Created, CreatedBy: createdBy, EmptyLayer: true})
+	}
+
+	manifest.Config = writeJSON(imgspecv1.MediaTypeImageConfig, config)
+	desc := writeJSON(imgspecv1.MediaTypeImageManifest, manifest)
+	desc.Annotations = map[string]string{imgspecv1.AnnotationRefName: "latest"}
+
+	index := imgspecv1.Index{
+		Versioned: imgspec.Versioned{SchemaVersion: 2},
+		MediaType: imgspecv1.MediaTypeImageIndex,
+		Manifests: []imgspecv1.Descriptor{desc},
+	}
+	for name, v := range map[string]any{
+		imgspecv1.ImageIndexFile:  index,
+		imgspecv1.ImageLayoutFile: imgspecv1.ImageLayout{Version: imgspecv1.ImageLayoutVersion},
+	} {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return "oci:" + dir + ":latest"
+}
+
+// Copy copies the image from the src to the dest reference, e.g. to convert
+// an OCI layout into a docker-archive.
+func Copy(t testing.TB, src, dest string) {
+	t.Helper()
+
+	srcRef, err := alltransports.ParseImageName(src)
+	if err != nil {
+		t.Fatalf("invalid source %s: %v", src, err)
+	}
+	destRef, err := alltransports.ParseImageName(dest)
+	if err != nil {
+		t.Fatalf("invalid destination %s: %v", dest, err)
+	}
+
+	policy, err := signature.NewPolicyContext(&signature.Policy{
+		Default: signature.PolicyRequirements{signature.NewPRInsecureAcceptAnything()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer policy.Destroy()
+
+	if _, err := copy.Image(context.Background(), policy, destRef, srcRef, nil); err != nil {
+		t.Fatalf("failed to copy %s to %s: %v", src, dest, err)
+	}
+}
+
+// WriteAllTransports writes img with every local transport that skiff
+// supports and returns the references by the transport name (oci,
+// oci-archive, docker-archive and dir).
+func WriteAllTransports(t testing.TB, img Image) map[string]string {
+	t.Helper()
+
+	oci := WriteOCILayout(t, img)
+	dir := t.TempDir()
+	uris := map[string]string{
+		"oci":            oci,
+		"oci-archive":    "oci-archive:" + filepath.Join(dir, "oci.tar"),
+		"docker-archive": "docker-archive:" + filepath.Join(dir, "docker.tar"),
+		"dir":            "dir:" + filepath.Join(dir, "dir"),
+	}
+	for name, uri := range uris {
+		if name != "oci" {
+			Copy(t, oci, uri)
+		}
+	}
+	return uris
+}
@@ -0,0 +1,186 @@
+package imagetest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"path"
+	"slices"
+)
+
+// RPM is an installed rpm package that is stored in the test databases
+type RPM struct {
+	Name, Version, Release, Arch string
+	Epoch                        int32
+	// Size is the installed size, sizes that do not fit into 32 bits are
+	// stored in the LONGSIZE tag
+	Size  int64
+	Files []string
+}
+
+// rpm header tags and types used by RPM.Header
+const (
+	rpmTagName       = 1000
+	rpmTagVersion    = 1001
+	rpmTagRelease    = 1002
+	rpmTagEpoch      = 1003
+	rpmTagSize       = 1009
+	rpmTagArch       = 1022
+	rpmTagDirIndexes = 1116
+	rpmTagBasenames  = 1117
+	rpmTagDirnames   = 1118
+	rpmTagLongSize   = 5009
+
+	rpmTypeInt32       = 4
+	rpmTypeInt64       = 5
+	rpmTypeString      = 6
+	rpmTypeStringArray = 8
+)
+
+// Header returns the rpm header blob of the package as it is stored in the
+// rpm database
+func (p RPM) Header() []byte {
+	type tag struct {
+		tag, typ, count uint32
+		data            []byte
+	}
+	str := func(values ...string) []byte {
+		var b []byte
+		for _, v := range values {
+			b = append(append(b, v...), 0)
+		}
+		return b
+	}
+
+	var dirs, bases []string
+	var dirIndexes []byte
+	for _, f := range p.Files {
+		dir, base := path.Dir(f)+"/", path.Base(f)
+		i := slices.Index(dirs, dir)
+		if i < 0 {
+			i = len(dirs)
+			dirs = append(dirs, dir)
+		}
+		bases = append(bases, base)
+		dirIndexes = binary.BigEndian.AppendUint32(dirIndexes, uint32(i))
+	}
+
+	tags := []tag{
+		{rpmTagName, rpmTypeString, 1, str(p.Name)},
+		{rpmTagVersion, rpmTypeString, 1, str(p.Version)},
+		{rpmTagRelease, rpmTypeString, 1, str(p.Release)},
+		{rpmTagArch, rpmTypeString, 1, str(p.Arch)},
+	}
+	if p.Epoch != 0 {
+		tags = append(tags, tag{rpmTagEpoch, rpmTypeInt32, 1, binary.BigEndian.AppendUint32(nil, uint32(p.Epoch))})
+	}
+	if p.Size > 1<<31-1 {
+		tags = append(tags, tag{rpmTagLongSize, rpmTypeInt64, 1, binary.BigEndian.AppendUint64(nil, uint64(p.Size))})
+	} else {
+		tags = append(tags, tag{rpmTagSize, rpmTypeInt32, 1, binary.BigEndian.AppendUint32(nil, uint32(p.Size))})
+	}
+	if len(p.Files) > 0 {
+		tags = append(tags,
+			tag{rpmTagDirIndexes, rpmTypeInt32, uint32(len(p.Files)), dirIndexes},
+			tag{rpmTagBasenames, rpmTypeStringArray, uint32(len(bases)), str(bases...)},
+			tag{rpmTagDirnames, rpmTypeStringArray, uint32(len(dirs)), str(dirs...)},
+		)
+	}
+
+	var index, data []byte
+	for _, t := range tags {
+		// integers are aligned to their size
+		for t.typ == rpmTypeInt32 && len(data)%4 != 0 || t.typ == rpmTypeInt64 && len(data)%8 != 0 {
+			data = append(data, 0)
+		}
+		index = binary.BigEndian.AppendUint32(index, t.tag)
+		index = binary.BigEndian.AppendUint32(index, t.typ)
+		index = binary.BigEndian.AppendUint32(index, uint32(len(data)))
+		index = binary.BigEndian.AppendUint32(index, t.count)
+		data = append(data, t.data...)
+	}
+
+	blob := binary.BigEndian.AppendUint32(nil, uint32(len(tags)))
+	blob = binary.BigEndian.AppendUint32(blob, uint32(len(data)))
+	return append(append(blob, index...), data...)
+}
+
+// NDBDatabase returns an rpm database in the ndb format (Packages.db) with
+// the packages
+func NDBDatabase(packages ...RPM) []byte {
+	const pageSize, headerSize, slotSize, blockSize = 4096, 32, 16, 16
+
+	le := binary.LittleEndian
+	db := make([]byte, pageSize)
+	copy(db, "RpmP")
+	le.PutUint32(db[12:], 1)
+	le.PutUint32(db[16:], uint32(len(packages)+1))
+	for i := headerSize; i < pageSize; i += slotSize {
+		copy(db[i:], "Slot")
+	}
+
+	for i, p := range packages {
+		slot := db[headerSize+i*slotSize:]
+		le.PutUint32(slot[4:], uint32(i+1))
+		le.PutUint32(slot[8:], uint32(len(db)/blockSize))
+
+		blob := p.Header()
+		blobHead := []byte("BlbS")
+		blobHead = le.AppendUint32(blobHead, uint32(i+1))
+		blobHead = le.AppendUint32(blobHead, 0)
+		blobHead = le.AppendUint32(blobHead, uint32(len(blob)))
+		db = append(append(db, blobHead...), blob...)
+		for len(db)%blockSize != 0 {
+			db = append(db, 0)
+		}
+	}
+	return db
+}
+
+// BDBDatabase returns an rpm database in the Berkeley DB hash format
+// (Packages) with the given byte order and page size. Like in rpm, the
+// headers of the packages are stored in overflow pages.
+func BDBDatabase(order binary.ByteOrder, pageSize int, packages ...RPM) []byte {
+	const headerSize, offPageSize = 26, 12
+	page := func(typ byte) []byte {
+		p := make([]byte, pageSize)
+		p[25] = typ
+		return p
+	}
+
+	meta := page(8)
+	order.PutUint32(meta[12:], 0x00061561)
+	order.PutUint32(meta[20:], uint32(pageSize))
+	hash := page(13)
+	pages := [][]byte{meta, hash}
+
+	order.PutUint16(hash[20:], uint16(2*len(packages)))
+	itemOffset := pageSize
+	for i, p := range packages {
+		// the key is the index of the package
+		itemOffset -= 5
+		hash[itemOffset] = 1
+		order.PutUint32(hash[itemOffset+1:], uint32(i+1))
+		order.PutUint16(hash[headerSize+4*i:], uint16(itemOffset))
+
+		blob := p.Header()
+		first := len(pages)
+		itemOffset -= offPageSize
+		hash[itemOffset] = 3
+		order.PutUint32(hash[itemOffset+4:], uint32(first))
+		order.PutUint32(hash[itemOffset+8:], uint32(len(blob)))
+		order.PutUint16(hash[headerSize+4*i+2:], uint16(itemOffset))
+
+		for chunk := range slices.Chunk(blob, pageSize-headerSize) {
+			overflow := page(7)
+			order.PutUint16(overflow[22:], uint16(len(chunk)))
+			copy(overflow[headerSize:], chunk)
+			pages = append(pages, overflow)
+		}
+		// link the overflow pages of the package
+		for n := first; n < len(pages)-1; n++ {
+			order.PutUint32(pages[n][16:], uint32(n+1))
+		}
+	}
+	order.PutUint32(meta[32:], uint32(len(pages)-1))
+	return bytes.Join(pages, nil)
+}
@@ -0,0 +1,126 @@
+package imagetest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"go.podman.io/storage"
+)
+
+// UseTemporaryStorage points the local container storage of the process to a
+// new temporary directory that uses the vfs driver. As the storage only reads
+// its configuration once, it has to be called from TestMain before the storage
+// is opened. The returned function removes the directory.
+func UseTemporaryStorage() (func(), error) {
+	dir, err := os.MkdirTemp("", "skiff-storage-")
+	if err != nil {
+		return nil, err
+	}
+	conf := filepath.Join(dir, "storage.conf")
+	content := fmt.Sprintf("[storage]\ndriver = \"vfs\"\ngraphroot = %q\nrunroot = %q\n", filepath.Join(dir, "graph"), filepath.Join(dir, "run"))
+	if err := os.WriteFile(conf, []byte(content), 0o644); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	if err := os.Setenv("CONTAINERS_STORAGE_CONF", conf); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return func() { os.RemoveAll(dir) }, nil
+}
+
+// WriteContainerStorage copies img into the local container storage, which
+// has to be set up with UseTemporaryStorage, and returns its reference for the
+// containers-storage: transport. Layers are only extracted with their owners
+// by root, so the test is skipped for other users.
+func WriteContainerStorage(t testing.TB, img Image, name string) string {
+	t.Helper()
+
+	if os.Geteuid() != 0 {
+		t.Skip("writing to the container storage requires root")
+	}
+	uri := "containers-storage:" + name
+	Copy(t, WriteOCILayout(t, img), uri)
+	return uri
+}
+
+// CommitContainerStorage stores img in the local container storage like a
+// build tool that commits its layers to the storage, and returns its reference
+// for the containers-storage: transport. Unlike with WriteContainerStorage,
+// the layers have never been compressed, so the storage does not know their
+// compressed size.
+func CommitContainerStorage(t testing.TB, img Image, name string) string {
+	t.Helper()
+
+	if os.Geteuid() != 0 {
+		t.Skip("writing to the container storage requires root")
+	}
+
+	uncompressed := img
+	uncompressed.Layers = make([]Layer, len(img.Layers))
+	for i, l := range img.Layers {
+		l.Uncompressed = true
+		uncompressed.Layers[i] = l
+	}
+	dir := strings.TrimSuffix(strings.TrimPrefix(WriteOCILayout(t, uncompressed), "oci:"), ":latest")
+	readBlob := func(d digest.Digest) []byte {
+		data, err := os.ReadFile(filepath.Join(dir, "blobs", d.Algorithm().String(), d.Encoded()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	readJSON := func(data []byte, v any) {
+		if err := json.Unmarshal(data, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	indexData, err := os.ReadFile(filepath.Join(dir, imgspecv1.ImageIndexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index imgspecv1.Index
+	readJSON(indexData, &index)
+	manifestDigest := index.Manifests[0].Digest
+	manifestData := readBlob(manifestDigest)
+	var manifest imgspecv1.Manifest
+	readJSON(manifestData, &manifest)
+
+	opts, err := storage.DefaultStoreOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := storage.GetStore(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parent := ""
+	for _, l := range manifest.Layers {
+		layer, _, err := store.PutLayer("", parent, nil, "", false, nil, bytes.NewReader(readBlob(l.Digest)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		parent = layer.ID
+	}
+	config := manifest.Config.Digest
+	_, err = store.CreateImage(config.Encoded(), []string{name}, parent, "", &storage.ImageOptions{
+		Digest: manifestDigest,
+		BigData: []storage.ImageBigDataOption{
+			{Key: storage.ImageDigestBigDataKey, Data: manifestData, Digest: manifestDigest},
+			{Key: config.String(), Data: readBlob(config), Digest: config},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "containers-storage:" + name
+}
@@ -0,0 +1,231 @@
+package skiff
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"go.podman.io/image/v5/types"
+)
+
+// LayerIndex contains the entries of a layer archive without their content,
+// so that a layer only has to be read once.
+type LayerIndex struct {
+	// DiffID is the digest of the layer archive
+	DiffID digest.Digest
+	// Digests is true if the Digest of all regular files has been set
+	Digests bool
+	Entries []FileEntry
+}
+
+// indexVersion is the version of the serialized index format, indexes with a
+// different version are ignored
+const indexVersion = 1
+
+// indexFile is the serialized form of a LayerIndex
+type indexFile struct {
+	Version int
+	Index   LayerIndex
+}
+
+// IndexStore persists layer indexes on disk keyed by the diffID of the layer.
+// As the diffID is the digest of the layer archive, indexes can be shared by
+// all images that contain the layer.
+//
+// Indexes are stored as gzip compressed gob files in
+// index/<algorithm>/<encoded diffID> below the store directory. They count
+// toward the maximum size of a BlobCache in the same directory and are pruned
+// together with its blobs.
+type IndexStore struct {
+	dir string
+	// maxSize is the maximum size of all blobs and indexes, 0 disables the
+	// limit
+	maxSize int64
+}
+
+// NewIndexStore returns a store that keeps its indexes below dir and prunes
+// the least recently used blobs and indexes in dir once they grow beyond
+// maxSize bytes. A maxSize of 0 disables the limit.
+func NewIndexStore(dir string, maxSize int64) *IndexStore {
+	return &IndexStore{dir: dir, maxSize: maxSize}
+}
+
+type indexStoreKey struct{}
+
+// WithIndexStore returns a context that makes LayerEntries and
+// ImageLayers.Merge read and store the indexes of layers in s.
+func WithIndexStore(ctx context.Context, s *IndexStore) context.Context {
+	return context.WithValue(ctx, indexStoreKey{}, s)
+}
+
+func indexStoreFromContext(ctx context.Context) *IndexStore {
+	s, _ := ctx.Value(indexStoreKey{}).(*IndexStore)
+	return s
+}
+
+func (s *IndexStore) indexDir() string {
+	return filepath.Join(s.dir, "index")
+}
+
+func (s *IndexStore) path(diffID digest.Digest) string {
+	return filepath.Join(s.indexDir(), diffID.Algorithm().String(), diffID.Encoded())
+}
+
+// Load returns the index of the layer with the given diffID or nil if the
+// store does not contain a (readable) index of it.
+func (s *IndexStore) Load(diffID digest.Digest) (*LayerIndex, error) {
+	if err := diffID.Validate(); err != nil {
+		return nil, nil
+	}
+
+	f, err := os.Open(s.path(diffID))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// mark the index as recently used for pruning
+	now := time.Now()
+	_ = os.Chtimes(s.path(diffID), now, now)
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		// a corrupted index is rebuilt from the layer
+		return nil, nil
+	}
+	defer gz.Close()
+
+	var file indexFile
+	if err := gob.NewDecoder(gz).Decode(&file); err != nil || file.Version != indexVersion || file.Index.DiffID != diffID {
+		return nil, nil
+	}
+	return &file.Index, nil
+}
+
+// Store persists the index, replacing an existing index of the same layer.
+func (s *IndexStore) Store(index *LayerIndex) error {
+	if err := index.DiffID.Validate(); err != nil {
+		return fmt.Errorf("cannot store the index of a layer with an invalid diffID: %w", err)
+	}
+
+	path := s.path(index.DiffID)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	gz := gzip.NewWriter(tmp)
+	err = gob.NewEncoder(gz).Encode(indexFile{Version: indexVersion, Index: *index})
+	if closeErr := gz.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write the index of layer %s: %w", index.DiffID, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	if s.maxSize > 0 {
+		// failing to prune is not fatal, the cache is just too large
+		_, _, _ = pruneCache(s.dir, s.maxSize)
+	}
+	return nil
+}
+
+// IndexLayer reads the layer archive from imgSrc and returns its index. If
+// digestContent is true, then the content of every regular file is hashed
+// and stored in the Digest field of its entry.
+//
+// The DiffID of the index is only set if the digest of the layer archive
+// matches diffID.
+func IndexLayer(ctx context.Context, imgSrc types.ImageSource, layer types.BlobInfo, diffID digest.Digest, digestContent bool) (*LayerIndex, error) {
+	stream, err := openLayer(ctx, imgSrc, layer)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	digester := digest.Canonical.Digester()
+	if diffID.Validate() == nil {
+		digester = diffID.Algorithm().Digester()
+	}
+	archive := io.TeeReader(stream, digester.Hash())
+
+	index := &LayerIndex{Digests: digestContent}
+	tr := tar.NewReader(archive)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tar header: %w", err)
+		}
+
+		entry := NewFileEntry(hdr)
+		if digestContent && entry.IsRegular() {
+			entry.Digest, err = digest.Canonical.FromReader(tr)
+			if err != nil {
+				return nil, fmt.Errorf("failed to digest %s: %w", entry.Path, err)
+			}
+		}
+		index.Entries = append(index.Entries, entry)
+	}
+
+	// the tar reader stops at the end of archive marker, the padding after
+	// it is still part of the diffID
+	if _, err := io.Copy(io.Discard, archive); err != nil {
+		return nil, fmt.Errorf("failed to read layer %s: %w", layer.Digest, err)
+	}
+	if digester.Digest() == diffID {
+		index.DiffID = diffID
+	}
+	return index, nil
+}
+
+// LayerEntries returns the entries of the layer with the given diffID. If the
+// context has an IndexStore, then the entries are read from the stored index
+// of the layer and the layer is only read if there is no index yet.
+//
+// Like the BlobCache, the IndexStore is optional: indexes that cannot be read
+// are rebuilt from the layer and failing to store an index does not fail
+// reading the layer.
+func LayerEntries(ctx context.Context, imgSrc types.ImageSource, layer types.BlobInfo, diffID digest.Digest, digestContent bool) ([]FileEntry, error) {
+	store := indexStoreFromContext(ctx)
+	if store != nil {
+		index, _ := store.Load(diffID)
+		if index != nil && (index.Digests || !digestContent) {
+			return index.Entries, nil
+		}
+	}
+
+	index, err := IndexLayer(ctx, imgSrc, layer, diffID, digestContent)
+	if err != nil {
+		return nil, err
+	}
+	// only indexes of verified layers can be shared with other images
+	if store != nil && index.DiffID != "" {
+		_ = store.Store(index)
+	}
+	return index.Entries, nil
+}
@@ -0,0 +1,198 @@
+package skiff
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"go.podman.io/image/v5/types"
+)
+
+// indexTestLayer returns a gzip compressed layer, its digest and its diffID
+func indexTestLayer(t *testing.T) ([]byte, digest.Digest, digest.Digest) {
+	t.Helper()
+
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	content := []byte("#!/bin/sh\n")
+	headers := []*tar.Header{
+		{Name: "usr/", Typeflag: tar.TypeDir, Mode: 0o755},
+		{
+			Name:       "usr/bin/ping",
+			Typeflag:   tar.TypeReg,
+			Mode:       0o755,
+			Size:       int64(len(content)),
+			Format:     tar.FormatPAX,
+			PAXRecords: map[string]string{"SCHILY.xattr.security.capability": "cap_net_raw"},
+		},
+		{Name: "usr/bin/sh", Typeflag: tar.TypeSymlink, Linkname: "ping"},
+	}
+	for _, hdr := range headers {
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			if _, err := tw.Write(content); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var blob bytes.Buffer
+	gz := gzip.NewWriter(&blob)
+	if _, err := gz.Write(archive.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return blob.Bytes(), digest.FromBytes(blob.Bytes()), digest.FromBytes(archive.Bytes())
+}
+
+func TestLayerEntriesIndex(t *testing.T) {
+	blob, d, diffID := indexTestLayer(t)
+	src := &countingSource{blobs: map[digest.Digest][]byte{d: blob}}
+	dir := t.TempDir()
+	store := NewIndexStore(dir, 0)
+	ctx := WithIndexStore(context.Background(), store)
+	layer := types.BlobInfo{Digest: d}
+
+	for range 2 {
+		entries, err := LayerEntries(ctx, src, layer, diffID, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 3 {
+			t.Fatalf("Expected 3 entries, got %d", len(entries))
+		}
+		if xattr := entries[1].Xattrs["security.capability"]; xattr != "cap_net_raw" {
+			t.Errorf("Expected the xattr of %s to be indexed, got %q", entries[1].Path, xattr)
+		}
+		if entries[2].Linkname != "ping" {
+			t.Errorf("Expected the link target to be indexed, got %q", entries[2].Linkname)
+		}
+		if entries[1].Digest != "" {
+			t.Errorf("Expected no content digest, got %s", entries[1].Digest)
+		}
+	}
+	if src.gets != 1 {
+		t.Errorf("Expected the layer to be read once, got %d reads", src.gets)
+	}
+
+	// an index without content digests has to be rebuilt once
+	for range 2 {
+		entries, err := LayerEntries(ctx, src, layer, diffID, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := digest.FromString("#!/bin/sh\n"); entries[1].Digest != expected {
+			t.Errorf("Expected the content digest %s, got %s", expected, entries[1].Digest)
+		}
+	}
+	if _, err := LayerEntries(ctx, src, layer, diffID, false); err != nil {
+		t.Fatal(err)
+	}
+	if src.gets != 2 {
+		t.Errorf("Expected the layer to be read twice, got %d reads", src.gets)
+	}
+
+	removed, _, err := NewBlobCache(dir, 0).Prune(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Errorf("Expected one index to be removed, got %d", removed)
+	}
+	if index, err := store.Load(diffID); err != nil || index != nil {
+		t.Errorf("Expected no index after pruning the cache, got %v (%v)", index, err)
+	}
+}
+
+func TestLayerEntriesDiffIDMismatch(t *testing.T) {
+	blob, d, _ := indexTestLayer(t)
+	src := &countingSource{blobs: map[digest.Digest][]byte{d: blob}}
+	store := NewIndexStore(t.TempDir(), 0)
+	ctx := WithIndexStore(context.Background(), store)
+	diffID := digest.FromString("another layer")
+
+	for range 2 {
+		if _, err := LayerEntries(ctx, src, types.BlobInfo{Digest: d}, diffID, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if src.gets != 2 {
+		t.Errorf("Expected layers that do not match their diffID not to be indexed, got %d reads", src.gets)
+	}
+	if index, _ := store.Load(diffID); index != nil {
+		t.Errorf("Expected no index to be stored, got %v", index)
+	}
+}
+
+func TestLayerEntriesStoreFailure(t *testing.T) {
+	blob, d, diffID := indexTestLayer(t)
+	src := &countingSource{blobs: map[digest.Digest][]byte{d: blob}}
+
+	// a store below a regular file can neither load nor store indexes
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ctx := WithIndexStore(context.Background(), NewIndexStore(file, 0))
+
+	entries, err := LayerEntries(ctx, src, types.BlobInfo{Digest: d}, diffID, false)
+	if err != nil {
+		t.Fatalf("Expected the entries to be read without the index store, got %v", err)
+	}
+	if len(entries) != 3 {
+		t.Errorf("Expected 3 entries, got %d", len(entries))
+	}
+}
+
+func TestIndexStoreMaxSize(t *testing.T) {
+	blob, d, diffID := indexTestLayer(t)
+	dir := t.TempDir()
+	c := NewBlobCache(dir, 0)
+	src := &countingSource{blobs: map[digest.Digest][]byte{d: blob}}
+	readBlob(t, c, src, d)
+
+	// make the blob the least recently used file of the cache
+	mtime := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(c.path(d), mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	index, err := IndexLayer(context.Background(), src, types.BlobInfo{Digest: d}, diffID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewIndexStore(dir, 0).Store(index); err != nil {
+		t.Fatal(err)
+	}
+	files, size, err := c.Size()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files != 2 || size <= int64(len(blob)) {
+		t.Errorf("Expected the blob and the index to count toward the size of the cache, got %d files with %d bytes", files, size)
+	}
+
+	// storing the index again exceeds the limit and prunes the blob
+	if err := NewIndexStore(dir, size-int64(len(blob))).Store(index); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(c.path(d)); err == nil {
+		t.Errorf("Expected the least recently used blob to be pruned")
+	}
+	if loaded, err := NewIndexStore(dir, 0).Load(diffID); err != nil || loaded == nil {
+		t.Errorf("Expected the index to be kept, got %v (%v)", loaded, err)
+	}
+}
@@ -0,0 +1,409 @@
+package skiff
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	"go.podman.io/image/v5/pkg/blobinfocache/none"
+	"go.podman.io/image/v5/pkg/compression"
+	"go.podman.io/image/v5/types"
+	"go.podman.io/storage"
+	"golang.org/x/sync/errgroup"
+)
+
+// FileEntry describes a single entry of a layer archive.
+type FileEntry struct {
+	// Path is the absolute and cleaned path of the entry
+	Path     string
+	Typeflag byte
+	Size     int64
+	Mode     int64
+	UID      int
+	GID      int
+	// Linkname is the target of symbolic and hard links
+	Linkname string
+	// Xattrs contains the extended attributes of the entry
+	Xattrs map[string]string
+	// Digest is the digest of the content of regular files. It is only set
+	// if the digest has been explicitly requested, as it requires reading
+	// the whole file.
+	Digest digest.Digest
+}
+
+// xattrPAXPrefix is the prefix of PAX records that store extended attributes
+const xattrPAXPrefix = "SCHILY.xattr."
+
+// NewFileEntry converts a tar header into a FileEntry.
+func NewFileEntry(hdr *tar.Header) FileEntry {
+	entry := FileEntry{
+		Path:     filepath.Join("/", hdr.Name),
+		Typeflag: hdr.Typeflag,
+		Size:     hdr.Size,
+		Mode:     hdr.Mode,
+		UID:      hdr.Uid,
+		GID:      hdr.Gid,
+		Linkname: hdr.Linkname,
+	}
+	for key, value := range hdr.PAXRecords {
+		if name, ok := strings.CutPrefix(key, xattrPAXPrefix); ok {
+			if entry.Xattrs == nil {
+				entry.Xattrs = map[string]string{}
+			}
+			entry.Xattrs[name] = value
+		}
+	}
+	return entry
+}
+
+// IsDir returns true if the entry is a directory.
+func (e FileEntry) IsDir() bool {
+	return e.Typeflag == tar.TypeDir
+}
+
+// IsRegular returns true if the entry is a regular file.
+func (e FileEntry) IsRegular() bool {
+	return e.Typeflag == tar.TypeReg
+}
+
+// getBlob fetches the blob of the layer from imgSrc. Blobs of images from
+// registries are read through the blob cache of ctx if it has one. The
+// progress of reading the blob is reported to the ProgressReporter of ctx.
+func getBlob(ctx context.Context, imgSrc types.ImageSource, layer types.BlobInfo) (io.ReadCloser, error) {
+	var blob io.ReadCloser
+	var err error
+	if c := blobCacheFromContext(ctx); c != nil && !IsLocalTransport(imgSrc.Reference()) {
+		blob, err = c.getBlob(ctx, imgSrc, layer)
+	} else {
+		blob, _, err = imgSrc.GetBlob(ctx, layer, none.NoCache)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if r := progressReporterFromContext(ctx); r != nil {
+		return r.TrackBlob(layer, blob), nil
+	}
+	return blob, nil
+}
+
+// openLayer fetches the blob of the layer from imgSrc and returns the
+// decompressed layer archive.
+func openLayer(ctx context.Context, imgSrc types.ImageSource, layer types.BlobInfo) (io.ReadCloser, error) {
+	blob, err := getBlob(ctx, imgSrc, layer)
+	if err != nil {
+		return nil, err
+	}
+
+	uncompressedStream, _, err := compression.AutoDecompress(blob)
+	if err != nil {
+		blob.Close()
+		return nil, fmt.Errorf("auto-decompressing input: %w", err)
+	}
+	return &layerStream{ReadCloser: uncompressedStream, blob: blob}, nil
+}
+
+// layerStream is a decompressed layer archive that closes the underlying blob
+// together with the decompressor
+type layerStream struct {
+	io.ReadCloser
+	blob io.Closer
+}
+
+func (s *layerStream) Close() error {
+	err := s.ReadCloser.Close()
+	if blobErr := s.blob.Close(); err == nil {
+		err = blobErr
+	}
+	return err
+}
+
+// WalkLayer fetches the blob of the layer from imgSrc, decompresses it and
+// invokes fn for every entry in the layer archive.
+//
+// The content reader passed to fn is only valid until fn returns.
+func WalkLayer(ctx context.Context, imgSrc types.ImageSource, layer types.BlobInfo, fn func(entry FileEntry, content io.Reader) error) error {
+	stream, err := openLayer(ctx, imgSrc, layer)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	tr := tar.NewReader(stream)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar header: %w", err)
+		}
+
+		if err := fn(NewFileEntry(hdr), tr); err != nil {
+			return err
+		}
+	}
+}
+
+// UncompressedLayerSize fetches the blob of the layer from imgSrc and returns
+// the size of the decompressed layer archive.
+//
+// The whole blob is streamed through the decompressor, without storing it.
+func UncompressedLayerSize(ctx context.Context, imgSrc types.ImageSource, layer types.BlobInfo) (int64, error) {
+	stream, err := openLayer(ctx, imgSrc, layer)
+	if err != nil {
+		return -1, err
+	}
+	defer stream.Close()
+
+	size, err := io.Copy(io.Discard, stream)
+	if err != nil {
+		return -1, fmt.Errorf("failed to decompress layer %s: %w", layer.Digest, err)
+	}
+	return size, nil
+}
+
+// ImageLayers bundles an image with everything that is required to read the
+// archives of its layers.
+type ImageLayers struct {
+	Image  types.ImageCloser
+	Source types.ImageSource
+	// Blobs contains the transport specific blob infos of the layers that
+	// can be passed to `GetBlob`, starting with the bottom layer
+	Blobs []types.BlobInfo
+	// DiffIDs contains the diffIDs of the layers in the same order as Blobs
+	DiffIDs []digest.Digest
+
+	// store and storageLayers are set for images in the local container
+	// storage, whose layers can be read without rebuilding their archives
+	store         storage.Store
+	storageLayers []storage.Layer
+}
+
+// OpenImageLayers resolves uri via ImageAndLayersFromURI and prepares the
+// image for reading its layer archives.
+//
+// The caller has to call Close() once the layers are no longer needed.
+func OpenImageLayers(ctx context.Context, sysCtx *types.SystemContext, uri string) (*ImageLayers, error) {
+	// represents an image from any transport (docker://, containers-storage://, etc.)
+	img, storageLayers, err := ImageAndLayersFromURI(ctx, sysCtx, uri)
+	if err != nil {
+		return nil, err
+	}
+
+	layers, err := openImageLayers(ctx, sysCtx, img)
+	if err != nil {
+		img.Close()
+		return nil, err
+	}
+
+	if len(storageLayers) > 0 && slices.EqualFunc(storageLayers, layers.DiffIDs, func(l storage.Layer, diffID digest.Digest) bool {
+		return l.UncompressedDigest == diffID
+	}) {
+		if store, err := localStore(); err == nil {
+			layers.store = store
+			layers.storageLayers = storageLayers
+		}
+	}
+	return layers, nil
+}
+
+func openImageLayers(ctx context.Context, sysCtx *types.SystemContext, img types.ImageCloser) (*ImageLayers, error) {
+	// Get transport-specific layer blob infos
+	blobs, err := BlobInfoFromImage(ctx, sysCtx, img)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get blob info from image: %w", err)
+	}
+
+	conf, err := img.OCIConfig(ctx)
+	diffIDs := []digest.Digest{}
+
+	// only get them if the rootfs type is correct
+	if err == nil && conf != nil && conf.RootFS.Type == "layers" {
+		diffIDs = conf.RootFS.DiffIDs
+	}
+
+	if len(blobs) != len(diffIDs) {
+		return nil, fmt.Errorf("manifestLayers (%d) and allDiffIDs (%d) length mismatch", len(blobs), len(diffIDs))
+	}
+
+	// image source that helps us fetch layers to eventually show files from the stream
+	imgSrc, err := img.Reference().NewImageSource(ctx, sysCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ImageLayers{Image: img, Source: imgSrc, Blobs: blobs, DiffIDs: diffIDs}, nil
+}
+
+// Close releases the image and its source.
+func (l *ImageLayers) Close() error {
+	err := l.Source.Close()
+	if imgErr := l.Image.Close(); err == nil {
+		err = imgErr
+	}
+	return err
+}
+
+// Merge applies all layers of the image on top of each other and returns the
+// resulting filesystem. The entries of up to jobs layers are read concurrently
+// via StreamEntries.
+//
+// If digestContent is true, then the content of every regular file is hashed
+// and stored in the Digest field of its entry.
+func (l *ImageLayers) Merge(ctx context.Context, jobs int, digestContent bool) (*Filesystem, error) {
+	fs := NewFilesystem()
+	err := l.StreamEntries(ctx, nil, jobs, digestContent, func(i int, entries []FileEntry) error {
+		fs.ApplyLayer(l.DiffIDs[i], entries)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+// ReadEntries returns the entries of the layers with the given indexes (or of
+// all layers if layers is nil) in the same order. Up to jobs layers are
+// fetched and read concurrently, each layer is closed as soon as it has been
+// read. The first error cancels reading the remaining layers.
+func (l *ImageLayers) ReadEntries(ctx context.Context, layers []int, jobs int, digestContent bool) ([][]FileEntry, error) {
+	var entries [][]FileEntry
+	err := l.StreamEntries(ctx, layers, jobs, digestContent, func(_ int, layerEntries []FileEntry) error {
+		entries = append(entries, layerEntries)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// StreamEntries reads the entries of the layers with the given indexes (or of
+// all layers if layers is nil) and passes them to fn in the order of layers,
+// together with the index of the layer. Up to jobs (at least one) layers are
+// fetched and read concurrently, but the next layer is only started once fewer
+// than jobs layers are being read or wait to be passed to fn, so that the
+// entries of at most jobs layers are held in memory besides what fn keeps.
+//
+// The first error of reading a layer or of fn cancels reading the remaining
+// layers.
+func (l *ImageLayers) StreamEntries(ctx context.Context, layers []int, jobs int, digestContent bool, fn func(layer int, entries []FileEntry) error) error {
+	if layers == nil {
+		layers = make([]int, len(l.Blobs))
+		for i := range layers {
+			layers[i] = i
+		}
+	}
+
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	g, ctx := errgroup.WithContext(ctx)
+
+	// a slot is taken before a layer is read and released once its entries
+	// have been passed to fn
+	slots := make(chan struct{}, max(jobs, 1))
+	results := make([]chan []FileEntry, len(layers))
+	for i := range results {
+		results[i] = make(chan []FileEntry, 1)
+	}
+	g.Go(func() error {
+		for i, layer := range layers {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return nil
+			}
+			g.Go(func() error {
+				entries, err := l.Entries(ctx, layer, digestContent)
+				if err != nil {
+					return fmt.Errorf("layer %s: %w", l.DiffIDs[layer], err)
+				}
+				results[i] <- entries
+				return nil
+			})
+		}
+		return nil
+	})
+
+	for i, layer := range layers {
+		var entries []FileEntry
+		select {
+		case entries = <-results[i]:
+		case <-ctx.Done():
+			// the error of the layer that failed or the cancellation
+			// of the parent context
+			if err := g.Wait(); err != nil {
+				return err
+			}
+			return parent.Err()
+		}
+		err := fn(layer, entries)
+		<-slots
+		if err != nil {
+			cancel()
+			_ = g.Wait()
+			return err
+		}
+	}
+	return g.Wait()
+}
+
+// WalkLayers invokes fn for every entry of the layers with the given indexes
+// (or of all layers if layers is nil) via WalkLayer, together with the index
+// of the layer. Up to jobs (at least one) layers are read concurrently, so fn
+// has to be safe for concurrent use by different layers, while the entries of
+// a single layer are passed in the order of its archive.
+//
+// The first error of reading a layer or of fn cancels reading the remaining
+// layers.
+func (l *ImageLayers) WalkLayers(ctx context.Context, layers []int, jobs int, fn func(layer int, entry FileEntry, content io.Reader) error) error {
+	if layers == nil {
+		layers = make([]int, len(l.Blobs))
+		for i := range layers {
+			layers[i] = i
+		}
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(max(jobs, 1))
+	for _, layer := range layers {
+		if ctx.Err() != nil {
+			break
+		}
+		g.Go(func() error {
+			err := WalkLayer(ctx, l.Source, l.Blobs[layer], func(entry FileEntry, content io.Reader) error {
+				return fn(layer, entry, content)
+			})
+			if err != nil {
+				return fmt.Errorf("layer %s: %w", l.DiffIDs[layer], err)
+			}
+			return nil
+		})
+	}
+	return g.Wait()
+}
+
+// Entries returns the entries of the layer with the given index via
+// LayerEntries.
+//
+// The entries of layers in the local container storage are read from the
+// tar-split metadata of the layer instead, unless digestContent is set, as
+// the metadata only contains the headers of the layer archive.
+func (l *ImageLayers) Entries(ctx context.Context, layer int, digestContent bool) ([]FileEntry, error) {
+	if l.storageLayers != nil && !digestContent {
+		entries, err := storageLayerEntries(l.store, l.storageLayers[layer])
+		if !errors.Is(err, fs.ErrNotExist) {
+			return entries, err
+		}
+	}
+	return LayerEntries(ctx, l.Source, l.Blobs[layer], l.DiffIDs[layer], digestContent)
+}
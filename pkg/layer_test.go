@@ -0,0 +1,190 @@
+package skiff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"go.podman.io/image/v5/types"
+
+	"github.com/dcermak/skiff/pkg/imagetest"
+)
+
+func TestReadEntries(t *testing.T) {
+	ctx := context.Background()
+
+	var img imagetest.Image
+	for i := range 6 {
+		img.Layers = append(img.Layers, imagetest.Layer{
+			Files: []imagetest.File{{Path: fmt.Sprintf("layer-%d", i), Content: "content"}},
+		})
+	}
+	layers, err := OpenImageLayers(ctx, nil, imagetest.WriteOCILayout(t, img))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer layers.Close()
+
+	tests := []struct {
+		name     string
+		layers   []int
+		jobs     int
+		expected []int
+	}{
+		{name: "all layers", jobs: 3, expected: []int{0, 1, 2, 3, 4, 5}},
+		{name: "selected layers", layers: []int{4, 1, 3}, jobs: 3, expected: []int{4, 1, 3}},
+		{name: "sequential", layers: []int{5, 0}, jobs: 0, expected: []int{5, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := layers.ReadEntries(ctx, tt.layers, tt.jobs, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != len(tt.expected) {
+				t.Fatalf("Expected %d layers, got %d", len(tt.expected), len(entries))
+			}
+			for i, layer := range tt.expected {
+				expected := fmt.Sprintf("/layer-%d", layer)
+				if len(entries[i]) != 1 || entries[i][0].Path != expected {
+					t.Errorf("Expected the entries of layer %d to contain only %s, got %v", layer, expected, entries[i])
+				}
+			}
+		})
+	}
+}
+
+// openedReporter counts the blobs that have been opened
+type openedReporter struct {
+	opened atomic.Int32
+}
+
+func (r *openedReporter) TrackBlob(_ types.BlobInfo, blob io.ReadCloser) io.ReadCloser {
+	r.opened.Add(1)
+	return blob
+}
+
+func TestStreamEntries(t *testing.T) {
+	var img imagetest.Image
+	for i := range 8 {
+		img.Layers = append(img.Layers, imagetest.Layer{
+			Files: []imagetest.File{{Path: fmt.Sprintf("layer-%d", i), Content: "content"}},
+		})
+	}
+	reporter := &openedReporter{}
+	ctx := WithProgressReporter(context.Background(), reporter)
+	layers, err := OpenImageLayers(ctx, nil, imagetest.WriteOCILayout(t, img))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer layers.Close()
+
+	t.Run("bounded", func(t *testing.T) {
+		const jobs = 2
+		var consumed []int
+		err := layers.StreamEntries(ctx, nil, jobs, false, func(layer int, entries []FileEntry) error {
+			// give the remaining layers the chance to be read ahead
+			time.Sleep(5 * time.Millisecond)
+			if opened := int(reporter.opened.Load()); opened > len(consumed)+jobs {
+				t.Errorf("Expected at most %d opened layers while passing layer %d, got %d", len(consumed)+jobs, layer, opened)
+			}
+			if expected := fmt.Sprintf("/layer-%d", layer); len(entries) != 1 || entries[0].Path != expected {
+				t.Errorf("Expected the entries of layer %d to contain only %s, got %v", layer, expected, entries)
+			}
+			consumed = append(consumed, layer)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := []int{0, 1, 2, 3, 4, 5, 6, 7}; !slices.Equal(consumed, expected) {
+			t.Errorf("Expected the layers %v, got %v", expected, consumed)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		stop := errors.New("stop")
+		var consumed []int
+		err := layers.StreamEntries(ctx, []int{3, 1, 6, 2}, 3, false, func(layer int, _ []FileEntry) error {
+			consumed = append(consumed, layer)
+			if layer == 6 {
+				return stop
+			}
+			return nil
+		})
+		if !errors.Is(err, stop) {
+			t.Errorf("Expected the error of fn, got %v", err)
+		}
+		if expected := []int{3, 1, 6}; !slices.Equal(consumed, expected) {
+			t.Errorf("Expected the layers %v, got %v", expected, consumed)
+		}
+	})
+}
+
+// countingReporter records how many bytes of every blob have been read and
+// whether the blob has been closed
+type countingReporter struct {
+	mu     sync.Mutex
+	read   map[digest.Digest]int64
+	closed map[digest.Digest]bool
+}
+
+type countingReader struct {
+	io.ReadCloser
+	reporter *countingReporter
+	digest   digest.Digest
+}
+
+func (r *countingReporter) TrackBlob(layer types.BlobInfo, blob io.ReadCloser) io.ReadCloser {
+	return &countingReader{ReadCloser: blob, reporter: r, digest: layer.Digest}
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.reporter.mu.Lock()
+	r.reporter.read[r.digest] += int64(n)
+	r.reporter.mu.Unlock()
+	return n, err
+}
+
+func (r *countingReader) Close() error {
+	r.reporter.mu.Lock()
+	r.reporter.closed[r.digest] = true
+	r.reporter.mu.Unlock()
+	return r.ReadCloser.Close()
+}
+
+func TestProgressReporter(t *testing.T) {
+	img := imagetest.Image{Layers: []imagetest.Layer{
+		{Files: []imagetest.File{{Path: "a", Content: "content"}}},
+		{Files: []imagetest.File{{Path: "b", Content: "content"}}},
+	}}
+	reporter := &countingReporter{read: map[digest.Digest]int64{}, closed: map[digest.Digest]bool{}}
+	ctx := WithProgressReporter(context.Background(), reporter)
+
+	layers, err := OpenImageLayers(ctx, nil, imagetest.WriteOCILayout(t, img))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer layers.Close()
+
+	if _, err := layers.Merge(ctx, 2, false); err != nil {
+		t.Fatal(err)
+	}
+	for _, blob := range layers.Blobs {
+		if reporter.read[blob.Digest] == 0 {
+			t.Errorf("Expected the progress of reading %s to be reported", blob.Digest)
+		}
+		if !reporter.closed[blob.Digest] {
+			t.Errorf("Expected %s to be closed", blob.Digest)
+		}
+	}
+}
@@ -0,0 +1,381 @@
+package skiff
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"debug/elf"
+	"fmt"
+	"io"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// Severity is the severity of the findings of a lint rule
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+var severityNames = []string{"info", "warning", "error"}
+
+func (s Severity) String() string {
+	if int(s) < len(severityNames) {
+		return severityNames[s]
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// ParseSeverity converts the name of a severity (info, warning or error) into
+// a Severity.
+func ParseSeverity(s string) (Severity, error) {
+	if i := slices.Index(severityNames, strings.ToLower(s)); i >= 0 {
+		return Severity(i), nil
+	}
+	return 0, fmt.Errorf("invalid severity %q, must be one of info, warning or error", s)
+}
+
+// IDs of the built-in lint rules
+const (
+	RulePackageManagerCache = "package-manager-cache"
+	RulePythonBytecode      = "python-bytecode"
+	RuleDocumentation       = "documentation"
+	RuleDevelopmentFiles    = "development-files"
+	RuleUnstrippedBinaries  = "unstripped-binaries"
+	RuleDeletedFiles        = "deleted-files"
+)
+
+// LintRule is a check for a common source of wasted space in images.
+//
+// Patterns (in Paths and Exclude) that contain a slash are matched against
+// the absolute path of a file and of all directories above it, patterns
+// without a slash against the name of the file and of all directories above
+// it, both with the syntax of path.Match.
+type LintRule struct {
+	ID          string
+	Description string
+	Severity    Severity
+	// Paths are the patterns of the files that the rule flags. They can only
+	// be changed for the rules that flag files by their path.
+	Paths []string
+	// Exclude are patterns of files that the rule ignores
+	Exclude []string
+	// MinSize is the minimum reclaimable size of reported findings
+	MinSize int64
+
+	// check returns the findings of the rule, reading up to jobs layers
+	// concurrently. It is nil for the rules that flag the files matching
+	// Paths.
+	check func(ctx context.Context, l *ImageLayers, fs *Filesystem, r LintRule, jobs int) ([]LintFinding, error)
+}
+
+// SupportsPaths returns true if the files that the rule flags are selected by
+// the patterns in Paths.
+func (r LintRule) SupportsPaths() bool {
+	return r.check == nil
+}
+
+// DefaultLintRules returns the built-in lint rules with their default
+// configuration.
+func DefaultLintRules() []LintRule {
+	return []LintRule{
+		{
+			ID:          RulePackageManagerCache,
+			Description: "Caches of package managers",
+			Severity:    SeverityWarning,
+			Paths: []string{
+				"/var/cache/zypp", "/var/cache/apt", "/var/lib/apt/lists", "/var/cache/dnf",
+				"/var/cache/yum", "/var/cache/apk", "/root/.cache/pip", "/root/.npm/_cacache",
+			},
+		},
+		{
+			ID:          RulePythonBytecode,
+			Description: "Python bytecode (__pycache__, *.pyc) next to the source files it was compiled from",
+			Severity:    SeverityWarning,
+			check:       checkPythonBytecode,
+		},
+		{
+			ID:          RuleDocumentation,
+			Description: "Man pages and documentation",
+			Severity:    SeverityWarning,
+			Paths:       []string{"/usr/share/man", "/usr/share/doc", "/usr/share/info", "/usr/share/gtk-doc"},
+		},
+		{
+			ID:          RuleDevelopmentFiles,
+			Description: "Static libraries and headers, which are only needed to build software",
+			Severity:    SeverityWarning,
+			Paths:       []string{"/usr/include", "/usr/local/include", "*.a"},
+		},
+		{
+			ID:          RuleUnstrippedBinaries,
+			Description: "ELF binaries and libraries with symbol tables or debug information",
+			Severity:    SeverityWarning,
+			check:       checkUnstrippedBinaries,
+		},
+		{
+			ID:          RuleDeletedFiles,
+			Description: "Files that are deleted by a later layer, but still take up space in the layer that added them",
+			Severity:    SeverityWarning,
+			check:       checkDeletedFiles,
+		},
+	}
+}
+
+// LintFinding is a file or a directory that a lint rule flagged.
+type LintFinding struct {
+	Rule     string
+	Severity Severity
+	// Path is the path of the flagged file or directory
+	Path string
+	// Size is the number of bytes that could be saved by removing the
+	// flagged files
+	Size int64
+	// Files is the number of flagged files
+	Files int
+	// DiffID is the diffID of the layer that contains the flagged files
+	DiffID digest.Digest
+	// Layer is the index of the layer that contains the flagged files
+	Layer int
+}
+
+// matchPattern returns the path of the file p or of the directory above it
+// that matches pattern or an empty string
+func matchPattern(pattern, p string) string {
+	for dir := p; dir != "/"; dir = path.Dir(dir) {
+		name := dir
+		if !strings.Contains(pattern, "/") {
+			name = path.Base(dir)
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return dir
+		}
+	}
+	return ""
+}
+
+// match returns the path of the file p or of the directory above it that
+// matches any of the patterns or an empty string
+func match(patterns []string, p string) string {
+	for _, pattern := range patterns {
+		if m := matchPattern(pattern, p); m != "" {
+			return m
+		}
+	}
+	return ""
+}
+
+// findings groups flagged files by their path (or the path of the directory
+// that was flagged) and layer
+type findings struct {
+	rule   LintRule
+	byPath map[string]*LintFinding
+}
+
+func newFindings(r LintRule) *findings {
+	return &findings{rule: r, byPath: map[string]*LintFinding{}}
+}
+
+// add adds a file of the layer of n to the finding with the given path,
+// unless the file is excluded
+func (f *findings) add(findingPath string, n *Node, filePath string, size int64) {
+	if match(f.rule.Exclude, filePath) != "" {
+		return
+	}
+	key := fmt.Sprintf("%s\x00%d", findingPath, n.Layer)
+	finding, ok := f.byPath[key]
+	if !ok {
+		finding = &LintFinding{Rule: f.rule.ID, Severity: f.rule.Severity, Path: findingPath, DiffID: n.DiffID, Layer: n.Layer}
+		f.byPath[key] = finding
+	}
+	finding.Size += size
+	finding.Files++
+}
+
+func (f *findings) list() []LintFinding {
+	var list []LintFinding
+	for _, finding := range f.byPath {
+		list = append(list, *finding)
+	}
+	return list
+}
+
+// Lint applies the rules to the image, fs must be the merged filesystem of
+// the image. All rules except RuleDeletedFiles only flag files of the final
+// root filesystem.
+//
+// Rules that need the content of files fetch the layers that contain them
+// again, up to jobs of them concurrently. The findings are ordered by their
+// reclaimable size, findings smaller than the MinSize of their rule are
+// dropped.
+func (l *ImageLayers) Lint(ctx context.Context, fs *Filesystem, rules []LintRule, jobs int) ([]LintFinding, error) {
+	var all []LintFinding
+	for _, r := range rules {
+		var list []LintFinding
+		if r.check != nil {
+			var err error
+			list, err = r.check(ctx, l, fs, r, jobs)
+			if err != nil {
+				return nil, fmt.Errorf("rule %s: %w", r.ID, err)
+			}
+		} else {
+			list = checkPaths(fs, r)
+		}
+		for _, finding := range list {
+			if finding.Size >= r.MinSize {
+				all = append(all, finding)
+			}
+		}
+	}
+
+	slices.SortFunc(all, func(a, b LintFinding) int {
+		return cmp.Or(cmp.Compare(b.Size, a.Size), strings.Compare(a.Rule, b.Rule), strings.Compare(a.Path, b.Path), cmp.Compare(a.Layer, b.Layer))
+	})
+	return all, nil
+}
+
+// checkPaths flags the regular files that match the paths of the rule
+func checkPaths(fs *Filesystem, r LintRule) []LintFinding {
+	f := newFindings(r)
+	_ = fs.Walk(func(n *Node) error {
+		if !n.Entry.IsRegular() {
+			return nil
+		}
+		if m := match(r.Paths, n.Entry.Path); m != "" {
+			f.add(m, n, n.Entry.Path, n.Entry.Size)
+		}
+		return nil
+	})
+	return f.list()
+}
+
+// checkPythonBytecode flags compiled Python modules whose source file exists
+// as well, so that they could be compiled when they are needed. Modules in
+// __pycache__ directories are grouped by their directory.
+func checkPythonBytecode(_ context.Context, _ *ImageLayers, fs *Filesystem, r LintRule, _ int) ([]LintFinding, error) {
+	f := newFindings(r)
+	err := fs.Walk(func(n *Node) error {
+		p := n.Entry.Path
+		if !n.Entry.IsRegular() || !strings.HasSuffix(p, ".pyc") {
+			return nil
+		}
+
+		dir, name := path.Split(p)
+		dir = path.Clean(dir)
+		findingPath, source := p, path.Join(dir, strings.TrimSuffix(name, ".pyc")+".py")
+		if path.Base(dir) == "__pycache__" {
+			// __pycache__/<module>.<tag>[.opt-N].pyc
+			module, _, _ := strings.Cut(name, ".")
+			findingPath, source = dir, path.Join(path.Dir(dir), module+".py")
+		}
+		if s := fs.Lookup(source); s != nil && s.Entry.IsRegular() {
+			f.add(findingPath, n, p, n.Entry.Size)
+		}
+		return nil
+	})
+	return f.list(), err
+}
+
+// maxELFSize is the maximum size of files that are checked for symbols and
+// debug information, as they are read into memory
+const maxELFSize = 512 * 1024 * 1024
+
+// checkUnstrippedBinaries flags ELF files that contain a symbol table or
+// debug information. The reclaimable size is the size of these sections. The
+// layers that contain executables or shared libraries are fetched again to
+// read their content, up to jobs of them concurrently.
+func checkUnstrippedBinaries(ctx context.Context, l *ImageLayers, fs *Filesystem, r LintRule, jobs int) ([]LintFinding, error) {
+	candidates := map[int]map[string]*Node{}
+	_ = fs.Walk(func(n *Node) error {
+		e := n.Entry
+		if !e.IsRegular() || e.Size < 64 || e.Size > maxELFSize || match(r.Exclude, e.Path) != "" {
+			return nil
+		}
+		if e.Mode&0o111 == 0 && !strings.Contains(path.Base(e.Path), ".so") {
+			return nil
+		}
+		if candidates[n.Layer] == nil {
+			candidates[n.Layer] = map[string]*Node{}
+		}
+		candidates[n.Layer][e.Path] = n
+		return nil
+	})
+
+	layers := slices.Sorted(maps.Keys(candidates))
+	f := newFindings(r)
+	var mu sync.Mutex
+	err := l.WalkLayers(ctx, layers, jobs, func(layer int, entry FileEntry, content io.Reader) error {
+		n, ok := candidates[layer][entry.Path]
+		if !ok || !entry.IsRegular() {
+			return nil
+		}
+		size, err := strippableSize(content)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", entry.Path, err)
+		}
+		if size > 0 {
+			mu.Lock()
+			f.add(entry.Path, n, entry.Path, size)
+			mu.Unlock()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return f.list(), nil
+}
+
+// strippableSize returns the size of the symbol table and the debug sections
+// of the ELF file in content or 0 if it is not an ELF file
+func strippableSize(content io.Reader) (int64, error) {
+	magic := make([]byte, len(elf.ELFMAG))
+	if _, err := io.ReadFull(content, magic); err != nil {
+		// files shorter than the magic are no ELF files
+		return 0, nil
+	}
+	if string(magic) != elf.ELFMAG {
+		return 0, nil
+	}
+	rest, err := io.ReadAll(content)
+	if err != nil {
+		return 0, err
+	}
+
+	file, err := elf.NewFile(bytes.NewReader(append(magic, rest...)))
+	if err != nil {
+		// not a valid ELF file, e.g. a truncated one
+		return 0, nil
+	}
+	defer file.Close()
+
+	var size int64
+	for _, s := range file.Sections {
+		if s.Type == elf.SHT_NOBITS {
+			continue
+		}
+		if s.Type == elf.SHT_SYMTAB || s.Name == ".strtab" || strings.HasPrefix(s.Name, ".debug_") || strings.HasPrefix(s.Name, ".zdebug_") {
+			size += int64(s.Size)
+		}
+	}
+	return size, nil
+}
+
+// checkDeletedFiles flags the files that a later layer deleted
+func checkDeletedFiles(_ context.Context, _ *ImageLayers, fs *Filesystem, r LintRule, _ int) ([]LintFinding, error) {
+	f := newFindings(r)
+	for _, s := range fs.Shadowed() {
+		if !s.Deleted || !s.IsRegular() {
+			continue
+		}
+		f.add(s.Path, &Node{DiffID: s.DiffID, Layer: s.Layer}, s.Path, s.Size)
+	}
+	return f.list(), nil
+}
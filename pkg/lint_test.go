@@ -0,0 +1,130 @@
+package skiff
+
+import (
+	"context"
+	"debug/elf"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dcermak/skiff/pkg/imagetest"
+)
+
+func TestLint(t *testing.T) {
+	ctx := context.Background()
+
+	sitePackages := "usr/lib/python3.11/site-packages/"
+	unstripped := imagetest.ELF(
+		imagetest.ELFSection{Name: ".text", Type: elf.SHT_PROGBITS, Size: 50},
+		imagetest.ELFSection{Name: ".symtab", Type: elf.SHT_SYMTAB, Size: 240},
+		imagetest.ELFSection{Name: ".strtab", Type: elf.SHT_STRTAB, Size: 16},
+		imagetest.ELFSection{Name: ".debug_info", Type: elf.SHT_PROGBITS, Size: 100},
+	)
+	stripped := imagetest.ELF(imagetest.ELFSection{Name: ".text", Type: elf.SHT_PROGBITS, Size: 50})
+	library := imagetest.ELF(imagetest.ELFSection{Name: ".symtab", Type: elf.SHT_SYMTAB, Size: 48})
+
+	img := imagetest.Image{Layers: []imagetest.Layer{
+		{Files: []imagetest.File{
+			{Path: "var/cache/zypp/packages/repo/foo.rpm", Content: strings.Repeat("x", 900)},
+			{Path: "var/cache/zypp/raw/repo/repomd.xml", Content: strings.Repeat("x", 100)},
+			{Path: "usr/share/man/man1/ls.1.gz", Content: strings.Repeat("x", 30)},
+			{Path: sitePackages + "mod.py", Content: strings.Repeat("x", 10)},
+			{Path: sitePackages + "__pycache__/mod.cpython-311.pyc", Content: strings.Repeat("x", 40)},
+			{Path: sitePackages + "__pycache__/mod.cpython-311.opt-1.pyc", Content: strings.Repeat("x", 45)},
+			{Path: sitePackages + "__pycache__/gone.cpython-311.pyc", Content: strings.Repeat("x", 50)},
+			{Path: "usr/lib64/libfoo.a", Content: strings.Repeat("x", 60)},
+			{Path: "usr/include/foo.h", Content: strings.Repeat("x", 15)},
+			{Path: "tmp/big", Content: strings.Repeat("x", 500)},
+			{Path: "usr/bin/app", Content: string(unstripped), Mode: 0o755},
+			{Path: "usr/bin/stripped", Content: string(stripped), Mode: 0o755},
+			{Path: "usr/bin/script", Content: "#!/bin/sh\n" + strings.Repeat("echo\n", 20), Mode: 0o755},
+			{Path: "usr/lib64/libbar.so.1", Content: string(library)},
+		}},
+		{Files: []imagetest.File{
+			{Path: "tmp/.wh.big"},
+			{Path: "usr/share/man/man1/ls.1.gz", Content: strings.Repeat("x", 35)},
+		}},
+	}}
+	layers, err := OpenImageLayers(ctx, nil, imagetest.WriteOCILayout(t, img))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer layers.Close()
+
+	fs, err := layers.Merge(ctx, 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base, update := layers.DiffIDs[0], layers.DiffIDs[1]
+	t.Run("default rules", func(t *testing.T) {
+		findings, err := layers.Lint(ctx, fs, DefaultLintRules(), 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []LintFinding{
+			{RulePackageManagerCache, SeverityWarning, "/var/cache/zypp", 1000, 2, base, 0},
+			{RuleDeletedFiles, SeverityWarning, "/tmp/big", 500, 1, base, 0},
+			{RuleUnstrippedBinaries, SeverityWarning, "/usr/bin/app", 356, 1, base, 0},
+			{RulePythonBytecode, SeverityWarning, "/" + sitePackages + "__pycache__", 85, 2, base, 0},
+			{RuleDevelopmentFiles, SeverityWarning, "/usr/lib64/libfoo.a", 60, 1, base, 0},
+			{RuleUnstrippedBinaries, SeverityWarning, "/usr/lib64/libbar.so.1", 48, 1, base, 0},
+			{RuleDocumentation, SeverityWarning, "/usr/share/man", 35, 1, update, 1},
+			{RuleDevelopmentFiles, SeverityWarning, "/usr/include", 15, 1, base, 0},
+		}
+		if !reflect.DeepEqual(findings, expected) {
+			t.Errorf("Expected %+v, got %+v", expected, findings)
+		}
+	})
+
+	t.Run("configured rules", func(t *testing.T) {
+		var rules []LintRule
+		for _, r := range DefaultLintRules() {
+			switch r.ID {
+			case RuleDocumentation:
+				r.MinSize = 100
+			case RuleDevelopmentFiles:
+				r.Severity = SeverityError
+				r.Exclude = []string{"*.a"}
+			case RulePackageManagerCache:
+				r.Exclude = []string{"/var/cache/zypp/raw"}
+			default:
+				continue
+			}
+			rules = append(rules, r)
+		}
+		rules = append(rules, LintRule{ID: "scripts", Severity: SeverityInfo, Paths: []string{"/usr/bin/script"}})
+
+		findings, err := layers.Lint(ctx, fs, rules, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []LintFinding{
+			{RulePackageManagerCache, SeverityWarning, "/var/cache/zypp", 900, 1, base, 0},
+			{"scripts", SeverityInfo, "/usr/bin/script", 110, 1, base, 0},
+			{RuleDevelopmentFiles, SeverityError, "/usr/include", 15, 1, base, 0},
+		}
+		if !reflect.DeepEqual(findings, expected) {
+			t.Errorf("Expected %+v, got %+v", expected, findings)
+		}
+	})
+}
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern, path, expected string
+	}{
+		{"/var/cache/zypp", "/var/cache/zypp/packages/foo.rpm", "/var/cache/zypp"},
+		{"/var/cache/zypp", "/var/cache/zypper.log", ""},
+		{"/usr/share/*/README", "/usr/share/foo/README", "/usr/share/foo/README"},
+		{"*.a", "/usr/lib64/libfoo.a", "/usr/lib64/libfoo.a"},
+		{"*.a", "/usr/lib64/libfoo.a.b", ""},
+		{"__pycache__", "/usr/lib/python3/__pycache__/x.pyc", "/usr/lib/python3/__pycache__"},
+		{"zypp", "/var/cache/zypp/packages", "/var/cache/zypp"},
+	}
+	for _, tt := range tests {
+		if got := matchPattern(tt.pattern, tt.path); got != tt.expected {
+			t.Errorf("matchPattern(%q, %q): expected %q, got %q", tt.pattern, tt.path, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,380 @@
+package skiff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	"go.podman.io/storage/pkg/archive"
+)
+
+// Package is a package that is installed in an image according to the
+// database of its package manager.
+type Package struct {
+	// Manager is the package manager that installed the package (rpm, dpkg
+	// or apk)
+	Manager string
+	Name    string
+	// Version is the full version of the package including the release and
+	// the epoch (if it is set)
+	Version string
+	Arch    string
+	// InstalledSize is the size of all files of the package in bytes as
+	// recorded by the package manager, it is -1 if it is unknown
+	InstalledSize int64
+	// Files contains the absolute paths of all files of the package
+	Files []string
+	// DiffID is the diffID of the layer that installed this version of the
+	// package
+	DiffID digest.Digest
+	// Layer is the index of the layer that installed this version of the
+	// package
+	Layer int
+}
+
+// key identifies a version of a package
+func (p Package) key() string {
+	return p.Name + "\x00" + p.Version + "\x00" + p.Arch
+}
+
+// PackageChanges are the packages that a layer installed or removed. Updating
+// a package removes the old version and installs the new one.
+type PackageChanges struct {
+	// DiffID is the diffID of the layer
+	DiffID digest.Digest
+	// Layer is the index of the layer
+	Layer     int
+	Installed []Package
+	Removed   []Package
+}
+
+// InstalledPackages are the packages installed in an image and the history of
+// its package database.
+type InstalledPackages struct {
+	// Manager is the package manager whose database was found
+	Manager string
+	// Database is the path of the package database in the image
+	Database string
+	// Packages are the packages in the database of the final root
+	// filesystem
+	Packages []Package
+	// Changes contains the changes of every layer that wrote the package
+	// database, starting with the bottom layer
+	Changes []PackageChanges
+}
+
+// ErrNoPackageDatabase is returned by ImageLayers.Packages if the image does
+// not contain the database of a supported package manager.
+var ErrNoPackageDatabase = errors.New("no package database found")
+
+// packageDatabase describes where a package manager stores its database and
+// how to read it
+type packageDatabase struct {
+	manager string
+	// path is the absolute path of the database in the image
+	path string
+	// related returns true for other files that the package manager stores
+	// next to its database at dbPath and that are needed to read it, it is
+	// nil if the database consists of a single file
+	related func(dbPath, p string) bool
+	// read reads the packages from a copy of the database at dbPath below
+	// the directory root on the host, the related files are copied to
+	// their paths below root as well
+	read func(root, dbPath string) ([]Package, error)
+}
+
+// packageDatabases are the supported package databases in the order in which
+// they are searched for
+var packageDatabases = []packageDatabase{
+	{manager: "rpm", path: "/usr/lib/sysimage/rpm/rpmdb.sqlite", read: readRPMDatabaseAt},
+	{manager: "rpm", path: "/usr/lib/sysimage/rpm/Packages.db", read: readRPMDatabaseAt},
+	{manager: "rpm", path: "/usr/lib/sysimage/rpm/Packages", read: readRPMDatabaseAt},
+	{manager: "rpm", path: "/var/lib/rpm/rpmdb.sqlite", read: readRPMDatabaseAt},
+	{manager: "rpm", path: "/var/lib/rpm/Packages.db", read: readRPMDatabaseAt},
+	{manager: "rpm", path: "/var/lib/rpm/Packages", read: readRPMDatabaseAt},
+	{manager: "dpkg", path: "/var/lib/dpkg/status", related: isDpkgFileList, read: readDpkgDatabase},
+	{manager: "apk", path: "/lib/apk/db/installed", read: readAPKDatabase},
+	{manager: "apk", path: "/usr/lib/apk/db/installed", read: readAPKDatabase},
+}
+
+// readRPMDatabaseAt reads the rpm database at dbPath below root
+func readRPMDatabaseAt(root, dbPath string) ([]Package, error) {
+	return readRPMDatabase(filepath.Join(root, dbPath))
+}
+
+// Packages reads the packages that are installed in the image from the
+// package database in fs, which must be the merged filesystem of the image.
+//
+// Every version of the database that a layer wrote is read, so that each
+// package can be attributed to the layer that installed it. Only the layers
+// that contain the database are fetched again, up to jobs of them
+// concurrently. ErrNoPackageDatabase is returned if fs contains no supported
+// package database.
+func (l *ImageLayers) Packages(ctx context.Context, fs *Filesystem, jobs int) (*InstalledPackages, error) {
+	db, node, err := findPackageDatabase(fs)
+	if err != nil {
+		return nil, err
+	}
+	dbPath := node.Entry.Path
+	relevant := func(p string) bool {
+		return p == dbPath || db.related != nil && db.related(dbPath, p)
+	}
+
+	// dbLayers are the layers that wrote the database, layers are the
+	// layers that wrote or deleted the database or any related file
+	dbLayers := map[int]bool{node.Layer: true}
+	layers := map[int]bool{node.Layer: true}
+	for _, f := range fs.Shadowed() {
+		if !relevant(f.Path) {
+			continue
+		}
+		if f.IsRegular() {
+			layers[f.Layer] = true
+			if f.Path == dbPath {
+				dbLayers[f.Layer] = true
+			}
+		}
+		if f.Deleted {
+			layers[f.ShadowedByLayer] = true
+		}
+	}
+	if db.related != nil {
+		_ = fs.Walk(func(n *Node) error {
+			if n.Entry.IsRegular() && relevant(n.Entry.Path) {
+				layers[n.Layer] = true
+			}
+			return nil
+		})
+	}
+
+	tmp, err := os.MkdirTemp("", "skiff-"+db.manager+"db-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	var sorted []int
+	for layer := range len(l.Blobs) {
+		if layers[layer] {
+			sorted = append(sorted, layer)
+		}
+	}
+	extracted, err := l.extractLayerFiles(ctx, sorted, jobs, filepath.Join(tmp, "layers"), relevant)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract the %s database %s: %w", db.manager, dbPath, err)
+	}
+
+	root := filepath.Join(tmp, "root")
+	installed := &InstalledPackages{Manager: db.manager, Database: dbPath}
+	previous := map[string]Package{}
+	for _, layer := range sorted {
+		// the database and its related files are applied on top of the
+		// files of the lower layers, so that e.g. the file lists of
+		// packages that an upper layer did not touch are still found
+		if err := extracted[layer].apply(root); err != nil {
+			return nil, fmt.Errorf("failed to extract the %s database %s of layer %s: %w", db.manager, dbPath, l.DiffIDs[layer], err)
+		}
+		if !dbLayers[layer] {
+			continue
+		}
+
+		packages, err := db.read(root, dbPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the %s database %s of layer %s: %w", db.manager, dbPath, l.DiffIDs[layer], err)
+		}
+
+		// a package was installed by the first layer of an uninterrupted
+		// sequence of databases that contain it
+		changes := PackageChanges{DiffID: l.DiffIDs[layer], Layer: layer}
+		current := make(map[string]Package, len(packages))
+		for i, pkg := range packages {
+			pkg.Manager = db.manager
+			if prev, ok := previous[pkg.key()]; ok {
+				pkg.DiffID, pkg.Layer = prev.DiffID, prev.Layer
+			} else {
+				pkg.DiffID, pkg.Layer = l.DiffIDs[layer], layer
+				changes.Installed = append(changes.Installed, pkg)
+			}
+			packages[i] = pkg
+			current[pkg.key()] = pkg
+		}
+		for _, pkg := range previous {
+			if _, ok := current[pkg.key()]; !ok {
+				changes.Removed = append(changes.Removed, pkg)
+			}
+		}
+		slices.SortFunc(changes.Removed, func(a, b Package) int { return strings.Compare(a.key(), b.key()) })
+
+		installed.Packages = packages
+		installed.Changes = append(installed.Changes, changes)
+		previous = current
+	}
+	return installed, nil
+}
+
+// findPackageDatabase returns the first of the packageDatabases that exists
+// in fs and its node. Symbolic links are followed, as e.g. /var/lib/rpm is
+// often a link to /usr/lib/sysimage/rpm.
+func findPackageDatabase(fs *Filesystem) (packageDatabase, *Node, error) {
+	for _, db := range packageDatabases {
+		n, err := fs.Resolve(db.path)
+		if err != nil && !errors.Is(err, ErrSymlinkLoop) {
+			return packageDatabase{}, nil, err
+		}
+		if n != nil && n.Entry.IsRegular() {
+			return db, n, nil
+		}
+	}
+	return packageDatabase{}, nil, ErrNoPackageDatabase
+}
+
+// layerOpKind is the kind of change of a layer to the filesystem
+type layerOpKind int
+
+const (
+	// opWrite writes a file
+	opWrite layerOpKind = iota
+	// opDelete deletes a file via a whiteout
+	opDelete
+	// opOpaque hides the contents of a directory via an opaque whiteout
+	opOpaque
+)
+
+// layerOp is a change of a layer to the filesystem
+type layerOp struct {
+	kind layerOpKind
+	path string
+}
+
+// layerFiles are the relevant files of a layer, extracted to dir, and the
+// changes of the layer in the order of its archive
+type layerFiles struct {
+	dir string
+	ops []layerOp
+}
+
+// extractLayerFiles copies the regular files of the layers with the given
+// indexes for which relevant returns true to their path below a directory
+// for every layer in dir, and records the files that the layers delete via
+// whiteouts or opaque directories. Up to jobs layers are read concurrently.
+func (l *ImageLayers) extractLayerFiles(ctx context.Context, layers []int, jobs int, dir string, relevant func(p string) bool) (map[int]*layerFiles, error) {
+	extracted := make(map[int]*layerFiles, len(layers))
+	for _, layer := range layers {
+		extracted[layer] = &layerFiles{dir: filepath.Join(dir, strconv.Itoa(layer))}
+	}
+
+	// every layer only modifies its own layerFiles
+	err := l.WalkLayers(ctx, layers, jobs, func(layer int, entry FileEntry, content io.Reader) error {
+		lf := extracted[layer]
+		dir, base := path.Split(entry.Path)
+		if base == archive.WhiteoutOpaqueDir {
+			lf.ops = append(lf.ops, layerOp{kind: opOpaque, path: path.Clean(dir)})
+			return nil
+		}
+		if name, ok := strings.CutPrefix(base, archive.WhiteoutPrefix); ok {
+			if deleted := path.Join(dir, name); relevant(deleted) {
+				lf.ops = append(lf.ops, layerOp{kind: opDelete, path: deleted})
+			}
+			return nil
+		}
+		if !entry.IsRegular() || !relevant(entry.Path) {
+			return nil
+		}
+
+		dest := filepath.Join(lf.dir, entry.Path)
+		if err := os.MkdirAll(filepath.Dir(dest), 0o700); err != nil {
+			return err
+		}
+		f, err := os.Create(dest)
+		if err != nil {
+			return err
+		}
+		lf.ops = append(lf.ops, layerOp{kind: opWrite, path: entry.Path})
+		if _, err := io.Copy(f, content); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return extracted, nil
+}
+
+// apply moves the extracted files of the layer to their path below root and
+// removes the files that the layer deletes in the order of the layer archive.
+func (lf *layerFiles) apply(root string) error {
+	// the files that this layer wrote, which an opaque directory that comes
+	// later in the archive does not remove
+	written := map[string]bool{}
+	for _, op := range lf.ops {
+		dest := filepath.Join(root, op.path)
+		switch op.kind {
+		case opOpaque:
+			if err := clearOpaqueDir(root, op.path, written); err != nil {
+				return err
+			}
+		case opDelete:
+			if err := os.Remove(dest); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		case opWrite:
+			if err := os.MkdirAll(filepath.Dir(dest), 0o700); err != nil {
+				return err
+			}
+			// a file that the layer wrote more than once has
+			// already been moved with its last content
+			err := os.Rename(filepath.Join(lf.dir, op.path), dest)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			written[op.path] = true
+		}
+	}
+	return os.RemoveAll(lf.dir)
+}
+
+// clearOpaqueDir removes the files below dir that were extracted to root from
+// lower layers, as an opaque directory hides all of them. The files in
+// written have been extracted from the layer with the opaque directory and
+// are kept.
+func clearOpaqueDir(root string, dir string, written map[string]bool) error {
+	return filepath.WalkDir(filepath.Join(root, dir), func(p string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		if written[path.Join("/", filepath.ToSlash(rel))] {
+			return nil
+		}
+		return os.Remove(p)
+	})
+}
+
+// PackageOwners maps the path of every file of the packages to the name of
+// the package that owns it.
+func PackageOwners(packages []Package) map[string]string {
+	owners := map[string]string{}
+	for _, pkg := range packages {
+		for _, f := range pkg.Files {
+			owners[f] = pkg.Name
+		}
+	}
+	return owners
+}
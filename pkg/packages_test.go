@@ -0,0 +1,270 @@
+package skiff
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dcermak/skiff/pkg/imagetest"
+)
+
+func TestImagePackages(t *testing.T) {
+	ctx := context.Background()
+
+	bash := imagetest.RPM{Name: "bash", Version: "5.2.15", Release: "1.1", Arch: "x86_64", Size: 1000, Files: []string{"/usr/bin/bash"}}
+	filesystem := imagetest.RPM{Name: "filesystem", Version: "84.87", Release: "1.1", Arch: "x86_64", Size: 10}
+	bashUpdate := bash
+	bashUpdate.Release = "2.1"
+	vim := imagetest.RPM{Name: "vim", Version: "9.1", Release: "1.1", Arch: "x86_64", Size: 5000, Files: []string{"/usr/bin/vim"}}
+
+	img := imagetest.Image{Layers: []imagetest.Layer{
+		{Files: []imagetest.File{
+			{Path: "usr/lib/sysimage/rpm/Packages.db", Content: string(imagetest.NDBDatabase(filesystem, bash))},
+			{Path: "var/lib/rpm", Typeflag: tar.TypeSymlink, Linkname: "../../usr/lib/sysimage/rpm"},
+		}},
+		{Files: []imagetest.File{{Path: "etc/motd", Content: "hello"}}},
+		{Files: []imagetest.File{
+			{Path: "usr/lib/sysimage/rpm/Packages.db", Content: string(imagetest.NDBDatabase(filesystem, bashUpdate, vim))},
+		}},
+	}}
+	layers, err := OpenImageLayers(ctx, nil, imagetest.WriteOCILayout(t, img))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer layers.Close()
+
+	fs, err := layers.Merge(ctx, 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	installed, err := layers.Packages(ctx, fs, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if installed.Manager != "rpm" || installed.Database != "/usr/lib/sysimage/rpm/Packages.db" {
+		t.Errorf("Expected the rpm database /usr/lib/sysimage/rpm/Packages.db, got the %s database %s", installed.Manager, installed.Database)
+	}
+
+	expected := []Package{
+		{Manager: "rpm", Name: "filesystem", Version: "84.87-1.1", Arch: "x86_64", InstalledSize: 10, DiffID: layers.DiffIDs[0], Layer: 0},
+		{Manager: "rpm", Name: "bash", Version: "5.2.15-2.1", Arch: "x86_64", InstalledSize: 1000, Files: []string{"/usr/bin/bash"}, DiffID: layers.DiffIDs[2], Layer: 2},
+		{Manager: "rpm", Name: "vim", Version: "9.1-1.1", Arch: "x86_64", InstalledSize: 5000, Files: []string{"/usr/bin/vim"}, DiffID: layers.DiffIDs[2], Layer: 2},
+	}
+	if !reflect.DeepEqual(installed.Packages, expected) {
+		t.Errorf("Expected packages %+v, got %+v", expected, installed.Packages)
+	}
+
+	oldBash := Package{Manager: "rpm", Name: "bash", Version: "5.2.15-1.1", Arch: "x86_64", InstalledSize: 1000, Files: []string{"/usr/bin/bash"}, DiffID: layers.DiffIDs[0], Layer: 0}
+	expectedChanges := []PackageChanges{
+		{DiffID: layers.DiffIDs[0], Layer: 0, Installed: []Package{expected[0], oldBash}},
+		{DiffID: layers.DiffIDs[2], Layer: 2, Installed: expected[1:], Removed: []Package{oldBash}},
+	}
+	if !reflect.DeepEqual(installed.Changes, expectedChanges) {
+		t.Errorf("Expected changes %+v, got %+v", expectedChanges, installed.Changes)
+	}
+
+	owners := PackageOwners(installed.Packages)
+	if owners["/usr/bin/vim"] != "vim" || owners["/usr/bin/bash"] != "bash" {
+		t.Errorf("Unexpected package owners %v", owners)
+	}
+
+	t.Run("no database", func(t *testing.T) {
+		fs := NewFilesystem()
+		fs.ApplyLayer(layers.DiffIDs[1], []FileEntry{{Path: "/etc/motd", Typeflag: tar.TypeReg}})
+		if _, err := layers.Packages(ctx, fs, 2); !errors.Is(err, ErrNoPackageDatabase) {
+			t.Errorf("Expected ErrNoPackageDatabase, got %v", err)
+		}
+	})
+}
+
+func TestImagePackagesDpkg(t *testing.T) {
+	ctx := context.Background()
+
+	status := func(packages ...string) string {
+		return strings.Join(packages, "\n")
+	}
+	baseFiles := `Package: base-files
+Status: install ok installed
+Priority: required
+Installed-Size: 394
+Architecture: amd64
+Version: 12.4+deb12u5
+Description: Debian base system miscellaneous files
+ This package contains the basic filesystem hierarchy of a Debian system.
+`
+	libc := `Package: libc6
+Status: install ok installed
+Installed-Size: 12986
+Architecture: amd64
+Multi-Arch: same
+Version: 2.36-9+deb12u4
+`
+	tzdata := `Package: tzdata
+Status: install ok installed
+Installed-Size: 3000
+Architecture: all
+Version: 2024a-0+deb12u1
+`
+	removedTzdata := `Package: tzdata
+Status: deinstall ok config-files
+Architecture: all
+Version: 2024a-0+deb12u1
+`
+	curl := `Package: curl
+Status: install ok installed
+Installed-Size: 500
+Architecture: amd64
+Version: 7.88.1-10+deb12u5
+`
+
+	img := imagetest.Image{Layers: []imagetest.Layer{
+		{Files: []imagetest.File{
+			{Path: "var/lib/dpkg/status", Content: status(baseFiles, libc, tzdata)},
+			{Path: "var/lib/dpkg/info/base-files.list", Content: "/.\n/etc\n/etc/debian_version\n"},
+			{Path: "var/lib/dpkg/info/libc6:amd64.list", Content: "/.\n/usr/lib/x86_64-linux-gnu/libc.so.6\n"},
+			{Path: "var/lib/dpkg/info/tzdata.list", Content: "/usr/share/zoneinfo/UTC\n"},
+		}},
+		{Files: []imagetest.File{
+			{Path: "var/lib/dpkg/status", Content: status(baseFiles, libc, removedTzdata, curl)},
+			{Path: "var/lib/dpkg/info/curl.list", Content: "/usr/bin/curl\n"},
+			{Path: "var/lib/dpkg/info/.wh.tzdata.list"},
+		}},
+	}}
+	layers, err := OpenImageLayers(ctx, nil, imagetest.WriteOCILayout(t, img))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer layers.Close()
+
+	fs, err := layers.Merge(ctx, 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	installed, err := layers.Packages(ctx, fs, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base, update := layers.DiffIDs[0], layers.DiffIDs[1]
+	expected := []Package{
+		{Manager: "dpkg", Name: "base-files", Version: "12.4+deb12u5", Arch: "amd64", InstalledSize: 394 * 1024, Files: []string{"/etc", "/etc/debian_version"}, DiffID: base, Layer: 0},
+		{Manager: "dpkg", Name: "libc6", Version: "2.36-9+deb12u4", Arch: "amd64", InstalledSize: 12986 * 1024, Files: []string{"/usr/lib/x86_64-linux-gnu/libc.so.6"}, DiffID: base, Layer: 0},
+		{Manager: "dpkg", Name: "curl", Version: "7.88.1-10+deb12u5", Arch: "amd64", InstalledSize: 500 * 1024, Files: []string{"/usr/bin/curl"}, DiffID: update, Layer: 1},
+	}
+	if !reflect.DeepEqual(installed.Packages, expected) {
+		t.Errorf("Expected packages %+v, got %+v", expected, installed.Packages)
+	}
+
+	if len(installed.Changes) != 2 {
+		t.Fatalf("Expected changes in 2 layers, got %+v", installed.Changes)
+	}
+	changes := installed.Changes[1]
+	if len(changes.Installed) != 1 || changes.Installed[0].Name != "curl" || len(changes.Removed) != 1 || changes.Removed[0].Name != "tzdata" {
+		t.Errorf("Expected the second layer to install curl and remove tzdata, got %+v", changes)
+	}
+}
+
+func TestImagePackagesOpaqueDirectory(t *testing.T) {
+	ctx := context.Background()
+
+	status := `Package: base-files
+Status: install ok installed
+Installed-Size: 394
+Architecture: amd64
+Version: 12.4+deb12u5
+
+Package: tzdata
+Status: install ok installed
+Installed-Size: 3000
+Architecture: all
+Version: 2024a-0+deb12u1
+`
+	img := imagetest.Image{Layers: []imagetest.Layer{
+		{Files: []imagetest.File{
+			{Path: "var/lib/dpkg/status", Content: status},
+			{Path: "var/lib/dpkg/info/base-files.list", Content: "/etc\n"},
+			{Path: "var/lib/dpkg/info/tzdata.list", Content: "/usr/share/zoneinfo/UTC\n"},
+		}},
+		{Files: []imagetest.File{
+			// the files of the lower layer are hidden, but not the
+			// files of the same layer, even if they come first
+			{Path: "var/lib/dpkg/status", Content: status},
+			{Path: "var/lib/dpkg/info/base-files.list", Content: "/etc\n/etc/debian_version\n"},
+			{Path: "var/lib/dpkg/info/.wh..wh..opq"},
+		}},
+	}}
+	layers, err := OpenImageLayers(ctx, nil, imagetest.WriteOCILayout(t, img))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer layers.Close()
+
+	fs, err := layers.Merge(ctx, 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	installed, err := layers.Packages(ctx, fs, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string][]string{}
+	for _, pkg := range installed.Packages {
+		files[pkg.Name] = pkg.Files
+	}
+	expected := map[string][]string{
+		"base-files": {"/etc", "/etc/debian_version"},
+		"tzdata":     nil,
+	}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("Expected the files %v, got %v", expected, files)
+	}
+}
+
+func TestReadAPKDatabase(t *testing.T) {
+	root := t.TempDir()
+	db := `C:Q1abc=
+P:musl
+V:1.2.5-r0
+A:x86_64
+S:407657
+I:637952
+T:the musl c library (libc) implementation
+F:lib
+R:ld-musl-x86_64.so.1
+a:0:0:755
+R:libc.musl-x86_64.so.1
+
+P:busybox
+V:1.36.1-r29
+A:x86_64
+I:924365
+F:bin
+R:busybox
+F:etc
+R:securetty
+`
+	if err := os.MkdirAll(filepath.Join(root, "lib/apk/db"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "lib/apk/db/installed"), []byte(db), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	packages, err := readAPKDatabase(root, "/lib/apk/db/installed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Package{
+		{Name: "musl", Version: "1.2.5-r0", Arch: "x86_64", InstalledSize: 637952, Files: []string{"/lib/ld-musl-x86_64.so.1", "/lib/libc.musl-x86_64.so.1"}},
+		{Name: "busybox", Version: "1.36.1-r29", Arch: "x86_64", InstalledSize: 924365, Files: []string{"/bin/busybox", "/etc/securetty"}},
+	}
+	if !reflect.DeepEqual(packages, expected) {
+		t.Errorf("Expected packages %+v, got %+v", expected, packages)
+	}
+}
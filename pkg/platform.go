@@ -0,0 +1,130 @@
+package skiff
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"go.podman.io/common/libimage"
+	"go.podman.io/image/v5/manifest"
+	storageTransport "go.podman.io/image/v5/storage"
+	"go.podman.io/image/v5/transports/alltransports"
+	"go.podman.io/image/v5/types"
+)
+
+// ParsePlatform parses a platform in the form os/arch[/variant], e.g.
+// linux/arm64/v8.
+func ParsePlatform(s string) (imgspecv1.Platform, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) < 2 || len(parts) > 3 || slices.Contains(parts, "") {
+		return imgspecv1.Platform{}, fmt.Errorf("invalid platform %q, must be in the form os/arch[/variant]", s)
+	}
+
+	p := imgspecv1.Platform{OS: parts[0], Architecture: parts[1]}
+	if len(parts) == 3 {
+		p.Variant = parts[2]
+	}
+	return p, nil
+}
+
+// FormatPlatform returns the platform in the form os/arch[/variant].
+func FormatPlatform(p imgspecv1.Platform) string {
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+// WithPlatform returns a copy of sysCtx that selects the image for the
+// platform p from manifest lists and OCI indexes.
+func WithPlatform(sysCtx *types.SystemContext, p imgspecv1.Platform) *types.SystemContext {
+	res := types.SystemContext{}
+	if sysCtx != nil {
+		res = *sysCtx
+	}
+	res.OSChoice = p.OS
+	res.ArchitectureChoice = p.Architecture
+	res.VariantChoice = p.Variant
+	return &res
+}
+
+// ImagePlatforms returns the platforms of all images in the manifest list or
+// OCI index at uri. Images that are not multi-arch return only their own
+// platform.
+//
+// Like ImageAndLayersFromURI, uris without a transport are looked up in the
+// local container storage first and in a registry afterwards.
+func ImagePlatforms(ctx context.Context, sysCtx *types.SystemContext, uri string) ([]imgspecv1.Platform, error) {
+	uri, err := withPathTransport(uri)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := alltransports.ParseImageName(uri)
+	if err != nil || ref.Transport().Name() == storageTransport.Transport.Name() {
+		runtime, _, err := localRuntime()
+		if err != nil {
+			return nil, err
+		}
+
+		img, _, err := runtime.LookupImage(uri, &libimage.LookupImageOptions{ManifestList: true})
+		if err == nil {
+			ref, err = img.StorageReference()
+		} else {
+			ref, err = alltransports.ParseImageName(fmt.Sprintf("docker://%s", uri))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	src, err := ref.NewImageSource(ctx, sysCtx)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	raw, mimeType, err := src.GetManifest(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if !manifest.MIMETypeIsMultiImage(mimeType) {
+		img, err := ref.NewImage(ctx, sysCtx)
+		if err != nil {
+			return nil, err
+		}
+		defer img.Close()
+
+		inspect, err := img.Inspect(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return []imgspecv1.Platform{{OS: inspect.Os, Architecture: inspect.Architecture, Variant: inspect.Variant}}, nil
+	}
+
+	list, err := manifest.ListFromBlob(raw, mimeType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the manifest list of %s: %w", uri, err)
+	}
+
+	var platforms []imgspecv1.Platform
+	for _, d := range list.Instances() {
+		instance, err := list.Instance(d)
+		if err != nil {
+			return nil, err
+		}
+		p := instance.ReadOnly.Platform
+		// attestations and other artifacts have no (or an unknown) platform
+		if p == nil || p.OS == "" || p.OS == "unknown" {
+			continue
+		}
+		platform := imgspecv1.Platform{OS: p.OS, Architecture: p.Architecture, Variant: p.Variant}
+		if !slices.ContainsFunc(platforms, func(o imgspecv1.Platform) bool { return FormatPlatform(o) == FormatPlatform(platform) }) {
+			platforms = append(platforms, platform)
+		}
+	}
+	return platforms, nil
+}
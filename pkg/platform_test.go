@@ -0,0 +1,53 @@
+package skiff
+
+import (
+	"testing"
+
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"go.podman.io/image/v5/types"
+)
+
+func TestParsePlatform(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected imgspecv1.Platform
+	}{
+		{"linux/amd64", imgspecv1.Platform{OS: "linux", Architecture: "amd64"}},
+		{"linux/arm64/v8", imgspecv1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}},
+	}
+
+	for _, test := range tests {
+		p, err := ParsePlatform(test.input)
+		if err != nil {
+			t.Errorf("ParsePlatform(%q) returned an error: %v", test.input, err)
+			continue
+		}
+		if p.OS != test.expected.OS || p.Architecture != test.expected.Architecture || p.Variant != test.expected.Variant {
+			t.Errorf("ParsePlatform(%q) = %+v, expected %+v", test.input, p, test.expected)
+		}
+		if s := FormatPlatform(p); s != test.input {
+			t.Errorf("FormatPlatform(%+v) = %q, expected %q", p, s, test.input)
+		}
+	}
+
+	for _, invalid := range []string{"", "linux", "linux/", "/amd64", "linux/arm/v7/extra"} {
+		if _, err := ParsePlatform(invalid); err == nil {
+			t.Errorf("Expected an error for the invalid platform %q", invalid)
+		}
+	}
+}
+
+func TestWithPlatform(t *testing.T) {
+	sysCtx := &types.SystemContext{DockerCertPath: "/etc/certs"}
+	res := WithPlatform(sysCtx, imgspecv1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"})
+
+	if res.OSChoice != "linux" || res.ArchitectureChoice != "arm" || res.VariantChoice != "v7" {
+		t.Errorf("Platform not set in the system context: %+v", res)
+	}
+	if res.DockerCertPath != "/etc/certs" {
+		t.Errorf("Expected the other settings to be preserved, got %+v", res)
+	}
+	if sysCtx.OSChoice != "" {
+		t.Errorf("Expected the original system context to be unchanged, got %+v", sysCtx)
+	}
+}
@@ -0,0 +1,30 @@
+package skiff
+
+import (
+	"context"
+	"io"
+
+	"go.podman.io/image/v5/types"
+)
+
+// ProgressReporter is notified whenever the blob of a layer is read, e.g. to
+// show the progress of downloading and decompressing large layers.
+type ProgressReporter interface {
+	// TrackBlob returns a reader that reads blob and reports how much of
+	// it has been read. layer.Size is the size of the blob or -1 if it is
+	// unknown. Closing the returned reader closes blob.
+	TrackBlob(layer types.BlobInfo, blob io.ReadCloser) io.ReadCloser
+}
+
+type progressReporterKey struct{}
+
+// WithProgressReporter returns a context that makes all functions reading
+// layers report their progress to r.
+func WithProgressReporter(ctx context.Context, r ProgressReporter) context.Context {
+	return context.WithValue(ctx, progressReporterKey{}, r)
+}
+
+func progressReporterFromContext(ctx context.Context) ProgressReporter {
+	r, _ := ctx.Value(progressReporterKey{}).(ProgressReporter)
+	return r
+}
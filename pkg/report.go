@@ -0,0 +1,174 @@
+package skiff
+
+import (
+	"time"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// LayerReport describes a single layer of an image.
+//
+// Sizes that could not be determined are set to -1.
+type LayerReport struct {
+	// DiffID is the digest of the uncompressed layer archive, it is empty
+	// if the image config does not list the diffIDs
+	DiffID digest.Digest `json:"diffID,omitempty" yaml:"diffID,omitempty"`
+	// Digest is the digest of the layer blob as stored in the transport
+	Digest digest.Digest `json:"digest,omitempty" yaml:"digest,omitempty"`
+	// CompressedSize is the size of the layer blob as stored in the
+	// transport
+	CompressedSize int64 `json:"compressedSize" yaml:"compressedSize"`
+	// UncompressedSize is the size of the uncompressed layer archive
+	UncompressedSize int64 `json:"uncompressedSize" yaml:"uncompressedSize"`
+	// CompressionRatio is the uncompressed size divided by the compressed
+	// size, it is -1 if either of them is unknown
+	CompressionRatio float64 `json:"compressionRatio" yaml:"compressionRatio"`
+	// MediaType is the media type of the layer blob
+	MediaType string `json:"mediaType,omitempty" yaml:"mediaType,omitempty"`
+	// CreatedBy is the build instruction that created the layer, taken
+	// from the image history
+	CreatedBy string `json:"createdBy,omitempty" yaml:"createdBy,omitempty"`
+	// Created is the time at which the layer was created, taken from the
+	// image history
+	Created time.Time `json:"created,omitzero" yaml:"created,omitempty"`
+	// Comment is the comment of the image history entry of the layer
+	Comment string `json:"comment,omitempty" yaml:"comment,omitempty"`
+	// EmptyLayer is true for build steps that did not create a layer
+	// (e.g. `ENV` or `LABEL`)
+	EmptyLayer bool `json:"emptyLayer,omitempty" yaml:"emptyLayer,omitempty"`
+	// Platform is the platform (os/arch[/variant]) of the image that
+	// contains the layer, it is only set when analyzing all platforms of a
+	// multi-arch image
+	Platform string `json:"platform,omitempty" yaml:"platform,omitempty"`
+}
+
+// FileReport describes a single file in a layer of an image.
+type FileReport struct {
+	Path string `json:"path" yaml:"path"`
+	Size int64  `json:"size" yaml:"size"`
+	// DiffID is the diffID of the layer that contains the file
+	DiffID digest.Digest `json:"diffID" yaml:"diffID"`
+	// HardLinks contains the paths of the other hard links to the file in
+	// the same layer, the size of the file is only reported once
+	HardLinks []string `json:"hardLinks,omitempty" yaml:"hardLinks,omitempty"`
+	// Package is the name of the package that owns the file, it is only set
+	// if package ownership has been requested
+	Package string `json:"package,omitempty" yaml:"package,omitempty"`
+}
+
+// MergedFilesReport is the report of the files of the merged filesystem of an
+// image together with the files that upper layers hide.
+type MergedFilesReport struct {
+	Files    []FileReport   `json:"files" yaml:"files"`
+	Shadowed ShadowedReport `json:"shadowed" yaml:"shadowed"`
+}
+
+// ShadowedReport summarizes the files that were overwritten or deleted by
+// upper layers.
+type ShadowedReport struct {
+	// Files is the number of shadowed files
+	Files int `json:"files" yaml:"files"`
+	// Size is the accumulated size of the shadowed files
+	Size int64 `json:"size" yaml:"size"`
+}
+
+// PackageReport describes a package that is installed in an image.
+type PackageReport struct {
+	Name    string `json:"name" yaml:"name"`
+	Version string `json:"version" yaml:"version"`
+	Arch    string `json:"arch" yaml:"arch"`
+	// InstalledSize is the size of all files of the package as recorded by
+	// the package manager, it is -1 if it is unknown
+	InstalledSize int64 `json:"installedSize" yaml:"installedSize"`
+	// DiffID is the diffID of the layer that installed the package
+	DiffID digest.Digest `json:"diffID" yaml:"diffID"`
+	// Manager is the package manager that installed the package
+	Manager string `json:"manager" yaml:"manager"`
+}
+
+// DirectoryReport describes a directory of an image with the accumulated
+// size of all files below it.
+type DirectoryReport struct {
+	Path string `json:"path" yaml:"path"`
+	Size int64  `json:"size" yaml:"size"`
+	// Files is the number of files below the directory
+	Files int `json:"files" yaml:"files"`
+}
+
+// PackageChangeReport describes a package that a layer installed or removed.
+type PackageChangeReport struct {
+	// DiffID is the diffID of the layer
+	DiffID digest.Digest `json:"diffID" yaml:"diffID"`
+	// Change is either "installed" or "removed"
+	Change        string `json:"change" yaml:"change"`
+	Name          string `json:"name" yaml:"name"`
+	Version       string `json:"version" yaml:"version"`
+	Arch          string `json:"arch" yaml:"arch"`
+	InstalledSize int64  `json:"installedSize" yaml:"installedSize"`
+	Manager       string `json:"manager" yaml:"manager"`
+}
+
+// DependencyReport describes the files of a dependency of a language
+// ecosystem in a single layer.
+type DependencyReport struct {
+	// Ecosystem is one of python, npm, gem, maven or go
+	Ecosystem string `json:"ecosystem" yaml:"ecosystem"`
+	Name      string `json:"name" yaml:"name"`
+	Version   string `json:"version,omitempty" yaml:"version,omitempty"`
+	// Path is the directory that contains the dependency
+	Path string `json:"path" yaml:"path"`
+	// Size is the accumulated size of the files of the dependency in the
+	// layer
+	Size int64 `json:"size" yaml:"size"`
+	// Files is the number of files of the dependency in the layer
+	Files int `json:"files" yaml:"files"`
+	// DiffID is the diffID of the layer
+	DiffID digest.Digest `json:"diffID" yaml:"diffID"`
+}
+
+// LintReport describes a file or a directory that a lint rule flagged.
+type LintReport struct {
+	Rule string `json:"rule" yaml:"rule"`
+	// Severity is one of info, warning or error
+	Severity string `json:"severity" yaml:"severity"`
+	Path     string `json:"path" yaml:"path"`
+	// Size is the number of bytes that could be saved by removing the
+	// flagged files
+	Size int64 `json:"size" yaml:"size"`
+	// Files is the number of flagged files
+	Files int `json:"files" yaml:"files"`
+	// DiffID is the diffID of the layer that contains the flagged files
+	DiffID digest.Digest `json:"diffID" yaml:"diffID"`
+}
+
+// CheckReport is the result of comparing an image, one of its layers or one
+// of its files against a size budget.
+type CheckReport struct {
+	// Budget is the name of the budget, e.g. max-size
+	Budget string `json:"budget" yaml:"budget"`
+	// Subject is the diffID of the layer or the path of the file that was
+	// checked, it is empty for budgets of the whole image
+	Subject string `json:"subject,omitempty" yaml:"subject,omitempty"`
+	Limit   int64  `json:"limit" yaml:"limit"`
+	// Actual is the measured size, it is -1 if it is unknown
+	Actual   int64 `json:"actual" yaml:"actual"`
+	Exceeded bool  `json:"exceeded" yaml:"exceeded"`
+	// Incomplete is true if the sizes of some layers are unknown, Actual
+	// then only adds up the known sizes and is a lower bound
+	Incomplete bool `json:"incomplete,omitempty" yaml:"incomplete,omitempty"`
+}
+
+// Unknown returns true if the size could not be measured completely and
+// the known part does not exceed the budget.
+func (r CheckReport) Unknown() bool {
+	return !r.Exceeded && (r.Actual < 0 || r.Incomplete)
+}
+
+// CompressionRatio returns the ratio of the uncompressed to the compressed
+// size or -1 if either of them is unknown.
+func CompressionRatio(compressedSize, uncompressedSize int64) float64 {
+	if compressedSize <= 0 || uncompressedSize < 0 {
+		return -1
+	}
+	return float64(uncompressedSize) / float64(compressedSize)
+}
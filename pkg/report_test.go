@@ -0,0 +1,22 @@
+package skiff
+
+import "testing"
+
+func TestCompressionRatio(t *testing.T) {
+	tests := []struct {
+		compressed, uncompressed int64
+		expected                 float64
+	}{
+		{100, 250, 2.5},
+		{100, 100, 1},
+		{-1, 250, -1},
+		{100, -1, -1},
+		{0, 0, -1},
+	}
+
+	for _, test := range tests {
+		if ratio := CompressionRatio(test.compressed, test.uncompressed); ratio != test.expected {
+			t.Errorf("CompressionRatio(%d, %d) = %v, expected %v", test.compressed, test.uncompressed, ratio, test.expected)
+		}
+	}
+}
@@ -0,0 +1,400 @@
+package skiff
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+
+	// registers the sqlite3 driver for rpmdb.sqlite databases
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// tags of the rpm header that are read by parseRPMHeader
+const (
+	rpmTagName         = 1000
+	rpmTagVersion      = 1001
+	rpmTagRelease      = 1002
+	rpmTagEpoch        = 1003
+	rpmTagSize         = 1009
+	rpmTagArch         = 1022
+	rpmTagOldFilenames = 1027
+	rpmTagDirIndexes   = 1116
+	rpmTagBasenames    = 1117
+	rpmTagDirnames     = 1118
+	rpmTagLongSize     = 5009
+)
+
+// data types of rpm header entries
+const (
+	rpmTypeInt32       = 4
+	rpmTypeInt64       = 5
+	rpmTypeString      = 6
+	rpmTypeStringArray = 8
+	rpmTypeI18NString  = 9
+)
+
+// rpmIndexEntry is an entry of the index of an rpm header
+type rpmIndexEntry struct {
+	Type   uint32
+	Offset int32
+	Count  uint32
+}
+
+// rpmHeader is a parsed rpm header as stored in the rpm database
+type rpmHeader struct {
+	index map[int32]rpmIndexEntry
+	data  []byte
+}
+
+// parseRPMHeader parses a header blob from the rpm database. Unlike headers
+// in rpm files, the blobs in the database do not start with the header magic
+// but directly with the number of index entries and the size of the data.
+func parseRPMHeader(blob []byte) (*rpmHeader, error) {
+	if len(blob) < 8 {
+		return nil, fmt.Errorf("rpm header is too short")
+	}
+	indexLen := binary.BigEndian.Uint32(blob[0:4])
+	dataLen := binary.BigEndian.Uint32(blob[4:8])
+	dataStart := 8 + uint64(indexLen)*16
+	if dataStart+uint64(dataLen) > uint64(len(blob)) {
+		return nil, fmt.Errorf("rpm header with %d index entries and %d bytes of data exceeds the blob of %d bytes", indexLen, dataLen, len(blob))
+	}
+
+	h := &rpmHeader{index: make(map[int32]rpmIndexEntry, indexLen), data: blob[dataStart : dataStart+uint64(dataLen)]}
+	for i := range uint64(indexLen) {
+		entry := blob[8+i*16 : 8+(i+1)*16]
+		h.index[int32(binary.BigEndian.Uint32(entry[0:4]))] = rpmIndexEntry{
+			Type:   binary.BigEndian.Uint32(entry[4:8]),
+			Offset: int32(binary.BigEndian.Uint32(entry[8:12])),
+			Count:  binary.BigEndian.Uint32(entry[12:16]),
+		}
+	}
+	return h, nil
+}
+
+// strings returns the value of a string, string array or i18n string tag
+func (h *rpmHeader) strings(tag int32) []string {
+	entry, ok := h.index[tag]
+	if !ok || entry.Offset < 0 || int(entry.Offset) > len(h.data) {
+		return nil
+	}
+	switch entry.Type {
+	case rpmTypeString, rpmTypeStringArray, rpmTypeI18NString:
+	default:
+		return nil
+	}
+
+	var values []string
+	data := h.data[entry.Offset:]
+	for range entry.Count {
+		end := bytes.IndexByte(data, 0)
+		if end < 0 {
+			break
+		}
+		values = append(values, string(data[:end]))
+		data = data[end+1:]
+	}
+	return values
+}
+
+// string returns the first value of a string tag or an empty string
+func (h *rpmHeader) string(tag int32) string {
+	if values := h.strings(tag); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// ints returns the values of an int32 or int64 tag
+func (h *rpmHeader) ints(tag int32) []int64 {
+	entry, ok := h.index[tag]
+	if !ok || entry.Offset < 0 {
+		return nil
+	}
+
+	size := uint64(4)
+	if entry.Type == rpmTypeInt64 {
+		size = 8
+	} else if entry.Type != rpmTypeInt32 {
+		return nil
+	}
+	if uint64(entry.Offset)+uint64(entry.Count)*size > uint64(len(h.data)) {
+		return nil
+	}
+
+	values := make([]int64, entry.Count)
+	for i := range values {
+		data := h.data[uint64(entry.Offset)+uint64(i)*size:]
+		if size == 8 {
+			values[i] = int64(binary.BigEndian.Uint64(data))
+		} else {
+			values[i] = int64(int32(binary.BigEndian.Uint32(data)))
+		}
+	}
+	return values
+}
+
+// rpmPackage converts the header of an installed rpm into a Package
+func rpmPackage(blob []byte) (Package, error) {
+	h, err := parseRPMHeader(blob)
+	if err != nil {
+		return Package{}, err
+	}
+
+	pkg := Package{
+		Name:          h.string(rpmTagName),
+		Version:       h.string(rpmTagVersion) + "-" + h.string(rpmTagRelease),
+		Arch:          h.string(rpmTagArch),
+		InstalledSize: -1,
+	}
+	if epoch := h.ints(rpmTagEpoch); len(epoch) > 0 && epoch[0] != 0 {
+		pkg.Version = strconv.FormatInt(epoch[0], 10) + ":" + pkg.Version
+	}
+	if size := h.ints(rpmTagLongSize); len(size) > 0 {
+		pkg.InstalledSize = size[0]
+	} else if size := h.ints(rpmTagSize); len(size) > 0 {
+		pkg.InstalledSize = size[0]
+	}
+
+	basenames, dirnames, dirIndexes := h.strings(rpmTagBasenames), h.strings(rpmTagDirnames), h.ints(rpmTagDirIndexes)
+	if len(basenames) > 0 && len(dirIndexes) == len(basenames) {
+		for i, base := range basenames {
+			if dirIndexes[i] < 0 || dirIndexes[i] >= int64(len(dirnames)) {
+				return Package{}, fmt.Errorf("package %s has an invalid directory index", pkg.Name)
+			}
+			pkg.Files = append(pkg.Files, path.Join(dirnames[dirIndexes[i]], base))
+		}
+	} else {
+		pkg.Files = h.strings(rpmTagOldFilenames)
+	}
+	return pkg, nil
+}
+
+// readRPMDatabase reads the installed packages from the rpm database at path.
+// The sqlite (rpmdb.sqlite), ndb (Packages.db) and Berkeley DB (Packages)
+// formats are detected from the content of the file.
+func readRPMDatabase(dbPath string) ([]Package, error) {
+	f, err := os.Open(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	magic := make([]byte, 16)
+	if _, err := f.ReadAt(magic, 0); err != nil {
+		return nil, fmt.Errorf("failed to read the rpm database: %w", err)
+	}
+
+	var blobs [][]byte
+	switch {
+	case bytes.Equal(magic, []byte("SQLite format 3\x00")):
+		blobs, err = sqliteRPMBlobs(dbPath)
+	case bytes.Equal(magic[:4], []byte("RpmP")):
+		blobs, err = ndbRPMBlobs(f)
+	case isBDBHashMagic(magic[12:16]):
+		blobs, err = bdbRPMBlobs(f)
+	default:
+		return nil, fmt.Errorf("unsupported rpm database format")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	packages := make([]Package, 0, len(blobs))
+	for _, blob := range blobs {
+		pkg, err := rpmPackage(blob)
+		if err != nil {
+			return nil, err
+		}
+		packages = append(packages, pkg)
+	}
+	return packages, nil
+}
+
+// sqliteRPMBlobs returns the package headers of an rpmdb.sqlite database
+func sqliteRPMBlobs(dbPath string) ([][]byte, error) {
+	// the database is opened read-only and immutable, so that sqlite
+	// neither creates lock files nor reads a write-ahead log
+	db, err := sql.Open("sqlite3", "file:"+(&url.URL{Path: dbPath}).EscapedPath()+"?mode=ro&immutable=1")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT blob FROM Packages")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the packages from the rpm database: %w", err)
+	}
+	defer rows.Close()
+
+	var blobs [][]byte
+	for rows.Next() {
+		var blob []byte
+		if err := rows.Scan(&blob); err != nil {
+			return nil, err
+		}
+		blobs = append(blobs, blob)
+	}
+	return blobs, rows.Err()
+}
+
+// constants of the ndb format of rpm, see lib/backend/ndb/rpmpkg.c
+const (
+	ndbHeaderSize   = 32
+	ndbPageSize     = 4096
+	ndbSlotSize     = 16
+	ndbBlockSize    = 16
+	ndbBlobHeadSize = 16
+	ndbMaxPages     = 2048
+)
+
+// ndbRPMBlobs returns the package headers of an ndb Packages.db database.
+// All integers of the format are little endian.
+func ndbRPMBlobs(r io.ReaderAt) ([][]byte, error) {
+	header := make([]byte, ndbHeaderSize)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, fmt.Errorf("failed to read the ndb header: %w", err)
+	}
+	if version := binary.LittleEndian.Uint32(header[4:8]); version != 0 {
+		return nil, fmt.Errorf("unsupported ndb version %d", version)
+	}
+	pages := binary.LittleEndian.Uint32(header[12:16])
+	if pages == 0 || pages > ndbMaxPages {
+		return nil, fmt.Errorf("invalid number of ndb slot pages %d", pages)
+	}
+
+	slots := make([]byte, pages*ndbPageSize-ndbHeaderSize)
+	if _, err := r.ReadAt(slots, ndbHeaderSize); err != nil {
+		return nil, fmt.Errorf("failed to read the ndb slots: %w", err)
+	}
+
+	var blobs [][]byte
+	for slot := range slices.Chunk(slots, ndbSlotSize) {
+		if string(slot[0:4]) != "Slot" {
+			return nil, fmt.Errorf("invalid ndb slot")
+		}
+		pkgIndex := binary.LittleEndian.Uint32(slot[4:8])
+		if pkgIndex == 0 {
+			// unused slot
+			continue
+		}
+		offset := int64(binary.LittleEndian.Uint32(slot[8:12])) * ndbBlockSize
+
+		blobHead := make([]byte, ndbBlobHeadSize)
+		if _, err := r.ReadAt(blobHead, offset); err != nil {
+			return nil, fmt.Errorf("failed to read the ndb blob of package %d: %w", pkgIndex, err)
+		}
+		if string(blobHead[0:4]) != "BlbS" || binary.LittleEndian.Uint32(blobHead[4:8]) != pkgIndex {
+			return nil, fmt.Errorf("invalid ndb blob of package %d", pkgIndex)
+		}
+		blob := make([]byte, binary.LittleEndian.Uint32(blobHead[12:16]))
+		if _, err := r.ReadAt(blob, offset+ndbBlobHeadSize); err != nil {
+			return nil, fmt.Errorf("failed to read the ndb blob of package %d: %w", pkgIndex, err)
+		}
+		blobs = append(blobs, blob)
+	}
+	return blobs, nil
+}
+
+// constants of the Berkeley DB hash format
+const (
+	bdbHashMagic          = 0x00061561
+	bdbPageHeaderSize     = 26
+	bdbPageTypeHashUnsort = 2
+	bdbPageTypeHash       = 13
+	bdbItemOffPage        = 3
+	bdbOffPageSize        = 12
+)
+
+// isBDBHashMagic returns true if magic is the magic number of a Berkeley DB
+// hash database in either byte order
+func isBDBHashMagic(magic []byte) bool {
+	return binary.LittleEndian.Uint32(magic) == bdbHashMagic || binary.BigEndian.Uint32(magic) == bdbHashMagic
+}
+
+// bdbRPMBlobs returns the package headers of a Berkeley DB Packages
+// database. The headers are stored as values in overflow pages, all other
+// values (like the index of the next package) are skipped.
+func bdbRPMBlobs(r io.ReaderAt) ([][]byte, error) {
+	meta := make([]byte, 512)
+	if _, err := r.ReadAt(meta, 0); err != nil {
+		return nil, fmt.Errorf("failed to read the Berkeley DB metadata: %w", err)
+	}
+
+	// the database is stored in the byte order of the machine that
+	// created it
+	var order binary.ByteOrder = binary.LittleEndian
+	if binary.BigEndian.Uint32(meta[12:16]) == bdbHashMagic {
+		order = binary.BigEndian
+	}
+	if meta[24] != 0 {
+		return nil, fmt.Errorf("encrypted Berkeley DB databases are not supported")
+	}
+	pageSize := order.Uint32(meta[20:24])
+	if pageSize < 512 || pageSize > 64*1024 {
+		return nil, fmt.Errorf("invalid Berkeley DB page size %d", pageSize)
+	}
+	lastPage := order.Uint32(meta[32:36])
+
+	readPage := func(pageNo uint32) ([]byte, error) {
+		page := make([]byte, pageSize)
+		if _, err := r.ReadAt(page, int64(pageNo)*int64(pageSize)); err != nil {
+			return nil, fmt.Errorf("failed to read Berkeley DB page %d: %w", pageNo, err)
+		}
+		return page, nil
+	}
+
+	var blobs [][]byte
+	for pageNo := uint32(1); pageNo <= lastPage; pageNo++ {
+		page, err := readPage(pageNo)
+		if err != nil {
+			return nil, err
+		}
+		if page[25] != bdbPageTypeHash && page[25] != bdbPageTypeHashUnsort {
+			continue
+		}
+
+		entries := order.Uint16(page[20:22])
+		// the entries are pairs of keys and values
+		for i := uint32(1); i < uint32(entries); i += 2 {
+			indexOffset := bdbPageHeaderSize + i*2
+			if indexOffset+2 > pageSize {
+				break
+			}
+			offset := uint32(order.Uint16(page[indexOffset:]))
+			if offset+bdbOffPageSize > pageSize || page[offset] != bdbItemOffPage {
+				continue
+			}
+
+			length := order.Uint32(page[offset+8:])
+			var blob []byte
+			for overflow, pages := order.Uint32(page[offset+4:]), uint32(0); overflow != 0; pages++ {
+				if overflow > lastPage || pages > lastPage {
+					return nil, fmt.Errorf("invalid Berkeley DB overflow page %d", overflow)
+				}
+				data, err := readPage(overflow)
+				if err != nil {
+					return nil, err
+				}
+				overflow = order.Uint32(data[16:20])
+				// overflow pages store the length of their data
+				// in the offset of the free area
+				end := min(bdbPageHeaderSize+uint32(order.Uint16(data[22:24])), pageSize)
+				blob = append(blob, data[bdbPageHeaderSize:end]...)
+			}
+			if uint32(len(blob)) != length {
+				return nil, errors.New("invalid Berkeley DB overflow chain")
+			}
+			blobs = append(blobs, blob)
+		}
+	}
+	return blobs, nil
+}
@@ -0,0 +1,84 @@
+package skiff
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/dcermak/skiff/pkg/imagetest"
+)
+
+// sqliteDatabase writes an rpmdb.sqlite database with the packages to path
+func sqliteDatabase(t *testing.T, dbPath string, packages ...imagetest.RPM) {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec("CREATE TABLE Packages (hnum INTEGER PRIMARY KEY AUTOINCREMENT, blob BLOB NOT NULL)"); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range packages {
+		if _, err := db.Exec("INSERT INTO Packages (blob) VALUES (?)", p.Header()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+var testRPMs = []imagetest.RPM{
+	{Name: "bash", Version: "5.2.37", Release: "150700.1.2", Arch: "x86_64", Size: 1234567, Files: []string{"/usr/bin/bash", "/usr/bin/sh", "/usr/share/doc/bash/README"}},
+	{Name: "filesystem", Version: "84.87", Release: "1.1", Arch: "x86_64", Epoch: 1, Size: 0},
+	{Name: "kernel-firmware", Version: "20250101", Release: "1.1", Arch: "noarch", Size: 3 << 30, Files: []string{"/lib/firmware/a.bin"}},
+}
+
+func TestReadRPMDatabase(t *testing.T) {
+	expected := []Package{
+		{Name: "bash", Version: "5.2.37-150700.1.2", Arch: "x86_64", InstalledSize: 1234567, Files: []string{"/usr/bin/bash", "/usr/bin/sh", "/usr/share/doc/bash/README"}},
+		{Name: "filesystem", Version: "1:84.87-1.1", Arch: "x86_64", InstalledSize: 0},
+		{Name: "kernel-firmware", Version: "20250101-1.1", Arch: "noarch", InstalledSize: 3 << 30, Files: []string{"/lib/firmware/a.bin"}},
+	}
+
+	dir := t.TempDir()
+	write := func(name string, content []byte) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	sqlitePath := filepath.Join(dir, "rpmdb.sqlite")
+	sqliteDatabase(t, sqlitePath, testRPMs...)
+
+	tests := []struct {
+		name string
+		path string
+	}{
+		{"sqlite", sqlitePath},
+		{"ndb", write("Packages.db", imagetest.NDBDatabase(testRPMs...))},
+		{"bdb", write("Packages", imagetest.BDBDatabase(binary.LittleEndian, 512, testRPMs...))},
+		{"bdb big endian", write("Packages.be", imagetest.BDBDatabase(binary.BigEndian, 4096, testRPMs...))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packages, err := readRPMDatabase(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(packages, expected) {
+				t.Errorf("Expected packages %+v, got %+v", expected, packages)
+			}
+		})
+	}
+
+	t.Run("unsupported", func(t *testing.T) {
+		if _, err := readRPMDatabase(write("garbage", make([]byte, 1024))); err == nil {
+			t.Error("Expected an error for an unknown database format")
+		}
+	})
+}
@@ -0,0 +1,108 @@
+package skiff
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	tarsplit "github.com/vbatts/tar-split/archive/tar"
+	"github.com/vbatts/tar-split/tar/asm"
+	tarsplitStorage "github.com/vbatts/tar-split/tar/storage"
+	"go.podman.io/storage"
+	"go.podman.io/storage/pkg/lockfile"
+)
+
+// layerDir returns the directory in which the container storage keeps the
+// metadata of its layers.
+//
+// containers/storage has no API to read the tar-split metadata of a layer, so
+// this relies on its private layout: the layer store of the graph root lives
+// in <graph root>/<driver>-layers and records the headers of every layer
+// archive in <layer ID>.tar-split.gz when the layer is created, so that it can
+// later reassemble the original archive from the files of the layer. The
+// store is guarded by the layers.lock file in the same directory.
+func layerDir(store storage.Store) string {
+	return filepath.Join(store.GraphRoot(), store.GraphDriverName()+"-layers")
+}
+
+// tarSplitPath returns the path of the tar-split metadata of a layer in the
+// container storage, see layerDir.
+func tarSplitPath(store storage.Store, layer storage.Layer) string {
+	return filepath.Join(layerDir(store), layer.ID+".tar-split.gz")
+}
+
+// storageLayerEntries returns the entries of a layer in the container storage
+// by reading the headers from its tar-split metadata. Unlike GetBlob, this
+// neither mounts the layer nor reads the content of its files to rebuild the
+// layer archive.
+//
+// The metadata is read with the lock of the layer store held for reading, so
+// that the layer cannot be removed while it is read. Afterwards, the layer is
+// looked up again to ensure that the metadata belongs to the same layer.
+//
+// An error wrapping fs.ErrNotExist is returned if the layer has no tar-split
+// metadata, e.g. because it is stored in an additional image store, or if the
+// layer has been removed or replaced in the meantime.
+func storageLayerEntries(store storage.Store, layer storage.Layer) ([]FileEntry, error) {
+	lock, err := lockfile.GetLockFile(filepath.Join(layerDir(store), "layers.lock"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock the layers of the container storage: %w", err)
+	}
+	lock.RLock()
+	entries, err := readTarSplit(store, layer)
+	lock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := store.Layer(layer.ID)
+	if err != nil {
+		if errors.Is(err, storage.ErrLayerUnknown) {
+			return nil, fmt.Errorf("layer %s was removed: %w", layer.ID, fs.ErrNotExist)
+		}
+		return nil, err
+	}
+	if current.UncompressedDigest != layer.UncompressedDigest {
+		return nil, fmt.Errorf("layer %s was replaced: %w", layer.ID, fs.ErrNotExist)
+	}
+	return entries, nil
+}
+
+// readTarSplit reads the entries of the layer from its tar-split metadata.
+// The caller must hold the lock of the layer store.
+func readTarSplit(store storage.Store, layer storage.Layer) ([]FileEntry, error) {
+	f, err := os.Open(tarSplitPath(store, layer))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress the tar-split metadata of layer %s: %w", layer.ID, err)
+	}
+	defer gz.Close()
+
+	var entries []FileEntry
+	err = asm.IterateHeaders(tarsplitStorage.NewJSONUnpacker(gz), func(hdr *tarsplit.Header) error {
+		entries = append(entries, NewFileEntry(&tar.Header{
+			Name:       hdr.Name,
+			Typeflag:   hdr.Typeflag,
+			Size:       hdr.Size,
+			Mode:       hdr.Mode,
+			Uid:        hdr.Uid,
+			Gid:        hdr.Gid,
+			Linkname:   hdr.Linkname,
+			PAXRecords: hdr.PAXRecords,
+		}))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the tar-split metadata of layer %s: %w", layer.ID, err)
+	}
+	return entries, nil
+}
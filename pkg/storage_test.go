@@ -0,0 +1,104 @@
+package skiff
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"go.podman.io/storage"
+	"go.podman.io/storage/pkg/reexec"
+
+	"github.com/dcermak/skiff/pkg/imagetest"
+)
+
+// TestMain lets the container storage of the tests run its helper processes
+func TestMain(m *testing.M) {
+	if reexec.Init() {
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// newTestStore returns a container storage in a temporary directory that
+// uses the vfs driver
+func newTestStore(t *testing.T) storage.Store {
+	t.Helper()
+
+	store, err := storage.GetStore(storage.StoreOptions{
+		GraphRoot:       t.TempDir(),
+		RunRoot:         t.TempDir(),
+		GraphDriverName: "vfs",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := store.Shutdown(true); err != nil {
+			t.Error(err)
+		}
+	})
+	return store
+}
+
+func TestStorageLayerEntries(t *testing.T) {
+	layer := imagetest.Layer{
+		Files: []imagetest.File{
+			{Path: "usr/", Typeflag: tar.TypeDir},
+			{Path: "usr/bin/", Typeflag: tar.TypeDir},
+			{Path: "usr/bin/tool", Content: strings.Repeat("x", 1000)},
+			{Path: "usr/bin/link", Typeflag: tar.TypeSymlink, Linkname: "tool"},
+			{Path: "etc/", Typeflag: tar.TypeDir},
+			{Path: "etc/.wh.config"},
+			{Path: "usr/share/" + strings.Repeat("long/", 30) + "name", Content: "odd"},
+		},
+	}
+	archive := layer.Tar(t)
+	store := newTestStore(t)
+	storageLayer, _, err := store.PutLayer("", "", nil, "", false, nil, bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var expected []FileEntry
+	tr := tar.NewReader(bytes.NewReader(archive))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected = append(expected, NewFileEntry(hdr))
+	}
+
+	entries, err := storageLayerEntries(store, *storageLayer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Expected the entries %v, got %v", expected, entries)
+	}
+
+	replaced := *storageLayer
+	replaced.UncompressedDigest = digest.FromString("other")
+	_, err = storageLayerEntries(store, replaced)
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected a replaced layer to return fs.ErrNotExist, got %v", err)
+	}
+
+	if err := store.DeleteLayer(storageLayer.ID); err != nil {
+		t.Fatal(err)
+	}
+	_, err = storageLayerEntries(store, *storageLayer)
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected a removed layer to return fs.ErrNotExist, got %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package skiff
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	dirTransport "go.podman.io/image/v5/directory"
+	dockerArchive "go.podman.io/image/v5/docker/archive"
+	ociArchive "go.podman.io/image/v5/oci/archive"
+	ociLayout "go.podman.io/image/v5/oci/layout"
+	storageTransport "go.podman.io/image/v5/storage"
+	"go.podman.io/image/v5/types"
+)
+
+// IsLocalTransport returns true if the image is stored on the local machine,
+// so that reading its layers does not require downloading them.
+func IsLocalTransport(ref types.ImageReference) bool {
+	switch ref.Transport().Name() {
+	case ociLayout.Transport.Name(),
+		ociArchive.Transport.Name(),
+		dockerArchive.Transport.Name(),
+		dirTransport.Transport.Name(),
+		storageTransport.Transport.Name():
+		return true
+	}
+	return false
+}
+
+// transportForPath returns the transport of the image stored at path (an OCI
+// layout or `dir:` directory or an OCI or docker archive) or an empty string
+// if path is not an image. An error is returned if path is a file that cannot
+// be read as an archive.
+func transportForPath(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", nil
+	}
+
+	if info.IsDir() {
+		if _, err := os.Stat(filepath.Join(path, imgspecv1.ImageLayoutFile)); err == nil {
+			return ociLayout.Transport.Name(), nil
+		}
+		// dir: stores the manifest as manifest.json next to the blobs
+		if _, err := os.Stat(filepath.Join(path, "manifest.json")); err == nil {
+			return dirTransport.Transport.Name(), nil
+		}
+		return "", nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return "", nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read the image archive %s: %w", path, err)
+		}
+		switch filepath.Clean(hdr.Name) {
+		case imgspecv1.ImageLayoutFile:
+			return ociArchive.Transport.Name(), nil
+		case "manifest.json":
+			return dockerArchive.Transport.Name(), nil
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package skiff
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+
+	"github.com/dcermak/skiff/pkg/imagetest"
+)
+
+var testImage = imagetest.Image{
+	Layers: []imagetest.Layer{
+		{
+			CreatedBy: "ADD rootfs.tar /",
+			Files: []imagetest.File{
+				{Path: "usr/", Typeflag: tar.TypeDir},
+				{Path: "usr/bin/", Typeflag: tar.TypeDir},
+				{Path: "usr/bin/tool", Content: strings.Repeat("x", 1000)},
+				{Path: "etc/", Typeflag: tar.TypeDir},
+				{Path: "etc/config", Content: "old"},
+			},
+		},
+		{
+			CreatedBy:    "RUN update",
+			Uncompressed: true,
+			Files: []imagetest.File{
+				{Path: "etc/", Typeflag: tar.TypeDir},
+				{Path: "etc/.wh.config"},
+				{Path: "opt/", Typeflag: tar.TypeDir},
+				{Path: "opt/app", Content: "app"},
+			},
+		},
+	},
+}
+
+func TestTransports(t *testing.T) {
+	ctx := context.Background()
+	diffIDs := []digest.Digest{testImage.Layers[0].DiffID(t), testImage.Layers[1].DiffID(t)}
+
+	for name, uri := range imagetest.WriteAllTransports(t, testImage) {
+		t.Run(name, func(t *testing.T) {
+			layers, err := OpenImageLayers(ctx, nil, uri)
+			if err != nil {
+				t.Fatalf("Failed to open %s: %v", uri, err)
+			}
+			defer layers.Close()
+
+			if !IsLocalTransport(layers.Image.Reference()) {
+				t.Errorf("Expected %s to be a local transport", name)
+			}
+			if !slices.Equal(layers.DiffIDs, diffIDs) {
+				t.Errorf("Expected the diffIDs %v, got %v", diffIDs, layers.DiffIDs)
+			}
+
+			fs, err := layers.Merge(ctx, 1, false)
+			if err != nil {
+				t.Fatalf("Failed to merge the layers: %v", err)
+			}
+			var files []string
+			err = fs.Walk(func(n *Node) error {
+				if n.Entry.IsRegular() {
+					files = append(files, n.Entry.Path)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			slices.Sort(files)
+			if expected := []string{"/opt/app", "/usr/bin/tool"}; !slices.Equal(files, expected) {
+				t.Errorf("Expected the files %v, got %v", expected, files)
+			}
+		})
+	}
+}
+
+func TestWithPathTransport(t *testing.T) {
+	uris := imagetest.WriteAllTransports(t, testImage)
+
+	for name, uri := range uris {
+		_, path, _ := strings.Cut(uri, ":")
+		path = strings.TrimSuffix(path, ":latest")
+		if res, err := withPathTransport(path); err != nil || res != name+":"+path {
+			t.Errorf("Expected the %s transport for %s, got %s (%v)", name, path, res, err)
+		}
+	}
+
+	for _, uri := range []string{"registry.suse.com/bci/python:3.11", "docker://alpine", uris["oci"]} {
+		if res, err := withPathTransport(uri); err != nil || res != uri {
+			t.Errorf("Expected %s to be unchanged, got %s (%v)", uri, res, err)
+		}
+	}
+}
+
+func TestWithPathTransportTruncatedArchive(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{Name: "blobs/layer", Typeflag: tar.TypeReg, Size: 1000, Mode: 0o644}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte("truncated")); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "image.tar")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := withPathTransport(path); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expected an unexpected EOF for the truncated archive, got %v", err)
+	}
+
+	empty := filepath.Join(t.TempDir(), "empty.tar")
+	if err := os.WriteFile(empty, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if res, err := withPathTransport(empty); err != nil || res != empty {
+		t.Errorf("Expected %s to be unchanged, got %s (%v)", empty, res, err)
+	}
+}
@@ -11,9 +11,17 @@ BuildRequires:  libgpgme-devel
 
 %description
 skiff is a tool for inspecting OCI container image layers.
-It provides two commands:
-  layers - show uncompressed size of each layer
-  top    - show the largest files across layers
+It provides the following commands:
+  layers  - show uncompressed size of each layer
+  top     - show the largest files across layers
+  wasted  - show files that are overwritten or deleted by later layers
+  diff    - compare the layers and files of two images
+  explore - interactively browse the layers and filesystem of an image
+  packages - list the installed packages by size and the layers that installed them
+  dependencies - list the dependencies of language ecosystems by size
+  lint    - check an image for common sources of wasted space
+  check   - check that an image stays within size budgets
+  cache   - manage the cache of downloaded layers
 
 %prep
 %autosetup -p1